@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"remarkable-sync/internal/convert"
+	"remarkable-sync/internal/plan"
+	"remarkable-sync/internal/remarkable"
+	"remarkable-sync/internal/state"
+)
+
+// planBinder binds the notes under paths into one document titled --bind
+// it's tracked under "<title>.binder" in the vault, so later runs overwrite it in place
+func planBinder(client *remarkable.Client, converter *convert.Converter, store *state.Store, folders *folderPlanner, p *plan.Plan, paths []string) error {
+	var notes []string
+	for _, path := range paths {
+		err := processFiles(path, func(filePath string) error {
+			if !strings.EqualFold(filepath.Ext(filePath), ".md") {
+				return nil
+			}
+			note, err := convert.ReadNoteOptions(filePath)
+			if err != nil {
+				return err
+			}
+			if note.Skip() {
+				log("Skipping %s (sync: false)", filePath)
+				return nil
+			}
+			notes = append(notes, filePath)
+			return nil
+		})
+		if err != nil {
+			log("warning: %v", err)
+		}
+	}
+
+	notes, err := converter.OrderNotes(notes, bindOrder)
+	if err != nil {
+		return err
+	}
+	if len(notes) == 0 {
+		return fmt.Errorf("no notes to bind")
+	}
+
+	// the binder changes when a note does, the options it's rendered with or the order does
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n", bindTitle)
+	for _, note := range notes {
+		hash, err := state.HashFile(note)
+		if err != nil {
+			return fmt.Errorf("failed to hash %s: %w", note, err)
+		}
+		render, err := converter.RenderHash(note)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s %s %s\n", absPath(note), hash, render)
+	}
+	hash := hex.EncodeToString(h.Sum(nil))
+
+	sourcePath := filepath.Join(absPath(obsidianVault), strings.ReplaceAll(bindTitle, "/", "-")+".binder")
+	if isUnchanged(client, store, sourcePath, hash, "") {
+		log("Unchanged: %s", bindTitle)
+		return nil
+	}
+
+	log("Binding %d notes: %s", len(notes), bindTitle)
+	pdfPath, err := converter.BindToPDF(bindTitle, notes)
+	if err != nil {
+		return fmt.Errorf("conversion failed: %w", err)
+	}
+
+	parentUUID, err := folders.resolve(folderName)
+	if err != nil {
+		return err
+	}
+	return planPush(client, store, p, sourcePath, hash, "", pdfPath, parentUUID, true)
+}
@@ -7,9 +7,13 @@ import (
 	"strings"
 
 	"remarkable-sync/internal/convert"
+	"remarkable-sync/internal/plan"
 	"remarkable-sync/internal/remarkable"
+	"remarkable-sync/internal/state"
 
 	"github.com/spf13/cobra"
+	"github.com/zalando/go-keyring"
+	"golang.org/x/term"
 )
 
 var (
@@ -29,17 +33,31 @@ var (
 	forceOverwrite     bool
 	purgeExceptPattern string
 	folderName         string
+	mirrorVault        bool
+	bindTitle          string
+	bindOrder          string
 	dryRun             bool
+	savePlanPath       string
+	statePath          string
+	knownHostsFile     string
+	indexCache         string
+	password           string
+	savePassword       bool
 
 	// pdf flags
-	pdfMargins    float64
-	pdfFontSize   float64
-	pdfMainFont   string
-	pdfMonoFont   string
-	pdfPageSize   string
-	pdfColorLinks bool
-	pdfTOC        bool
-	pdfHighlight  bool
+	pdfMargins     float64
+	pdfFontSize    float64
+	pdfMainFont    string
+	pdfMonoFont    string
+	pdfMathFont    string
+	pdfPageSize    string
+	pdfColorLinks  bool
+	pdfTOC         bool
+	pdfHighlight   bool
+	pdfGrayscale   bool
+	pdfLineNumbers bool
+	pdfHeader      string
+	pdfFooter      string
 
 	// markdown flags
 	mdHeaderAdjust int
@@ -54,6 +72,8 @@ func init() {
 	rootCmd.AddCommand(newToRemarkableCmd())
 	rootCmd.AddCommand(newCleanupCmd())
 	rootCmd.AddCommand(newRemoveCmd())
+	rootCmd.AddCommand(newSyncCmd())
+	rootCmd.AddCommand(newApplyCmd())
 
 	// global flags - used across multiple commands
 	rootCmd.PersistentFlags().StringVar(&remarkableHost, "host", "remarkable", "reMarkable tablet hostname/IP")
@@ -61,19 +81,41 @@ func init() {
 	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Suppress non-error output")
 	rootCmd.PersistentFlags().BoolVarP(&restartXochitl, "restart", "r", true, "Restart xochitl after transfer")
 	rootCmd.PersistentFlags().BoolVarP(&forceOverwrite, "force", "f", false, "Overwrite existing files without prompting")
+	rootCmd.PersistentFlags().StringVar(&statePath, "state", state.DefaultPath(), "Sync state file tracking uploaded documents")
+	rootCmd.PersistentFlags().StringVar(&knownHostsFile, "known-hosts", remarkable.DefaultKnownHostsFile(), "File recording trusted tablet host keys (~/.ssh/known_hosts is checked too)")
+	rootCmd.PersistentFlags().StringVar(&indexCache, "cache", remarkable.DefaultIndexCache(), "File caching tablet metadata between runs, empty to disable")
+	rootCmd.PersistentFlags().StringVar(&password, "password", "", "Root password from Settings > Help (default: read from the system keyring)")
+	rootCmd.PersistentFlags().BoolVar(&savePassword, "save-password", false, "Store --password in the system keyring for later runs")
+	rootCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "Print the plan without changing anything")
+	rootCmd.PersistentFlags().StringVar(&savePlanPath, "save-plan", "", "Save the plan as json for 'apply' instead of running it")
 }
 
-func getPDFOptions() convert.PDFOptions {
-	return convert.PDFOptions{
-		Margins:    pdfMargins,
-		FontSize:   pdfFontSize,
-		MainFont:   pdfMainFont,
-		MonoFont:   pdfMonoFont,
-		PageSize:   pdfPageSize,
-		ColorLinks: pdfColorLinks,
-		TOC:        pdfTOC,
-		Highlight:  pdfHighlight,
-	}
+func getPDFOptions(cmd *cobra.Command) convert.PDFOptions {
+	options := convert.PDFOptions{
+		Margins:     pdfMargins,
+		FontSize:    pdfFontSize,
+		MainFont:    pdfMainFont,
+		MonoFont:    pdfMonoFont,
+		MathFont:    pdfMathFont,
+		PageSize:    pdfPageSize,
+		ColorLinks:  pdfColorLinks,
+		TOC:         pdfTOC,
+		Highlight:   pdfHighlight,
+		Grayscale:   pdfGrayscale,
+		LineNumbers: pdfLineNumbers,
+		Header:      pdfHeader,
+		Footer:      pdfFooter,
+
+		// a device page size, here or in a note, brings its margins and font size unless
+		// they're given too
+		FixedMargins:  cmd.Flags().Changed("pdf-margins"),
+		FixedFontSize: cmd.Flags().Changed("pdf-fontsize"),
+	}
+
+	if profile, ok := convert.LookupProfile(pdfPageSize); ok {
+		options = profile.Apply(options)
+	}
+	return options
 }
 
 func getMarkdownOptions() convert.MarkdownOptions {
@@ -84,6 +126,84 @@ func getMarkdownOptions() convert.MarkdownOptions {
 	}
 }
 
+// newClient connects to the tablet, reporting transfer progress unless --quiet
+func newClient(dir string) (*remarkable.Client, error) {
+	pw, err := loadPassword()
+	if err != nil {
+		return nil, err
+	}
+
+	return remarkable.NewClient(remarkableHost, dir, remarkable.Options{
+		KnownHostsFile: knownHostsFile,
+		ConfirmHostKey: confirmHostKey,
+		Password:       pw,
+		Passphrase:     readPassphrase,
+		Progress:       printProgress,
+		IndexCache:     indexCache,
+	})
+}
+
+// keyring entries are stored under this service, keyed by --host
+const keyringService = "remarkable-sync"
+
+// loadPassword returns --password, saving it if asked, or else the one in the keyring
+func loadPassword() (string, error) {
+	if password != "" {
+		if savePassword {
+			if err := keyring.Set(keyringService, remarkableHost, password); err != nil {
+				return "", fmt.Errorf("failed to save password to keyring: %w", err)
+			}
+		}
+		return password, nil
+	}
+	if savePassword {
+		return "", fmt.Errorf("--save-password requires --password")
+	}
+
+	// no keyring or no entry, keys and the empty password are still tried
+	pw, err := keyring.Get(keyringService, remarkableHost)
+	if err != nil {
+		return "", nil
+	}
+	return pw, nil
+}
+
+// readPassphrase asks for the passphrase of an encrypted key on the terminal
+func readPassphrase(file string) ([]byte, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("no terminal to ask for the passphrase of %s", file)
+	}
+	fmt.Fprintf(os.Stderr, "Enter passphrase for key '%s': ", file)
+	passphrase, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	return passphrase, err
+}
+
+// confirmHostKey asks before trusting a tablet seen for the first time
+func confirmHostKey(host, via, fingerprint string) bool {
+	fmt.Printf("The authenticity of reMarkable via %s (%s) can't be established.\n", via, host)
+	fmt.Printf("Host key fingerprint is %s.\n", fingerprint)
+	fmt.Printf("Trust this key and remember it in %s? [y/N]: ", knownHostsFile)
+	var response string
+	fmt.Scanln(&response)
+	response = strings.ToLower(strings.TrimSpace(response))
+	return response == "y" || response == "yes"
+}
+
+// only transfers big enough to notice get a progress line
+const progressThreshold = 512 * 1024
+
+func printProgress(name string, done, total int64) {
+	if quiet || total < progressThreshold {
+		return
+	}
+	fmt.Printf("\r  %s: %d/%d KB", name, done/1024, total/1024)
+	if done >= total {
+		fmt.Println()
+	}
+}
+
 func log(format string, args ...interface{}) {
 	if !quiet {
 		fmt.Printf(format+"\n", args...)
@@ -104,7 +224,7 @@ func newToRemarkableCmd() *cobra.Command {
 		Long:  `Transfer PDF and EPUB files to reMarkable tablet. If no arguments provided, transfers from Obsidian vault.`,
 		RunE:  toRemarkableHandler,
 	}
-	cmd.Flags().StringVar(&folderName, "folder", "", "Upload files to this folder (creates if doesn't exist)")
+	cmd.Flags().StringVar(&folderName, "folder", "", "Upload files to this folder, nested with / (creates if doesn't exist)")
 	return cmd
 }
 
@@ -117,9 +237,16 @@ func processFiles(path string, process func(string) error) error {
 
 	if info.IsDir() {
 		return filepath.Walk(path, func(filePath string, fileInfo os.FileInfo, err error) error {
-			if err != nil || fileInfo.IsDir() {
+			if err != nil {
 				return err
 			}
+			// .obsidian, .git, .trash and the like
+			if fileInfo.IsDir() && filePath != path && strings.HasPrefix(fileInfo.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if fileInfo.IsDir() {
+				return nil
+			}
 			return process(filePath)
 		})
 	}
@@ -131,25 +258,23 @@ func toRemarkableHandler(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("at least one file or directory path is required")
 	}
 
-	client, err := remarkable.NewClient(remarkableHost, remarkableDir)
+	client, err := newClient(remarkableDir)
 	if err != nil {
 		return fmt.Errorf("failed to connect to remarkable: %w", err)
 	}
 	defer client.Close()
 
-	if err := stopXochitl(client); err != nil {
+	store, err := state.Open(statePath)
+	if err != nil {
 		return err
 	}
 
+	p := newPlan("to-remarkable")
+
 	// handles folder creation if --folder flag is provided
-	var parentUUID string
-	if folderName != "" {
-		log("Ensuring folder '%s' exists...", folderName)
-		parentUUID, err = client.EnsureFolder(folderName)
-		if err != nil {
-			return fmt.Errorf("failed to ensure folder: %w", err)
-		}
-		log("Using folder UUID: %s", parentUUID)
+	parentUUID, err := newFolderPlanner(client, p).resolve(folderName)
+	if err != nil {
+		return err
 	}
 
 	// process each path
@@ -159,14 +284,14 @@ func toRemarkableHandler(cmd *cobra.Command, args []string) error {
 				// skips unsupported files silently
 				return nil
 			}
-			return uploadFile(client, filePath, parentUUID)
+			return planUpload(client, store, p, filePath, parentUUID)
 		})
 		if err != nil {
 			log("warning: %v", err)
 		}
 	}
 
-	return restartXochitlService(client)
+	return runPlan(client, p, "")
 }
 
 func newFromRemarkableCmd() *cobra.Command {
@@ -181,15 +306,19 @@ func newFromRemarkableCmd() *cobra.Command {
 	cmd.Flags().StringVar(&obsidianVault, "vault", os.ExpandEnv("$HOME/notes"), "Path to Obsidian vault")
 
 	// markdown conversion options
+	addMarkdownFlags(cmd)
+
+	return cmd
+}
+
+func addMarkdownFlags(cmd *cobra.Command) {
 	cmd.Flags().IntVar(&mdHeaderAdjust, "md-header-adjust", 1, "adjust header levels")
 	cmd.Flags().BoolVar(&mdFrontmatter, "md-frontmatter", true, "add yaml frontmatter")
 	cmd.Flags().BoolVar(&mdCleanupText, "md-cleanup", true, "clean up extracted text")
-
-	return cmd
 }
 
 func fromRemarkableHandler(cmd *cobra.Command, args []string) error {
-	client, err := remarkable.NewClient(remarkableHost, remarkableDir)
+	client, err := newClient(remarkableDir)
 	if err != nil {
 		return fmt.Errorf("failed to connect to reMarkable: %w", err)
 	}
@@ -249,27 +378,39 @@ func newObsidianCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "obsidian [files/directories...]",
 		Short: "Sync Obsidian vault with reMarkable",
-		Long:  `Convert markdown files from Obsidian vault to PDF and upload them to reMarkable tablet.`,
+		Long:  `Convert markdown files, canvases and code and config files from Obsidian vault to PDF and upload them to reMarkable tablet.`,
 		RunE:  obsidianHandler,
 	}
 	cmd.Flags().StringVar(&obsidianVault, "vault", os.ExpandEnv("$HOME/notes"), "Path to Obsidian vault")
-	cmd.Flags().StringVar(&folderName, "folder", "", "Upload files to this folder (creates if doesn't exist)")
+	cmd.Flags().StringVar(&folderName, "folder", "", "Upload files to this folder, nested with / (creates if doesn't exist)")
+	cmd.Flags().BoolVar(&mirrorVault, "mirror", false, "Reproduce the vault's directories as folders under --folder")
+	cmd.Flags().StringVar(&bindTitle, "bind", "", "Bind the notes into one PDF with this title, with a cover, contents and an outline entry per note")
+	cmd.Flags().StringVar(&bindOrder, "bind-order", "name", "Order of the bound notes: name, order (frontmatter) or a MOC note whose links give it")
 
 	// pdf conversion options
+	addPDFFlags(cmd)
+
+	return cmd
+}
+
+func addPDFFlags(cmd *cobra.Command) {
 	cmd.Flags().Float64Var(&pdfMargins, "pdf-margins", 20.0, "margins in mm")
 	cmd.Flags().Float64Var(&pdfFontSize, "pdf-fontsize", 11.0, "base font size")
-	cmd.Flags().StringVar(&pdfMainFont, "pdf-font", "Arial", "main font")
-	cmd.Flags().StringVar(&pdfMonoFont, "pdf-monofont", "Courier", "monospace font")
-	cmd.Flags().StringVar(&pdfPageSize, "pdf-pagesize", "A4", "page size")
+	cmd.Flags().StringVar(&pdfMainFont, "pdf-font", "Arial", "main font, an installed family or a .ttf file")
+	cmd.Flags().StringVar(&pdfMonoFont, "pdf-monofont", "Courier", "monospace font, an installed family or a .ttf file")
+	cmd.Flags().StringVar(&pdfMathFont, "pdf-mathfont", "", "font for math formulas (default: DejaVu Sans or another installed font with math symbols)")
+	cmd.Flags().StringVar(&pdfPageSize, "pdf-pagesize", "A4", "page size: A4, Letter, ... or a tablet: rm1, rm2, paperpro, paperpro-move, with -annotate for a wide right margin")
 	cmd.Flags().BoolVar(&pdfColorLinks, "pdf-colorlinks", true, "use colored links")
 	cmd.Flags().BoolVar(&pdfTOC, "pdf-toc", true, "include table of contents")
 	cmd.Flags().BoolVar(&pdfHighlight, "pdf-highlight", true, "highlight code blocks")
-
-	return cmd
+	cmd.Flags().StringVar(&pdfHeader, "pdf-header", "", "page header: {title}, {path}, {tags}, {date}, {modified}, {page} and {pages}, with | between left, center and right parts")
+	cmd.Flags().StringVar(&pdfFooter, "pdf-footer", "{title}|{page} / {pages}", "page footer, as --pdf-header; empty for none")
+	cmd.Flags().BoolVar(&pdfLineNumbers, "pdf-linenumbers", false, "number the lines of code blocks")
+	cmd.Flags().BoolVar(&pdfGrayscale, "pdf-grayscale", false, "convert images to grayscale")
 }
 
 func obsidianHandler(cmd *cobra.Command, args []string) error {
-	client, err := remarkable.NewClient(remarkableHost, remarkableDir)
+	client, err := newClient(remarkableDir)
 	if err != nil {
 		return fmt.Errorf("failed to connect to remarkable: %w", err)
 	}
@@ -281,22 +422,19 @@ func obsidianHandler(cmd *cobra.Command, args []string) error {
 	}
 	defer converter.Close()
 
-	converter.SetOptions(getPDFOptions())
+	converter.SetOptions(getPDFOptions(cmd))
+	converter.SetVault(obsidianVault)
+	converter.SetLogger(log)
 
-	if err := stopXochitl(client); err != nil {
+	store, err := state.Open(statePath)
+	if err != nil {
 		return err
 	}
 
-	// handles folder creation if --folder flag is provided
-	var parentUUID string
-	if folderName != "" {
-		log("Ensuring folder '%s' exists...", folderName)
-		parentUUID, err = client.EnsureFolder(folderName)
-		if err != nil {
-			return fmt.Errorf("failed to ensure folder: %w", err)
-		}
-		log("Using folder UUID: %s", parentUUID)
-	}
+	p := newPlan("obsidian")
+
+	// folders from --folder and --mirror are created as notes need them
+	folders := newFolderPlanner(client, p)
 
 	// process provided paths or entire vault
 	paths := args
@@ -304,19 +442,32 @@ func obsidianHandler(cmd *cobra.Command, args []string) error {
 		paths = []string{obsidianVault}
 	}
 
+	if bindTitle != "" {
+		if err := planBinder(client, converter, store, folders, p, paths); err != nil {
+			return err
+		}
+		return runPlan(client, p, "")
+	}
+
 	for _, path := range paths {
 		err := processFiles(path, func(filePath string) error {
-			if !strings.HasSuffix(filePath, ".md") {
+			if !convert.Convertible(filePath) {
 				return nil
 			}
-			return convertAndUpload(client, converter, filePath, parentUUID)
+			return planConvert(client, converter, store, folders, p, filePath)
 		})
 		if err != nil {
 			log("warning: %v", err)
 		}
 	}
 
-	return restartXochitlService(client)
+	if mirrorVault {
+		if err := planPrune(client, p); err != nil {
+			log("warning: %v", err)
+		}
+	}
+
+	return runPlan(client, p, "")
 }
 
 func newCleanupCmd() *cobra.Command {
@@ -327,7 +478,6 @@ func newCleanupCmd() *cobra.Command {
 		RunE:  cleanupHandler,
 	}
 	cmd.Flags().StringVar(&purgeExceptPattern, "except", "", "Pattern to preserve (e.g. 'Quick sheets|Notebook tutorial')")
-	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Preview what would be deleted without actually deleting")
 	return cmd
 }
 
@@ -336,13 +486,18 @@ func cleanupHandler(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("--except pattern is required")
 	}
 
-	client, err := remarkable.NewClient(remarkableHost, remarkableDir)
+	client, err := newClient(remarkableDir)
 	if err != nil {
 		return fmt.Errorf("failed to connect to reMarkable: %w", err)
 	}
 	defer client.Close()
 
-	// first run a dry-run to preview changes
+	store, err := state.Open(statePath)
+	if err != nil {
+		return err
+	}
+
+	// analyze without deleting, the plan does the rest
 	log("Analyzing files on reMarkable...")
 	result, err := client.CleanupExcept(purgeExceptPattern, true)
 	if err != nil {
@@ -371,40 +526,10 @@ func cleanupHandler(cmd *cobra.Command, args []string) error {
 	}
 	log("")
 
-	// if dry-run mode, stop here
-	if dryRun {
-		log("DRY RUN: No files were actually deleted.")
-		return nil
-	}
-
-	// confirmation prompt unless forced
-	if !forceOverwrite {
-		fmt.Printf("\nAre you sure you want to delete %d file(s)? [y/N]: ", len(result.DeletedFiles))
-		var response string
-		fmt.Scanln(&response)
-		response = strings.ToLower(strings.TrimSpace(response))
-		if response != "y" && response != "yes" {
-			log("Cleanup cancelled.")
-			return nil
-		}
-	}
-
-	if err := stopXochitl(client); err != nil {
-		return err
-	}
-
-	log("Deleting files...")
-	result, err = client.CleanupExcept(purgeExceptPattern, false)
-	if err != nil {
-		return fmt.Errorf("cleanup failed: %w", err)
-	}
-
-	if err := restartXochitlService(client); err != nil {
-		return err
-	}
+	p := newPlan("cleanup")
+	planDeletes(store, p, result.DeletedFiles)
 
-	log("\n✓ Successfully deleted %d file(s) and preserved %d file(s)", len(result.DeletedFiles), len(result.PreservedFiles))
-	return nil
+	return runPlan(client, p, fmt.Sprintf("Are you sure you want to delete %d file(s)?", len(result.DeletedFiles)))
 }
 
 func newRemoveCmd() *cobra.Command {
@@ -421,79 +546,88 @@ func newRemoveCmd() *cobra.Command {
 func removeHandler(cmd *cobra.Command, args []string) error {
 	fileName := args[0]
 
-	client, err := remarkable.NewClient(remarkableHost, remarkableDir)
+	client, err := newClient(remarkableDir)
 	if err != nil {
 		return fmt.Errorf("failed to connect to reMarkable: %w", err)
 	}
 	defer client.Close()
 
-	// checks if file exists first
-	exists, err := client.FileExists(fileName)
+	store, err := state.Open(statePath)
 	if err != nil {
-		return fmt.Errorf("failed to check if file exists: %w", err)
+		return err
 	}
 
-	if !exists {
-		log("File '%s' not found on reMarkable", fileName)
-		return nil
+	// matches every copy of that name, including those in trash
+	files, err := client.FindByName(fileName)
+	if err != nil {
+		return fmt.Errorf("failed to check if file exists: %w", err)
 	}
 
-	if err := stopXochitl(client); err != nil {
-		return err
+	live := false
+	for _, file := range files {
+		live = live || file.Parent != "trash"
 	}
-
-	log("Removing file: %s", fileName)
-	if err := client.DeleteFileByName(fileName); err != nil {
-		return fmt.Errorf("failed to remove file: %w", err)
+	if !live {
+		log("File '%s' not found on reMarkable", fileName)
+		return nil
 	}
 
-	if err := restartXochitlService(client); err != nil {
-		return err
-	}
+	p := newPlan("remove")
+	planDeletes(store, p, files)
 
-	log("Successfully removed: %s", fileName)
-	return nil
+	return runPlan(client, p, "")
 }
 
 // helper functions
-func stopXochitl(client *remarkable.Client) error {
-	if !restartXochitl {
-		return nil
-	}
-	log("Stopping xochitl...")
-	if _, err := client.RunCommand("systemctl stop xochitl"); err != nil {
-		return fmt.Errorf("failed to stop xochitl: %w", err)
-	}
-	return nil
+func isSupported(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".pdf" || ext == ".epub"
 }
 
-func restartXochitlService(client *remarkable.Client) error {
-	if !restartXochitl {
-		return nil
+func planUpload(client *remarkable.Client, store *state.Store, p *plan.Plan, path string, parentUUID string) error {
+	hash, err := state.HashFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to hash %s: %w", path, err)
 	}
-	log("Restarting xochitl...")
-	if _, err := client.RunCommand("systemctl restart xochitl"); err != nil {
-		return fmt.Errorf("failed to restart xochitl: %w", err)
+	if isUnchanged(client, store, path, hash, "") {
+		log("Unchanged: %s", path)
+		return nil
 	}
-	return nil
-}
 
-func isSupported(path string) bool {
-	ext := strings.ToLower(filepath.Ext(path))
-	return ext == ".pdf" || ext == ".epub"
+	return planPush(client, store, p, path, hash, "", path, parentUUID, false)
 }
 
-func uploadFile(client *remarkable.Client, path string, parentUUID string) error {
-	log("Uploading: %s", path)
-	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
-	if parentUUID != "" {
-		return client.UploadFile(path, name, forceOverwrite, parentUUID)
+func planConvert(client *remarkable.Client, converter *convert.Converter, store *state.Store, folders *folderPlanner, p *plan.Plan, mdPath string) error {
+	note, err := convert.ReadNoteOptions(mdPath)
+	if err != nil {
+		return err
 	}
-	return client.UploadFile(path, name, forceOverwrite)
-}
+	if note.Skip() {
+		log("Skipping %s (sync: false)", mdPath)
+		return nil
+	}
+	folder := noteFolder(mdPath, note)
 
-func convertAndUpload(client *remarkable.Client, converter *convert.Converter, mdPath string, parentUUID string) error {
-	log("Converting and uploading: %s", mdPath)
+	hash, err := state.HashFile(mdPath)
+	if err != nil {
+		return fmt.Errorf("failed to hash %s: %w", mdPath, err)
+	}
+	// tracked documents follow the note to the folder it now belongs in
+	if mirrorVault || note.Folder != "" {
+		if moved, err := planMirror(client, store, folders, p, mdPath, hash, folder); err != nil || moved {
+			return err
+		}
+	}
+	render, err := converter.RenderHash(mdPath)
+	if err != nil {
+		return err
+	}
+	if isUnchanged(client, store, mdPath, hash, render) {
+		log("Unchanged: %s", mdPath)
+		return nil
+	}
+
+	log("Converting: %s", mdPath)
 
 	// convert to pdf
 	pdfPath, err := converter.MarkdownToPDF(mdPath)
@@ -501,10 +635,9 @@ func convertAndUpload(client *remarkable.Client, converter *convert.Converter, m
 		return fmt.Errorf("conversion failed: %w", err)
 	}
 
-	// send to remarkable
-	name := strings.TrimSuffix(filepath.Base(mdPath), filepath.Ext(mdPath))
-	if parentUUID != "" {
-		return client.UploadFile(pdfPath, name, forceOverwrite, parentUUID)
+	parentUUID, err := folders.resolve(folder)
+	if err != nil {
+		return err
 	}
-	return client.UploadFile(pdfPath, name, forceOverwrite)
+	return planPush(client, store, p, mdPath, hash, render, pdfPath, parentUUID, true)
 }
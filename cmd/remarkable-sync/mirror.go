@@ -0,0 +1,169 @@
+package main
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"remarkable-sync/internal/convert"
+	"remarkable-sync/internal/plan"
+	"remarkable-sync/internal/remarkable"
+	"remarkable-sync/internal/state"
+)
+
+// noteFolder returns the tablet folder path a note goes to: the folder in its
+// frontmatter, or with --mirror its directory in the vault under --folder
+func noteFolder(notePath string, note convert.NoteOptions) string {
+	if note.Folder != "" {
+		return note.Folder
+	}
+	if !mirrorVault {
+		return folderName
+	}
+	rel, err := filepath.Rel(absPath(obsidianVault), filepath.Dir(absPath(notePath)))
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return folderName
+	}
+	return path.Join(folderName, filepath.ToSlash(rel))
+}
+
+// findMoved returns the entry of a tracked note that moved to notePath: same file name
+// and content, and nothing left at the old path
+func findMoved(store *state.Store, notePath, hash string) *state.Entry {
+	notePath = absPath(notePath)
+	for _, entry := range store.Entries() {
+		if entry.Path == notePath || entry.ContentHash != hash || filepath.Base(entry.Path) != filepath.Base(notePath) {
+			continue
+		}
+		if _, err := os.Stat(entry.Path); os.IsNotExist(err) {
+			return entry
+		}
+	}
+	return nil
+}
+
+// planMirror keeps a note's document in the folder it belongs in
+// it reports whether the note was handled as a move, which leaves nothing else to do
+func planMirror(client *remarkable.Client, store *state.Store, folders *folderPlanner, p *plan.Plan, notePath, hash, folder string) (bool, error) {
+	moved := ""
+	entry, ok := store.Get(notePath)
+	if !ok {
+		if entry = findMoved(store, notePath, hash); entry == nil {
+			return false, nil
+		}
+		moved = entry.Path
+	}
+
+	metadata, err := client.GetMetadata(entry.UUID)
+	if err != nil {
+		return false, err
+	}
+	if metadata == nil || metadata.Parent == "trash" {
+		return false, nil
+	}
+
+	parent, err := folders.resolve(folder)
+	if err != nil {
+		return false, err
+	}
+	if parent != metadata.Parent || moved != "" {
+		planMove(p, entry.UUID, metadata, parent, folder, absPath(notePath), moved)
+	}
+	return moved != "", nil
+}
+
+func planMove(p *plan.Plan, id string, metadata *remarkable.Metadata, parent, folder, notePath, moved string) {
+	p.Add(&plan.Operation{
+		Kind:   plan.MoveDocument,
+		UUID:   id,
+		Name:   metadata.VisibleName,
+		Parent: parent,
+		Folder: folder,
+		Note:   notePath,
+		Moved:  moved,
+		Expect: &plan.Expect{Version: metadata.Version, LastModified: metadata.LastModified},
+	})
+}
+
+// planPrune deletes folders under --folder that this plan empties by moving documents
+// out of them, once their directory is gone from the vault
+func planPrune(client *remarkable.Client, p *plan.Plan) error {
+	index, err := client.Index()
+	if err != nil {
+		return err
+	}
+	root, err := client.FindFolderUUID(folderName)
+	if err != nil || (root == "" && folderName != "") {
+		return err
+	}
+
+	leaving := map[string]bool{} // uuids moved or deleted by the plan
+	filled := map[string]bool{}  // folders the plan puts something into
+	var vacated []string
+	for _, op := range p.Operations {
+		switch op.Kind {
+		case plan.MoveDocument:
+			if info, ok := index.Lookup(op.UUID); ok {
+				vacated = append(vacated, info.Parent)
+			}
+			leaving[op.UUID] = true
+			filled[op.Parent] = true
+		case plan.DeleteDocument:
+			leaving[op.UUID] = true
+		case plan.CreateDocument, plan.CreateFolder:
+			filled[op.Parent] = true
+		}
+	}
+
+	var prune func(id string)
+	prune = func(id string) {
+		if id == root || id == "trash" || leaving[id] || filled[id] {
+			return
+		}
+		info, ok := index.Lookup(id)
+		if !ok || !info.Folder {
+			return
+		}
+		rel, ok := folderUnder(index, id, root)
+		if !ok {
+			return
+		}
+		if st, err := os.Stat(filepath.Join(obsidianVault, filepath.FromSlash(rel))); err == nil && st.IsDir() {
+			return
+		}
+		for _, child := range index.Children(id) {
+			if !leaving[child.UUID] {
+				return
+			}
+		}
+
+		p.Add(&plan.Operation{
+			Kind:   plan.DeleteDocument,
+			UUID:   id,
+			Name:   path.Join(folderName, rel),
+			Expect: &plan.Expect{Version: info.Version, LastModified: info.LastModified},
+		})
+		leaving[id] = true
+		prune(info.Parent)
+	}
+
+	for _, id := range vacated {
+		prune(id)
+	}
+	return nil
+}
+
+// folderUnder returns the path of folder id below root, or false when it isn't inside root
+func folderUnder(index *remarkable.Index, id, root string) (string, bool) {
+	var names []string
+	for id != root {
+		info, ok := index.Lookup(id)
+		if !ok || id == "" {
+			return "", false
+		}
+		names = append([]string{info.Name}, names...)
+		id = info.Parent
+	}
+	return path.Join(names...), true
+}
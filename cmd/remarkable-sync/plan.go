@@ -0,0 +1,275 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"remarkable-sync/internal/convert"
+	"remarkable-sync/internal/plan"
+	"remarkable-sync/internal/remarkable"
+	"remarkable-sync/internal/state"
+
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+)
+
+func newApplyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "apply [plan.json]",
+		Short: "Apply a plan saved with --save-plan",
+		Long:  `Apply a plan saved with --save-plan. Nothing is changed if the reMarkable has drifted from what the plan assumed.`,
+		Args:  cobra.ExactArgs(1),
+		RunE:  applyHandler,
+	}
+	return cmd
+}
+
+func applyHandler(cmd *cobra.Command, args []string) error {
+	p, err := plan.Load(args[0])
+	if err != nil {
+		return err
+	}
+
+	client, err := newClient(p.Dir)
+	if err != nil {
+		return fmt.Errorf("failed to connect to reMarkable: %w", err)
+	}
+	defer client.Close()
+
+	if !quiet {
+		p.Print(os.Stdout)
+	}
+	if err := p.Apply(client, log); err != nil {
+		return err
+	}
+
+	log("✓ Applied %d operation(s)", len(p.Operations))
+	return nil
+}
+
+func newPlan(command string) *plan.Plan {
+	p := plan.New(command, remarkableDir, statePath)
+	p.Markdown = getMarkdownOptions()
+	return p
+}
+
+// runPlan prints a plan and then saves it (--save-plan), stops (--dry-run) or applies it
+// a non-empty confirm message asks before applying unless --force is set
+func runPlan(client *remarkable.Client, p *plan.Plan, confirm string) error {
+	if restartXochitl {
+		p.WrapService()
+	}
+
+	if !quiet {
+		p.Print(os.Stdout)
+	}
+
+	if savePlanPath != "" {
+		if err := p.Save(savePlanPath); err != nil {
+			return err
+		}
+		log("Plan saved to %s (apply with: remarkable-sync apply %s)", savePlanPath, savePlanPath)
+		return nil
+	}
+
+	if dryRun {
+		log("DRY RUN: nothing was changed.")
+		return nil
+	}
+
+	if p.Empty() {
+		return nil
+	}
+
+	if confirm != "" && !forceOverwrite {
+		fmt.Printf("\n%s [y/N]: ", confirm)
+		var response string
+		fmt.Scanln(&response)
+		response = strings.ToLower(strings.TrimSpace(response))
+		if response != "y" && response != "yes" {
+			log("Cancelled.")
+			return nil
+		}
+	}
+
+	return p.Apply(client, log)
+}
+
+// folderPlanner resolves tablet folder paths, adding create-folder operations for
+// the parts that don't exist yet; folders it already planned are reused
+type folderPlanner struct {
+	client  *remarkable.Client
+	plan    *plan.Plan
+	planned map[string]string // folder path -> uuid
+}
+
+func newFolderPlanner(client *remarkable.Client, p *plan.Plan) *folderPlanner {
+	return &folderPlanner{client: client, plan: p, planned: map[string]string{}}
+}
+
+// resolve returns the uuid of a folder path such as "Research/AI Papers", "" for the top level
+func (f *folderPlanner) resolve(folderPath string) (string, error) {
+	parent := ""
+	var walked []string
+	for _, name := range remarkable.SplitFolderPath(folderPath) {
+		folder := path.Join(walked...)
+		walked = append(walked, name)
+		key := path.Join(walked...)
+
+		if id, ok := f.planned[key]; ok {
+			parent = id
+			continue
+		}
+
+		id, err := f.client.FindChildFolder(parent, name)
+		if err != nil {
+			return "", fmt.Errorf("failed to find folder: %w", err)
+		}
+		if id == "" {
+			id = uuid.New().String()
+			f.plan.Add(&plan.Operation{
+				Kind:   plan.CreateFolder,
+				UUID:   id,
+				Name:   name,
+				Parent: parent,
+				Folder: folder,
+				Expect: &plan.Expect{Absent: true},
+			})
+		}
+		f.planned[key] = id
+		parent = id
+	}
+	return parent, nil
+}
+
+// isUnchanged reports whether the tablet already has the current version of sourcePath,
+// rendered as it would be now
+func isUnchanged(client *remarkable.Client, store *state.Store, sourcePath, hash, render string) bool {
+	if forceOverwrite {
+		return false
+	}
+	entry, ok := store.Get(sourcePath)
+	if !ok || entry.ContentHash != hash || entry.RenderHash != render {
+		return false
+	}
+	metadata, err := client.GetMetadata(entry.UUID)
+	return err == nil && metadata != nil && metadata.Parent != "trash"
+}
+
+// planPush adds the operations that put docPath on the tablet for sourcePath
+// the document recorded in the state store is overwritten in place so annotations survive
+func planPush(client *remarkable.Client, store *state.Store, p *plan.Plan, sourcePath, hash, render, docPath, parentUUID string, generated bool) error {
+	if entry, ok := store.Get(sourcePath); ok {
+		metadata, err := client.GetMetadata(entry.UUID)
+		if err != nil {
+			return err
+		}
+		if metadata != nil && metadata.Parent != "trash" {
+			docHash, err := state.HashFile(docPath)
+			if err != nil {
+				return fmt.Errorf("failed to hash %s: %w", docPath, err)
+			}
+
+			// the note changed but renders to the same document
+			if docHash == entry.PDFHash && !forceOverwrite {
+				p.Add(&plan.Operation{Kind: plan.RecordEntry, Note: sourcePath, Hash: hash, Render: render})
+				return nil
+			}
+
+			p.Add(&plan.Operation{
+				Kind:      plan.OverwriteDocument,
+				UUID:      entry.UUID,
+				Name:      metadata.VisibleName,
+				Source:    docPath,
+				Generated: generated,
+				Note:      sourcePath,
+				Hash:      hash,
+				Render:    render,
+				Expect:    &plan.Expect{Version: metadata.Version, LastModified: metadata.LastModified},
+			})
+			return nil
+		}
+	}
+
+	name := documentName(sourcePath)
+	if other := plannedName(p, parentUUID, name); other != "" {
+		return fmt.Errorf("'%s' would go to the same folder as %s", name, other)
+	}
+	existing, err := client.FindInFolder(parentUUID, name)
+	if err != nil {
+		return fmt.Errorf("failed to check if file exists: %w", err)
+	}
+
+	var expect *plan.Expect
+	if len(existing) == 0 {
+		expect = &plan.Expect{Absent: true}
+	} else if !forceOverwrite {
+		return fmt.Errorf("file '%s' already exists on reMarkable (use --force to overwrite)", name)
+	}
+	// with --force, replaces only the documents of that name in the same folder
+	planDeletes(store, p, existing)
+
+	p.Add(&plan.Operation{
+		Kind:      plan.CreateDocument,
+		UUID:      uuid.New().String(),
+		Name:      name,
+		Parent:    parentUUID,
+		Source:    docPath,
+		Generated: generated,
+		Note:      sourcePath,
+		Hash:      hash,
+		Render:    render,
+		Expect:    expect,
+	})
+	return nil
+}
+
+// documentName is the visible name of a file's document, its name without the extension
+// but for code and config files, so main.go and main.py or config.yml and config.json
+// stay apart
+func documentName(sourcePath string) string {
+	if convert.IsSource(sourcePath) {
+		return filepath.Base(sourcePath)
+	}
+	return strings.TrimSuffix(filepath.Base(sourcePath), filepath.Ext(sourcePath))
+}
+
+// plannedName returns the file of a document the plan already creates or moves into
+// parentUUID under name, "" when there's none
+func plannedName(p *plan.Plan, parentUUID, name string) string {
+	for _, op := range p.Operations {
+		if (op.Kind == plan.CreateDocument || op.Kind == plan.MoveDocument) && op.Parent == parentUUID && op.Name == name {
+			if op.Note != "" {
+				return op.Note
+			}
+			return op.Source
+		}
+	}
+	return ""
+}
+
+// planDeletes adds delete operations for files and forgets any state entries pointing at them
+func planDeletes(store *state.Store, p *plan.Plan, files []remarkable.FileInfo) {
+	deleted := map[string]bool{}
+	for _, file := range files {
+		p.Add(&plan.Operation{
+			Kind:   plan.DeleteDocument,
+			UUID:   file.UUID,
+			Name:   file.Name,
+			Expect: &plan.Expect{Version: file.Version, LastModified: file.LastModified},
+		})
+		deleted[file.UUID] = true
+	}
+
+	if store == nil {
+		return
+	}
+	for _, entry := range store.Entries() {
+		if deleted[entry.UUID] {
+			p.Add(&plan.Operation{Kind: plan.ForgetEntry, Note: entry.Path})
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"remarkable-sync/internal/convert"
+	"remarkable-sync/internal/plan"
+	"remarkable-sync/internal/remarkable"
+	"remarkable-sync/internal/state"
+)
+
+// testEnv is a vault and an empty in-memory tablet the commands are pointed at
+type testEnv struct {
+	vault     string
+	client    *remarkable.Client
+	converter *convert.Converter
+	store     *state.Store
+	plan      *plan.Plan
+	folders   *folderPlanner
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	obsidianVault, folderName, mirrorVault, forceOverwrite, quiet = t.TempDir(), "", false, false, true
+	remarkableDir, statePath = "/xochitl", filepath.Join(t.TempDir(), "state.json")
+
+	converter, err := convert.NewConverter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { converter.Close() })
+	converter.SetVault(obsidianVault)
+	store, err := state.Open(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := &testEnv{
+		vault:     obsidianVault,
+		client:    remarkable.NewDeviceClient(remarkable.NewMemDevice()),
+		converter: converter,
+		store:     store,
+	}
+	env.newPlan()
+	return env
+}
+
+// newPlan starts a plan for another run, with the state the last one left
+func (env *testEnv) newPlan() {
+	env.plan = newPlan("obsidian")
+	env.folders = newFolderPlanner(env.client, env.plan)
+	if store, err := state.Open(statePath); err == nil {
+		env.store = store
+	}
+}
+
+// write creates a file in the vault and returns its path
+func (env *testEnv) write(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(env.vault, filepath.FromSlash(name))
+	os.MkdirAll(filepath.Dir(path), 0755)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func (env *testEnv) apply(t *testing.T) {
+	t.Helper()
+	if err := env.plan.Apply(env.client, t.Logf); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConvertSameNames(t *testing.T) {
+	env := newTestEnv(t)
+	mirrorVault = true
+	notes := []string{env.write(t, "a/README.md", "# Alpha\n"), env.write(t, "b/README.md", "# Beta\n")}
+	for _, note := range notes {
+		if err := planConvert(env.client, env.converter, env.store, env.folders, env.plan, note); err != nil {
+			t.Fatal(err)
+		}
+	}
+	env.apply(t)
+
+	// each document is the pdf of its own note
+	store, err := state.Open(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashes := map[string]bool{}
+	for _, note := range notes {
+		entry, ok := store.Get(note)
+		if !ok {
+			t.Fatalf("%s not tracked", note)
+		}
+		hash, err := env.client.FileHash(entry.UUID)
+		if err != nil || hash != entry.PDFHash {
+			t.Errorf("%s: tablet has %s, state %s (%v)", note, hash, entry.PDFHash, err)
+		}
+		hashes[hash] = true
+	}
+	if len(hashes) != 2 {
+		t.Error("both notes uploaded the same pdf")
+	}
+}
+
+func TestConvertSameNameElsewhere(t *testing.T) {
+	for _, force := range []bool{false, true} {
+		env := newTestEnv(t)
+		mirrorVault = true
+		notes := []string{env.write(t, "a/README.md", "# Alpha\n"), env.write(t, "b/README.md", "# Beta\n")}
+		for _, note := range notes {
+			if err := planConvert(env.client, env.converter, env.store, env.folders, env.plan, note); err != nil {
+				t.Fatal(err)
+			}
+		}
+		env.apply(t)
+
+		// a README in another folder is neither a clash nor replaced by --force
+		forceOverwrite = force
+		env.newPlan()
+		third := env.write(t, "c/README.md", "# Gamma\n")
+		if err := planConvert(env.client, env.converter, env.store, env.folders, env.plan, third); err != nil {
+			t.Fatalf("force=%v: %v", force, err)
+		}
+		for _, op := range env.plan.Operations {
+			if op.Kind == plan.DeleteDocument || op.Kind == plan.ForgetEntry {
+				t.Errorf("force=%v: planned %s of %s", force, op.Kind, op.UUID)
+			}
+		}
+		env.apply(t)
+		files, err := env.client.FindByName("README")
+		if err != nil || len(files) != 3 {
+			t.Errorf("force=%v: tablet has %d READMEs, want 3 (%v)", force, len(files), err)
+		}
+	}
+}
+
+func TestConvertNameClash(t *testing.T) {
+	env := newTestEnv(t)
+	first := env.write(t, "a/README.md", "# Alpha\n")
+	second := env.write(t, "b/README.md", "# Beta\n")
+
+	// without --mirror both would be README in the same folder
+	if err := planConvert(env.client, env.converter, env.store, env.folders, env.plan, first); err != nil {
+		t.Fatal(err)
+	}
+	if err := planConvert(env.client, env.converter, env.store, env.folders, env.plan, second); err == nil {
+		t.Error("second README planned into the same folder")
+	}
+	if n := len(env.plan.Operations); n != 1 {
+		t.Errorf("got %d operations, want 1", n)
+	}
+}
+
+func TestSourceNames(t *testing.T) {
+	env := newTestEnv(t)
+	for _, name := range []string{"main.go", "main.py", "config.yml", "config.json", "main.md"} {
+		path := env.write(t, name, "x: 1\n")
+		if err := planConvert(env.client, env.converter, env.store, env.folders, env.plan, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	env.apply(t)
+
+	files, err := env.client.ListFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]bool{}
+	for _, file := range files {
+		names[file.Name] = true
+	}
+	for _, want := range []string{"main.go", "main.py", "config.yml", "config.json", "main"} {
+		if !names[want] {
+			t.Errorf("no document named %s in %v", want, names)
+		}
+	}
+}
+
+func TestConvertOptionsChanged(t *testing.T) {
+	env := newTestEnv(t)
+	note := env.write(t, "note.md", "# Note\n")
+	convertNote := func() {
+		t.Helper()
+		env.newPlan()
+		if err := planConvert(env.client, env.converter, env.store, env.folders, env.plan, note); err != nil {
+			t.Fatal(err)
+		}
+	}
+	convertNote()
+	env.apply(t)
+
+	convertNote()
+	if n := len(env.plan.Operations); n != 0 {
+		t.Errorf("unchanged note planned %v", env.plan.Operations)
+	}
+
+	// the same note at another font size is a different document
+	options := convert.DefaultPDFOptions()
+	options.FontSize = 14
+	env.converter.SetOptions(options)
+	convertNote()
+	if n := env.plan.Count(plan.OverwriteDocument); n != 1 {
+		t.Fatalf("plan is %v", env.plan.Operations)
+	}
+	env.apply(t)
+
+	convertNote()
+	if n := len(env.plan.Operations); n != 0 {
+		t.Errorf("rerendered note planned %v", env.plan.Operations)
+	}
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"remarkable-sync/internal/convert"
+	"remarkable-sync/internal/plan"
+	"remarkable-sync/internal/remarkable"
+	"remarkable-sync/internal/state"
+
+	"github.com/spf13/cobra"
+)
+
+// tablet side of a conflict is written next to the note with this suffix
+const conflictSuffix = " (tablet conflict)"
+
+func newSyncCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "sync [files/directories...]",
+		Short: "Bidirectional sync between Obsidian vault and reMarkable",
+		Long: `Compare vault notes and tablet documents against the last sync and push, pull or skip each one.
+When both sides changed, the tablet copy is written next to the note as "<name>` + conflictSuffix + `.md"
+and neither side is overwritten; the next sync pushes the note once it has been reconciled.
+A note deleted from the vault sends its unchanged document to the tablet's trash, and a document
+deleted on the tablet sends its unchanged note to the vault's .trash. When most tracked documents
+are gone at once, as after a factory reset or with another tablet, sync asks first (--force to skip).`,
+		RunE: syncHandler,
+	}
+	cmd.Flags().StringVar(&obsidianVault, "vault", os.ExpandEnv("$HOME/notes"), "Path to Obsidian vault")
+	cmd.Flags().StringVar(&folderName, "folder", "", "Upload new notes to this folder, nested with / (creates if doesn't exist)")
+	cmd.Flags().BoolVar(&mirrorVault, "mirror", false, "Reproduce the vault's directories as folders under --folder")
+
+	addPDFFlags(cmd)
+	addMarkdownFlags(cmd)
+
+	return cmd
+}
+
+// syncItem is one note considered by sync
+type syncItem struct {
+	path     string
+	entry    *state.Entry         // nil for notes never synced
+	metadata *remarkable.Metadata // tablet copy, nil when it's gone
+	remote   state.Side
+	hash     string // empty when the note is gone
+	action   state.Action
+}
+
+func syncHandler(cmd *cobra.Command, args []string) error {
+	client, err := newClient(remarkableDir)
+	if err != nil {
+		return fmt.Errorf("failed to connect to remarkable: %w", err)
+	}
+	defer client.Close()
+
+	converter, err := convert.NewConverter()
+	if err != nil {
+		return fmt.Errorf("failed to create converter: %w", err)
+	}
+	defer converter.Close()
+
+	converter.SetOptions(getPDFOptions(cmd))
+	converter.SetVault(obsidianVault)
+	converter.SetLogger(log)
+
+	store, err := state.Open(statePath)
+	if err != nil {
+		return err
+	}
+
+	// sync provided paths or entire vault
+	roots := args
+	if len(roots) == 0 {
+		roots = []string{obsidianVault}
+	}
+
+	log("Comparing vault and reMarkable...")
+	items, err := collectSyncItems(client, converter, store, roots)
+	if err != nil {
+		return err
+	}
+
+	p := newPlan("sync")
+
+	// folders from --folder and --mirror are only created when something is pushed into them
+	folders := newFolderPlanner(client, p)
+
+	for _, item := range items {
+		if err := planSyncItem(client, converter, store, folders, p, item); err != nil {
+			log("warning: %s: %v", item.path, err)
+		}
+	}
+
+	if mirrorVault {
+		if err := planPrune(client, p); err != nil {
+			log("warning: %v", err)
+		}
+	}
+
+	log("%d to create, %d to overwrite, %d to pull, %d to trash, %d conflicts",
+		p.Count(plan.CreateDocument), p.Count(plan.OverwriteDocument),
+		p.Count(plan.PullDocument), trashed(p), p.Count(plan.PullConflict))
+
+	return runPlan(client, p, trashConfirm(items))
+}
+
+// trashConfirm asks before trashing notes when most tracked documents vanished at once,
+// which is more likely a reset or different tablet than deletions
+func trashConfirm(items []*syncItem) string {
+	tracked, gone := 0, 0
+	for _, item := range items {
+		if item.entry == nil {
+			continue
+		}
+		tracked++
+		if item.action == state.DeleteLocal {
+			gone++
+		}
+	}
+	if gone < 2 || gone*2 <= tracked {
+		return ""
+	}
+	return fmt.Sprintf("%d of %d synced documents are gone from this reMarkable. Move their notes to the vault's .trash?", gone, tracked)
+}
+
+// collectSyncItems pairs local notes under roots with their state entries and decides an action for each
+func collectSyncItems(client *remarkable.Client, converter *convert.Converter, store *state.Store, roots []string) ([]*syncItem, error) {
+	notes := map[string]bool{}
+	for _, root := range roots {
+		err := processFiles(root, func(filePath string) error {
+			if isSyncableNote(filePath) {
+				notes[absPath(filePath)] = true
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var items []*syncItem
+	for _, entry := range store.Entries() {
+		if !isSyncableNote(entry.Path) || !inRoots(entry.Path, roots) {
+			continue
+		}
+		items = append(items, &syncItem{path: entry.Path, entry: entry})
+		delete(notes, entry.Path)
+	}
+	for path := range notes {
+		items = append(items, &syncItem{path: path})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].path < items[j].path
+	})
+
+	for _, item := range items {
+		local := state.Side{}
+		if hash, err := state.HashFile(item.path); err == nil {
+			item.hash = hash
+			local.Exists = true
+		}
+
+		// notes never synced before are simply new
+		if item.entry == nil {
+			item.action = state.Push
+			continue
+		}
+		local.Changed = local.Exists && item.hash != item.entry.ContentHash
+		if local.Exists && !local.Changed {
+			// new options or embeds change the pdf as much as an edit does
+			render, err := converter.RenderHash(item.path)
+			local.Changed = err != nil || render != item.entry.RenderHash
+		}
+
+		remote, metadata, err := remoteSide(client, item.entry)
+		if err != nil {
+			return nil, err
+		}
+		item.metadata = metadata
+		item.remote = remote
+		item.action = state.Decide(local, remote)
+	}
+
+	if mirrorVault {
+		items = pairMoves(store, items)
+	}
+
+	return items, nil
+}
+
+// pairMoves turns a new note and the vanished tracked note it was moved from into
+// one item, so the document follows the note instead of being pulled back to the old path
+func pairMoves(store *state.Store, items []*syncItem) []*syncItem {
+	byPath := map[string]*syncItem{}
+	for _, item := range items {
+		byPath[item.path] = item
+	}
+
+	gone := map[*syncItem]bool{}
+	for _, item := range items {
+		if item.entry != nil || item.hash == "" {
+			continue
+		}
+		entry := findMoved(store, item.path, item.hash)
+		if entry == nil {
+			continue
+		}
+		// a pdf changed on the tablet still needs pulling into the note
+		old := byPath[entry.Path]
+		if old == nil || gone[old] || old.metadata == nil || old.remote.Changed {
+			continue
+		}
+		item.entry = entry
+		item.metadata = old.metadata
+		item.remote = old.remote
+		item.action = state.Skip
+		gone[old] = true
+	}
+
+	kept := items[:0]
+	for _, item := range items {
+		if !gone[item] {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
+
+// remoteSide compares the tablet copy of a document with the entry's baseline
+func remoteSide(client *remarkable.Client, entry *state.Entry) (state.Side, *remarkable.Metadata, error) {
+	metadata, err := client.GetMetadata(entry.UUID)
+	if err != nil {
+		return state.Side{}, nil, err
+	}
+	if metadata == nil || metadata.Parent == "trash" {
+		return state.Side{}, nil, nil
+	}
+
+	side := state.Side{Exists: true}
+	if entry.RemoteChanged(metadata.Version, metadata.LastModified) {
+		// annotating bumps the metadata too, only a different pdf is new content
+		hash, err := client.FileHash(entry.UUID)
+		if err != nil {
+			return side, metadata, err
+		}
+		side.Changed = hash != entry.PDFHash
+	}
+	return side, metadata, nil
+}
+
+func planSyncItem(client *remarkable.Client, converter *convert.Converter, store *state.Store, folders *folderPlanner, p *plan.Plan, item *syncItem) error {
+	var note convert.NoteOptions
+	if item.hash != "" {
+		var err error
+		if note, err = convert.ReadNoteOptions(item.path); err != nil {
+			return err
+		}
+		if note.Skip() {
+			log("Skipping %s (sync: false)", item.path)
+			return nil
+		}
+	}
+	folder := noteFolder(item.path, note)
+
+	if (mirrorVault || note.Folder != "") && item.entry != nil && item.hash != "" {
+		if moved, err := planMirror(client, store, folders, p, item.path, item.hash, folder); err != nil || moved {
+			return err
+		}
+	}
+
+	switch item.action {
+	case state.Push:
+		render, err := converter.RenderHash(item.path)
+		if err != nil {
+			return err
+		}
+		pdfPath, err := converter.MarkdownToPDF(item.path)
+		if err != nil {
+			return fmt.Errorf("conversion failed: %w", err)
+		}
+		parentUUID, err := folders.resolve(folder)
+		if err != nil {
+			return err
+		}
+		return planPush(client, store, p, item.path, item.hash, render, pdfPath, parentUUID, true)
+
+	case state.Pull, state.Conflict:
+		op := &plan.Operation{
+			Kind:   plan.PullDocument,
+			UUID:   item.entry.UUID,
+			Name:   item.metadata.VisibleName,
+			Target: item.path,
+			Note:   item.path,
+			Expect: &plan.Expect{Version: item.metadata.Version, LastModified: item.metadata.LastModified},
+		}
+		if item.action == state.Conflict {
+			op.Kind = plan.PullConflict
+			op.Target = strings.TrimSuffix(item.path, filepath.Ext(item.path)) + conflictSuffix + ".md"
+		}
+		p.Add(op)
+
+	case state.Skip:
+		// annotation-only changes move the baseline forward
+		if item.metadata != nil && item.entry.RemoteChanged(item.metadata.Version, item.metadata.LastModified) {
+			p.Add(&plan.Operation{Kind: plan.RecordEntry, Note: item.path})
+		}
+
+	case state.DeleteRemote:
+		// the tablet's trash keeps the document and its annotations until it's emptied
+		p.Add(&plan.Operation{
+			Kind:   plan.MoveDocument,
+			UUID:   item.entry.UUID,
+			Name:   item.metadata.VisibleName,
+			Parent: "trash",
+			Folder: "trash",
+			Expect: &plan.Expect{Version: item.metadata.Version, LastModified: item.metadata.LastModified},
+		})
+		p.Add(&plan.Operation{Kind: plan.ForgetEntry, Note: item.path})
+
+	case state.DeleteLocal:
+		p.Add(&plan.Operation{
+			Kind:   plan.TrashNote,
+			Note:   item.path,
+			Hash:   item.hash,
+			Target: filepath.Join(absPath(obsidianVault), ".trash", filepath.Base(item.path)),
+		})
+
+	case state.Forget:
+		p.Add(&plan.Operation{Kind: plan.ForgetEntry, Note: item.path})
+	}
+
+	return nil
+}
+
+// trashed counts the notes and documents a plan moves to trash
+func trashed(p *plan.Plan) int {
+	n := p.Count(plan.TrashNote)
+	for _, op := range p.Operations {
+		if op.Kind == plan.MoveDocument && op.Parent == "trash" {
+			n++
+		}
+	}
+	return n
+}
+
+func isSyncableNote(path string) bool {
+	return strings.HasSuffix(path, ".md") &&
+		!strings.HasSuffix(path, conflictSuffix+".md")
+}
+
+func inRoots(path string, roots []string) bool {
+	for _, root := range roots {
+		root = absPath(root)
+		if path == root || strings.HasPrefix(path, root+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
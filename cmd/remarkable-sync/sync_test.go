@@ -0,0 +1,132 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"remarkable-sync/internal/convert"
+	"remarkable-sync/internal/plan"
+	"remarkable-sync/internal/state"
+)
+
+// sync plans a whole-vault sync into env.plan, as the command does before printing it
+func (env *testEnv) sync(t *testing.T) {
+	t.Helper()
+	items, err := collectSyncItems(env.client, env.converter, env.store, []string{env.vault})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range items {
+		if err := planSyncItem(env.client, env.converter, env.store, env.folders, env.plan, item); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSyncDeletions(t *testing.T) {
+	env := newTestEnv(t)
+	kept := env.write(t, "kept.md", "# Kept\n")
+	dropped := env.write(t, "dropped.md", "# Dropped\n")
+	env.sync(t)
+	env.apply(t)
+	env.newPlan()
+	keptEntry, _ := env.store.Get(kept)
+	droppedEntry, _ := env.store.Get(dropped)
+
+	// deleted in the vault, and on the tablet
+	if err := os.Remove(dropped); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.client.RemoveFile(keptEntry.UUID); err != nil {
+		t.Fatal(err)
+	}
+	env.sync(t)
+	if n := trashed(env.plan); n != 2 {
+		t.Errorf("%d to trash, want 2: %v", n, env.plan.Operations)
+	}
+	env.apply(t)
+
+	metadata, err := env.client.GetMetadata(droppedEntry.UUID)
+	if err != nil || metadata == nil || metadata.Parent != "trash" {
+		t.Errorf("tablet copy of dropped is %+v, %v", metadata, err)
+	}
+	if _, err := os.Stat(kept); !os.IsNotExist(err) {
+		t.Errorf("kept is still in the vault: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(env.vault, ".trash", "kept.md")); err != nil {
+		t.Error(err)
+	}
+	env.newPlan()
+	if entries := env.store.Entries(); len(entries) != 0 {
+		t.Errorf("still tracking %v", entries)
+	}
+}
+
+func TestSyncDeletionLosesToChange(t *testing.T) {
+	env := newTestEnv(t)
+	note := env.write(t, "note.md", "# Note\n")
+	env.sync(t)
+	env.apply(t)
+	env.newPlan()
+	entry, _ := env.store.Get(note)
+
+	// gone from the tablet after being edited in the vault, so it goes back
+	env.write(t, "note.md", "# Note\n\nMore\n")
+	if err := env.client.RemoveFile(entry.UUID); err != nil {
+		t.Fatal(err)
+	}
+	env.sync(t)
+	if n := env.plan.Count(plan.CreateDocument); n != 1 || trashed(env.plan) != 0 {
+		t.Errorf("plan is %v", env.plan.Operations)
+	}
+}
+
+func TestSyncOptionsChanged(t *testing.T) {
+	env := newTestEnv(t)
+	note := env.write(t, "note.md", "# Note\n")
+	env.sync(t)
+	env.apply(t)
+	env.newPlan()
+	env.sync(t)
+	if !env.plan.Empty() {
+		t.Errorf("unchanged note planned %v", env.plan.Operations)
+	}
+
+	// same note, different pdf
+	options := convert.DefaultPDFOptions()
+	options.FontSize++
+	env.converter.SetOptions(options)
+	env.newPlan()
+	env.sync(t)
+	if n := env.plan.Count(plan.OverwriteDocument); n != 1 {
+		t.Errorf("%s: %d to overwrite, want 1: %v", note, n, env.plan.Operations)
+	}
+}
+
+func TestTrashConfirm(t *testing.T) {
+	items := func(actions ...state.Action) []*syncItem {
+		var list []*syncItem
+		for _, action := range actions {
+			list = append(list, &syncItem{entry: &state.Entry{}, action: action})
+		}
+		// new notes aren't tracked documents
+		return append(list, &syncItem{action: state.Push})
+	}
+	tests := []struct {
+		name  string
+		items []*syncItem
+		ask   bool
+	}{
+		{"one deleted", items(state.DeleteLocal, state.Skip, state.Skip), false},
+		{"only note deleted", items(state.DeleteLocal), false},
+		{"half deleted", items(state.DeleteLocal, state.DeleteLocal, state.Skip, state.Pull), false},
+		{"most deleted", items(state.DeleteLocal, state.DeleteLocal, state.Skip), true},
+		{"tablet reset", items(state.DeleteLocal, state.DeleteLocal, state.DeleteLocal), true},
+	}
+	for _, tt := range tests {
+		if got := trashConfirm(tt.items) != ""; got != tt.ask {
+			t.Errorf("%s: asks %v, want %v", tt.name, got, tt.ask)
+		}
+	}
+}
@@ -3,16 +3,26 @@ module remarkable-sync
 go 1.24
 
 require (
+	github.com/alecthomas/chroma/v2 v2.23.1
 	github.com/google/uuid v1.5.0
 	github.com/jung-kurt/gofpdf v1.16.2
+	github.com/kevinburke/ssh_config v1.2.0
 	github.com/ledongthuc/pdf v0.0.0-20220302134840-0c2507a12d80
 	github.com/spf13/cobra v1.8.0
 	github.com/yuin/goldmark v1.7.13
+	github.com/zalando/go-keyring v0.2.3
 	golang.org/x/crypto v0.17.0
+	golang.org/x/image v0.25.0
+	golang.org/x/term v0.15.0
+	golang.org/x/text v0.23.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
+	github.com/alessio/shellescape v1.4.1 // indirect
+	github.com/danieljoos/wincred v1.2.0 // indirect
+	github.com/dlclark/regexp2 v1.11.5 // indirect
+	github.com/godbus/dbus/v5 v5.1.0 // indirect
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
 	golang.org/x/sys v0.35.0 // indirect
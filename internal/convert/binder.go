@@ -0,0 +1,320 @@
+package convert
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+	"github.com/yuin/goldmark/ast"
+)
+
+// boundNote is a note of a binder
+type boundNote struct {
+	path    string
+	content []byte
+	doc     ast.Node
+	toc     *tableOfContents // its headings, a level below the note's own entry
+	entry   *tocEntry        // the note in the outline and contents
+	titled  bool             // entry is its first heading
+}
+
+// opensWith reports whether a note's only top level heading is its first one, titled title
+func opensWith(toc *tableOfContents, title string) bool {
+	if len(toc.entries) == 0 || !strings.EqualFold(toc.entries[0].title, title) {
+		return false
+	}
+	for _, entry := range toc.entries[1:] {
+		if entry.depth == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// OrderNotes sorts the notes going into a binder by order: "name" for their file names,
+// "order" for the order in their frontmatter, the notes without one last, or else the MOC
+// note whose links give the order, the notes it doesn't link to following by name
+// the MOC itself is left out
+func (c *Converter) OrderNotes(notes []string, order string) ([]string, error) {
+	sorted := append([]string(nil), notes...)
+	byName := func(a, b string) bool {
+		if na, nb := strings.ToLower(filepath.Base(a)), strings.ToLower(filepath.Base(b)); na != nb {
+			return na < nb
+		}
+		return a < b
+	}
+
+	switch order {
+	case "", "name":
+		sort.SliceStable(sorted, func(i, j int) bool { return byName(sorted[i], sorted[j]) })
+		return sorted, nil
+
+	case "order":
+		rank := map[string]float64{}
+		for _, path := range sorted {
+			note, err := ReadNoteOptions(path)
+			if err != nil {
+				return nil, err
+			}
+			if note.Order != nil {
+				rank[path] = *note.Order
+			}
+		}
+		sort.SliceStable(sorted, func(i, j int) bool {
+			a, aok := rank[sorted[i]]
+			b, bok := rank[sorted[j]]
+			if aok != bok || aok && a != b {
+				return aok && (!bok || a < b)
+			}
+			return byName(sorted[i], sorted[j])
+		})
+		return sorted, nil
+	}
+
+	if c.vault == nil {
+		c.vault = &vault{}
+	}
+	// a path to the MOC, or its name in the vault
+	moc := order
+	if st, err := os.Stat(moc); err != nil || st.IsDir() {
+		var ok bool
+		if moc, ok = c.vault.resolve(order, ""); !ok {
+			return nil, fmt.Errorf("MOC note %s not found", order)
+		}
+	}
+	links, err := c.mocLinks(moc)
+	if err != nil {
+		return nil, err
+	}
+	rank := map[string]int{}
+	for i, link := range links {
+		if _, seen := rank[link]; !seen {
+			rank[link] = i
+		}
+	}
+
+	var kept []string
+	for _, path := range sorted {
+		if absPath(path) != absPath(moc) {
+			kept = append(kept, path)
+		}
+	}
+	sort.SliceStable(kept, func(i, j int) bool {
+		a, aok := rank[absPath(kept[i])]
+		b, bok := rank[absPath(kept[j])]
+		if aok != bok || aok && a != b {
+			return aok && (!bok || a < b)
+		}
+		return byName(kept[i], kept[j])
+	})
+	return kept, nil
+}
+
+// mocLinks returns the notes a MOC links to or embeds, in the order it does, as absolute paths
+func (c *Converter) mocLinks(moc string) ([]string, error) {
+	content, err := os.ReadFile(moc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read markdown: %w", err)
+	}
+	_, content, err = parseNoteOptions(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", moc, err)
+	}
+	content = stripComments(content)
+
+	var links []string
+	add := func(target string) {
+		if path, ok := c.vault.resolve(target, moc); ok && strings.EqualFold(filepath.Ext(path), ".md") {
+			links = append(links, absPath(path))
+		}
+	}
+	ast.Walk(parseMarkdown(content), func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := node.(type) {
+		case *WikiLink:
+			add(n.Target)
+		case *Embed:
+			add(n.Target)
+		case *ast.Link:
+			// [text](Other%20note.md), urls aside
+			if dest, err := url.PathUnescape(string(n.Destination)); err == nil && !strings.Contains(dest, "://") {
+				dest, _, _ = strings.Cut(dest, "#")
+				add(dest)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	return links, nil
+}
+
+// binder is the notes bound into one pdf, parsed once for both renders
+type binder struct {
+	info     noteInfo // the binder's title, and the date of its newest note as modified
+	notes    []*boundNote
+	contents *tableOfContents      // every note followed by its headings
+	bound    map[string]*boundNote // by absolute path, for links between them
+	newest   time.Time
+}
+
+// BindToPDF renders notes, in the order given, into one pdf titled title: a cover page,
+// the contents of all of them, then each note from a new page with an outline entry of its own
+// the notes share the command line options, their frontmatter only naming them
+func (c *Converter) BindToPDF(title string, notes []string) (string, error) {
+	b, err := c.loadBinder(title, notes)
+	if err != nil {
+		return "", err
+	}
+	pdfPath := filepath.Join(c.TempDir, strings.ReplaceAll(title, "/", "-")+".pdf")
+
+	options := c.options
+	options.Header, options.Footer = b.info.fillText(options.Header, options), b.info.fillText(options.Footer, options)
+	pdf := setupPDF(options)
+
+	// stamped with the newest note so an unchanged binder produces identical bytes
+	pdf.SetCreationDate(b.newest)
+	pdf.SetModificationDate(b.newest)
+	pdf.SetCatalogSort(true)
+
+	if err := c.processBinder(pdf, options, b); err != nil {
+		return "", err
+	}
+	if err := pdf.OutputFileAndClose(pdfPath); err != nil {
+		return "", fmt.Errorf("failed to create pdf: %w", err)
+	}
+	return pdfPath, nil
+}
+
+// loadBinder reads and parses the notes, their headings going a level below their own entries
+func (c *Converter) loadBinder(title string, notes []string) (*binder, error) {
+	if len(notes) == 0 {
+		return nil, fmt.Errorf("no notes to bind")
+	}
+	if c.vault == nil {
+		c.vault = &vault{}
+	}
+
+	b := &binder{contents: &tableOfContents{}, bound: map[string]*boundNote{}}
+	for _, path := range notes {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read markdown: %w", err)
+		}
+		note, content, err := parseNoteOptions(fontText(content, c.options))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if st, err := os.Stat(path); err == nil && st.ModTime().After(b.newest) {
+			b.newest = st.ModTime()
+		}
+
+		n := &boundNote{path: path, content: stripComments(content)}
+		n.doc = parseMarkdown(n.content)
+		n.toc = collectHeadings(n.doc, n.content)
+		if title := c.noteInfo(path, note).title; opensWith(n.toc, title) {
+			// a note opening with its title as a heading is listed once, by the heading
+			n.entry, n.titled = n.toc.entries[0], true
+		} else {
+			n.entry = &tocEntry{title: title}
+			b.contents.entries = append(b.contents.entries, n.entry)
+			for _, entry := range n.toc.entries {
+				entry.depth++
+			}
+		}
+		b.contents.entries = append(b.contents.entries, n.toc.entries...)
+		b.bound[absPath(path)] = n
+		b.notes = append(b.notes, n)
+	}
+	title = string(fontText([]byte(title), c.options))
+	b.info = noteInfo{title: title, path: title, date: c.today(), modified: b.newest.Format("2006-01-02")}
+	return b, nil
+}
+
+func (c *Converter) processBinder(pdf *gofpdf.Fpdf, options PDFOptions, b *binder) error {
+	b.contents.page = options.TOC
+	if b.contents.page {
+		// a first render finds the page numbers, as for a single note
+		if err := c.renderBinder(setupPDF(options), options, b); err != nil {
+			return err
+		}
+	}
+	return c.renderBinder(pdf, options, b)
+}
+
+func (c *Converter) renderBinder(pdf *gofpdf.Fpdf, options PDFOptions, b *binder) error {
+	b.contents.addLinks(pdf)
+	writeCover(pdf, options, b.info, len(b.notes))
+	if b.contents.page {
+		b.contents.write(pdf, options)
+	}
+
+	for i, note := range b.notes {
+		if i > 0 {
+			pdf.AddPage()
+		}
+		if !note.titled {
+			note.entry.page = pdf.PageNo()
+			pdf.SetLink(note.entry.link, -1, -1)
+			pdf.Bookmark(note.entry.title, 0, -1)
+		}
+		if err := c.renderNote(pdf, options, note.path, note.doc, note.content, note.toc, b.bound); err != nil {
+			return fmt.Errorf("%s: %w", note.path, err)
+		}
+	}
+	return nil
+}
+
+// writeCover fills the first page with the binder's title, how many notes it holds and
+// when the newest of them changed
+func writeCover(pdf *gofpdf.Fpdf, options PDFOptions, info noteInfo, notes int) {
+	_, pageH := pdf.GetPageSize()
+	pdf.SetY(pageH / 3)
+	pdf.SetFont(mainFamily, "B", options.FontSize+18)
+	pdf.MultiCell(0, 14, info.title, "", "C", false)
+
+	pdf.Ln(6)
+	pdf.SetFont(mainFamily, "", options.FontSize+2)
+	pdf.SetTextColor(120, 120, 120)
+	count := strconv.Itoa(notes) + " notes"
+	if notes == 1 {
+		count = "1 note"
+	}
+	pdf.CellFormat(0, 8, count, "", 1, "C", false, 0, "")
+	pdf.CellFormat(0, 8, info.modified, "", 1, "C", false, 0, "")
+	pdf.SetTextColor(0, 0, 0)
+
+	pdf.AddPage()
+}
+
+// boundNote returns the note of the binder a [[link]] points to, nil outside a binder
+func (r *pdfRenderer) boundNote(target string) *boundNote {
+	if r.bound == nil || target == "" {
+		return nil
+	}
+	path, ok := r.vault.resolve(target, r.notePath)
+	if !ok {
+		return nil
+	}
+	return r.bound[absPath(path)]
+}
+
+// startNoteLink makes the text that follows link to another note of the binder, or to one
+// of its headings
+func (r *pdfRenderer) startNoteLink(note *boundNote, fragment string) {
+	r.linkID = note.entry.link
+	if fragment != "" {
+		if link := note.toc.anchor(fragment); link != 0 {
+			r.linkID = link
+		}
+	}
+	if r.options.ColorLinks {
+		r.pdf.SetTextColor(0, 0, 255)
+	}
+}
@@ -0,0 +1,135 @@
+package convert
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeNotes creates notes under root, returning their paths in the order given
+func writeNotes(t *testing.T, root string, notes ...string) []string {
+	t.Helper()
+	var paths []string
+	for i := 0; i+1 < len(notes); i += 2 {
+		path := filepath.Join(root, notes[i])
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(notes[i+1]), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+func TestOrderNotes(t *testing.T) {
+	root := t.TempDir()
+	notes := writeNotes(t, root,
+		"c.md", "---\norder: 1\n---\n",
+		"B.md", "",
+		"sub/a.md", "---\norder: 2.5\n---\n",
+		"d.md", "---\norder: 0.5\n---\n",
+		"Index.md", "- [[c]]\n- ![[sub/a]]\n- [d](d.md)\n- [[c]] again\n- [[missing]]\n",
+	)
+	c := &Converter{vault: &vault{root: root}}
+	names := func(paths []string) string {
+		var names []string
+		for _, path := range paths {
+			names = append(names, strings.TrimSuffix(filepath.Base(path), ".md"))
+		}
+		return strings.Join(names, " ")
+	}
+
+	for _, tt := range []struct {
+		order string
+		want  string
+	}{
+		{"name", "a B c d Index"},
+		{"", "a B c d Index"},
+		{"order", "d c a B Index"},
+		{"Index", "c a d B"},
+		{filepath.Join(root, "Index.md"), "c a d B"},
+	} {
+		got, err := c.OrderNotes(notes, tt.order)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if names(got) != tt.want {
+			t.Errorf("order %s: got %s, want %s", tt.order, names(got), tt.want)
+		}
+	}
+
+	if _, err := c.OrderNotes(notes, "Nowhere"); err == nil {
+		t.Error("missing MOC accepted")
+	}
+}
+
+func TestBindToPDF(t *testing.T) {
+	root := t.TempDir()
+	notes := writeNotes(t, root,
+		"Goals.md", "---\ntitle: Project goals\n---\n# Why\n\nSee [[Plan#Milestones]] and [[Plan]].\n",
+		"Plan.md", "# Plan\n\n## Milestones\n\n"+strings.Repeat("step\n\n", 60),
+	)
+
+	c, err := NewConverter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SetVault(root)
+	pdfPath, err := c.BindToPDF("Project X", notes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(pdfPath) != "Project X.pdf" {
+		t.Errorf("pdf is %s", pdfPath)
+	}
+	if _, err := c.BindToPDF("Empty", nil); err == nil {
+		t.Error("bound no notes")
+	}
+
+	// the same again uncompressed, to look inside
+	b, err := c.loadBinder("Project X", notes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := DefaultPDFOptions()
+	pdf := setupPDF(options)
+	pdf.SetCompression(false)
+	if err := c.processBinder(pdf, options, b); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := pdf.Output(&out); err != nil {
+		t.Fatal(err)
+	}
+	data := out.String()
+
+	// cover, contents, a page for the goals and two for the plan
+	if pdf.PageNo() != 5 {
+		t.Errorf("got %d pages, want 5", pdf.PageNo())
+	}
+	for _, want := range []string{tj("Project X"), tj("2 notes"), tj("Contents"), tj("Plan > Milestones"), tj("3"), tj("4")} {
+		if !strings.Contains(data, want) {
+			t.Errorf("pdf is missing %s", want)
+		}
+	}
+	for _, want := range []string{"Project goals", "Why", "Plan", "Milestones"} {
+		if !strings.Contains(data, outlineTitle(want)) {
+			t.Errorf("outline is missing %s", want)
+		}
+	}
+	// the notes and their headings are a level apart, the plan's title heading standing for it
+	var listed []string
+	for _, entry := range b.contents.entries {
+		listed = append(listed, strings.Repeat(">", entry.depth)+entry.title)
+	}
+	if got := strings.Join(listed, " "); got != "Project goals >Why Plan >Milestones" {
+		t.Errorf("contents are %s", got)
+	}
+	// both links jump within the pdf
+	if n := strings.Count(data, "/Subtype /Link /Rect") - strings.Count(data, "/URI"); n < 2+len(b.contents.entries)*2 {
+		t.Errorf("got %d internal links", n)
+	}
+}
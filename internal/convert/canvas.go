@@ -0,0 +1,501 @@
+package convert
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+	"github.com/yuin/goldmark/ast"
+	east "github.com/yuin/goldmark/extension/ast"
+)
+
+// room kept above groups and file cards for the label obsidian shows there, in canvas pixels
+const canvasLabelRoom = 30
+
+// canvas is an obsidian .canvas board in the JSON Canvas format: cards laid out at pixel
+// coordinates, joined by edges
+type canvas struct {
+	Nodes []canvasNode `json:"nodes"`
+	Edges []canvasEdge `json:"edges"`
+}
+
+// canvasNode is a card: text, a file from the vault, a link or a group around other cards
+type canvasNode struct {
+	ID      string  `json:"id"`
+	Type    string  `json:"type"`
+	X       float64 `json:"x"`
+	Y       float64 `json:"y"`
+	Width   float64 `json:"width"`
+	Height  float64 `json:"height"`
+	Color   string  `json:"color"`   // a preset "1" to "6" or "#rrggbb"
+	Text    string  `json:"text"`    // markdown, of text cards
+	File    string  `json:"file"`    // from the vault root, of file cards
+	Subpath string  `json:"subpath"` // "#Heading" within a file
+	URL     string  `json:"url"`
+	Label   string  `json:"label"` // of groups
+}
+
+// canvasEdge joins two cards, from the middle of a side of each; sides left out face
+// the other card
+type canvasEdge struct {
+	ID       string `json:"id"`
+	FromNode string `json:"fromNode"`
+	FromSide string `json:"fromSide"`
+	FromEnd  string `json:"fromEnd"` // "arrow" or "none", the default
+	ToNode   string `json:"toNode"`
+	ToSide   string `json:"toSide"`
+	ToEnd    string `json:"toEnd"` // "none" or "arrow", the default
+	Color    string `json:"color"`
+	Label    string `json:"label"`
+}
+
+func parseCanvas(content []byte, options PDFOptions) (*canvas, error) {
+	var board canvas
+	if err := json.Unmarshal(content, &board); err != nil {
+		return nil, fmt.Errorf("failed to parse canvas: %w", err)
+	}
+	// json escapes hide emoji from fontText until now
+	for i := range board.Nodes {
+		n := &board.Nodes[i]
+		n.Text, n.Label = string(fontText([]byte(n.Text), options)), string(fontText([]byte(n.Label), options))
+	}
+	for i := range board.Edges {
+		board.Edges[i].Label = string(fontText([]byte(board.Edges[i].Label), options))
+	}
+	return &board, nil
+}
+
+// bounds is the box around every card and its label, in canvas pixels
+func (b *canvas) bounds() (x, y, width, height float64) {
+	if len(b.Nodes) == 0 {
+		return 0, 0, 0, 0
+	}
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, n := range b.Nodes {
+		top := n.Y
+		if n.labeled() {
+			top -= canvasLabelRoom
+		}
+		minX, minY = math.Min(minX, n.X), math.Min(minY, top)
+		maxX, maxY = math.Max(maxX, n.X+n.Width), math.Max(maxY, n.Y+n.Height)
+	}
+	return minX, minY, maxX - minX, maxY - minY
+}
+
+// wide reports whether the board is wider than tall, to be printed on a page turned sideways
+func (b *canvas) wide() bool {
+	_, _, width, height := b.bounds()
+	return width > height
+}
+
+func (n canvasNode) labeled() bool {
+	return n.Type == "group" && n.Label != "" || n.Type == "file"
+}
+
+// canvasColors are obsidian's preset colors, by number
+var canvasColors = map[string][3]int{
+	"1": {251, 70, 76},   // red
+	"2": {233, 151, 63},  // orange
+	"3": {224, 222, 113}, // yellow
+	"4": {68, 207, 110},  // green
+	"5": {83, 223, 221},  // cyan
+	"6": {168, 130, 255}, // purple
+}
+
+// canvasColor reads a card or edge color, false when it has none
+func canvasColor(c string) ([3]int, bool) {
+	if rgb, ok := canvasColors[c]; ok {
+		return rgb, true
+	}
+	if hex, ok := strings.CutPrefix(c, "#"); ok && len(hex) == 6 {
+		if v, err := strconv.ParseUint(hex, 16, 32); err == nil {
+			return [3]int{int(v >> 16), int(v >> 8 & 0xff), int(v & 0xff)}, true
+		}
+	}
+	return [3]int{}, false
+}
+
+// tint is a color faded toward white, for the background of colored cards
+func tint(rgb [3]int, amount float64) (int, int, int) {
+	fade := func(c int) int { return c + int(float64(255-c)*(1-amount)) }
+	return fade(rgb[0]), fade(rgb[1]), fade(rgb[2])
+}
+
+// canvasRenderer draws a board on one page, scaled to fit between the margins
+type canvasRenderer struct {
+	pdf     *gofpdf.Fpdf
+	options PDFOptions
+	vault   *vault
+	path    string                // the .canvas file
+	nodes   map[string]canvasNode // by id, for the edges
+	scale   float64               // mm per canvas pixel
+	left    float64               // where the board's top left corner lands on the page
+	top     float64
+	minX    float64 // the board's top left corner, in canvas pixels
+	minY    float64
+	size    float64 // pt, of card text
+}
+
+// processCanvas draws an obsidian canvas: groups behind, then cards with their text,
+// notes and images, then the edges between them with their arrows and labels
+func (c *Converter) processCanvas(pdf *gofpdf.Fpdf, options PDFOptions, canvasPath string, board *canvas) error {
+	if c.vault == nil {
+		c.vault = &vault{}
+	}
+	x, y, width, height := board.bounds()
+	if width <= 0 || height <= 0 {
+		return nil
+	}
+
+	lMargin, tMargin, rMargin, _ := pdf.GetMargins()
+	pageW, pageH := pdf.GetPageSize()
+	_, bottom := pdf.GetAutoPageBreak()
+	maxW, maxH := pageW-lMargin-rMargin, pageH-tMargin-bottom
+
+	// small boards stay at the size obsidian shows them, big ones shrink to fit
+	natural := 25.4 / imageDPI
+	scale := math.Min(natural, math.Min(maxW/width, maxH/height))
+	r := &canvasRenderer{
+		pdf:     pdf,
+		options: options,
+		vault:   c.vault,
+		path:    canvasPath,
+		nodes:   map[string]canvasNode{},
+		scale:   scale,
+		left:    lMargin + (maxW-width*scale)/2,
+		top:     tMargin,
+		minX:    x,
+		minY:    y,
+		size:    options.FontSize * scale / natural,
+	}
+	for _, n := range board.Nodes {
+		r.nodes[n.ID] = n
+	}
+
+	for _, n := range board.Nodes {
+		if n.Type == "group" {
+			r.group(n)
+		}
+	}
+	for _, n := range board.Nodes {
+		if n.Type != "group" {
+			r.card(n)
+		}
+	}
+	for _, e := range board.Edges {
+		r.edge(e)
+	}
+
+	pdf.SetDrawColor(0, 0, 0)
+	pdf.SetFillColor(255, 255, 255)
+	pdf.SetTextColor(0, 0, 0)
+	pdf.SetLineWidth(0.2)
+	pdf.SetFont(mainFamily, "", options.FontSize)
+	return nil
+}
+
+// at is where a point of the board lands on the page
+func (r *canvasRenderer) at(x, y float64) (float64, float64) {
+	return r.left + (x-r.minX)*r.scale, r.top + (y-r.minY)*r.scale
+}
+
+// box is a card's place on the page
+func (r *canvasRenderer) box(n canvasNode) (x, y, w, h float64) {
+	x, y = r.at(n.X, n.Y)
+	return x, y, n.Width * r.scale, n.Height * r.scale
+}
+
+func (r *canvasRenderer) radius(w, h float64) float64 {
+	return math.Min(8*r.scale, math.Min(w, h)/4)
+}
+
+// group is a shaded frame with its label above its top left corner
+func (r *canvasRenderer) group(n canvasNode) {
+	x, y, w, h := r.box(n)
+	r.pdf.SetLineWidth(math.Max(0.15, 1.5*r.scale))
+	r.pdf.SetDrawColor(150, 150, 150)
+	r.pdf.SetFillColor(245, 245, 245)
+	if rgb, ok := canvasColor(n.Color); ok {
+		r.pdf.SetDrawColor(rgb[0], rgb[1], rgb[2])
+		r.pdf.SetFillColor(tint(rgb, 0.1))
+	}
+	r.pdf.RoundedRect(x, y, w, h, r.radius(w, h), "1234", "FD")
+	if n.Label != "" {
+		r.label(n.Label, x, y, w, "B")
+	}
+}
+
+// label writes a group's or file's name just above a card
+func (r *canvasRenderer) label(text string, x, y, w float64, style string) {
+	r.pdf.SetFont(mainFamily, style, r.size)
+	r.pdf.SetTextColor(90, 90, 90)
+	r.pdf.Text(x, y-1.5*r.scale-0.3*r.size*mmPerPt, fitText(r.pdf, text, w))
+	r.pdf.SetTextColor(0, 0, 0)
+}
+
+// card draws a text, file or link card in its frame
+func (r *canvasRenderer) card(n canvasNode) {
+	x, y, w, h := r.box(n)
+	r.pdf.SetLineWidth(math.Max(0.15, 1.5*r.scale))
+	r.pdf.SetDrawColor(150, 150, 150)
+	r.pdf.SetFillColor(255, 255, 255)
+	if rgb, ok := canvasColor(n.Color); ok {
+		r.pdf.SetDrawColor(rgb[0], rgb[1], rgb[2])
+		r.pdf.SetFillColor(tint(rgb, 0.15))
+	}
+
+	switch n.Type {
+	case "text":
+		r.pdf.RoundedRect(x, y, w, h, r.radius(w, h), "1234", "FD")
+		body := stripComments([]byte(n.Text))
+		r.lines(cardLines(section(parseMarkdown(body), body, ""), body, r.size, r.options.FontSize), x, y, w, h)
+	case "file":
+		r.file(n, x, y, w, h)
+	case "link":
+		r.pdf.RoundedRect(x, y, w, h, r.radius(w, h), "1234", "FD")
+		r.lines([]canvasLine{{text: n.URL, family: mainFamily, size: r.size, color: true}}, x, y, w, h)
+		r.pdf.LinkString(x, y, w, h, n.URL)
+	default:
+		r.pdf.RoundedRect(x, y, w, h, r.radius(w, h), "1234", "FD")
+	}
+}
+
+// file draws a file card: an image fitted to it, a note's text or else the file's name,
+// with the name above it as obsidian has
+func (r *canvasRenderer) file(n canvasNode, x, y, w, h float64) {
+	path, found := r.vault.resolve(n.File, r.path)
+	name := strings.TrimSuffix(filepath.Base(n.File), ".md") + n.Subpath
+	r.label(name, x, y, w, "")
+
+	if found && isImage(path) {
+		if image, info := registerImage(r.pdf, path, r.options.Grayscale); info != nil {
+			iw, ih := info.Width(), info.Height()
+			fit := math.Min(w/iw, h/ih)
+			r.pdf.Image(image, x+(w-iw*fit)/2, y+(h-ih*fit)/2, iw*fit, ih*fit, false, "", 0, "")
+			return
+		}
+	}
+
+	r.pdf.RoundedRect(x, y, w, h, r.radius(w, h), "1234", "FD")
+	if found && strings.EqualFold(filepath.Ext(path), ".md") {
+		if content, err := os.ReadFile(path); err == nil {
+			_, body, _ := parseNoteOptions(content)
+			body = stripComments(fontText(body, r.options))
+			r.lines(cardLines(section(parseMarkdown(body), body, strings.TrimPrefix(n.Subpath, "#")), body, r.size, r.options.FontSize), x, y, w, h)
+			return
+		}
+	}
+	r.lines([]canvasLine{{text: filepath.Base(n.File), family: mainFamily, style: "I", size: r.size}}, x, y, w, h)
+}
+
+// canvasLine is a paragraph of a card's text, wrapped when it's drawn
+type canvasLine struct {
+	text   string
+	family string
+	style  string
+	size   float64 // pt
+	indent float64 // mm
+	gap    bool    // space above, between blocks
+	color  bool    // a link, in link colors
+}
+
+// cardLines flattens markdown blocks to the lines a card shows: headings in bold and
+// larger, list items bulleted, code monospaced; size is the card's text size and
+// fontSize the notes' one, which heading sizes follow
+func cardLines(nodes []ast.Node, source []byte, size, fontSize float64) []canvasLine {
+	var lines []canvasLine
+	indent := size * mmPerPt * 1.2
+	var add func(n ast.Node, depth int, prefix string)
+	add = func(n ast.Node, depth int, prefix string) {
+		line := canvasLine{family: mainFamily, size: size, indent: float64(depth) * indent, gap: prefix == ""}
+		switch n := n.(type) {
+		case *ast.Heading:
+			line.text, line.style = plainText(n, source), "B"
+			line.size = size + float64(6-n.Level)*2*size/fontSize
+			lines = append(lines, line)
+		case *ast.List:
+			number := n.Start
+			for item := n.FirstChild(); item != nil; item = item.NextSibling() {
+				bullet := "• "
+				if n.IsOrdered() {
+					bullet = strconv.Itoa(number) + ". "
+					number++
+				}
+				for i, child := 0, item.FirstChild(); child != nil; i, child = i+1, child.NextSibling() {
+					if i == 0 {
+						add(child, depth, bullet)
+					} else {
+						add(child, depth+1, "")
+					}
+				}
+			}
+		case *ast.FencedCodeBlock, *ast.CodeBlock:
+			code := n.Lines()
+			for i := 0; i < code.Len(); i++ {
+				segment := code.At(i)
+				line.text = strings.TrimRight(string(segment.Value(source)), "\n")
+				line.family, line.size, line.gap = monoFamily, size*0.9, line.gap && i == 0
+				lines = append(lines, line)
+			}
+		case *ast.HTMLBlock:
+			for i, text := range strings.Split(htmlText(n, source), "\n") {
+				line.text, line.gap = text, line.gap && i == 0
+				lines = append(lines, line)
+			}
+		case *MathBlock:
+			line.text, line.family = n.TeX(source), monoFamily
+			lines = append(lines, line)
+		case *ast.ThematicBreak:
+		case *east.Table:
+			// a line for each row, the header in bold
+			for row := n.FirstChild(); row != nil; row = row.NextSibling() {
+				var cells []string
+				for cell := row.FirstChild(); cell != nil; cell = cell.NextSibling() {
+					cells = append(cells, plainText(cell, source))
+				}
+				line.text = strings.Join(cells, "   ")
+				if row.Kind() == east.KindTableHeader {
+					line.style = "B"
+				}
+				lines = append(lines, line)
+				line.style, line.gap = "", false
+			}
+		default:
+			if child := n.FirstChild(); child == nil || child.Type() != ast.TypeBlock {
+				line.text = prefix + plainText(n, source)
+				lines = append(lines, line)
+				return
+			}
+			// quotes and callouts, their blocks indented
+			for child := n.FirstChild(); child != nil; child = child.NextSibling() {
+				add(child, depth+1, "")
+			}
+		}
+	}
+	for _, n := range nodes {
+		add(n, 0, "")
+	}
+	if len(lines) > 0 {
+		lines[0].gap = false
+	}
+	return lines
+}
+
+// lines writes a card's text, wrapped to its width and cut off at its bottom
+func (r *canvasRenderer) lines(lines []canvasLine, x, y, w, h float64) {
+	pad := math.Max(1, 12*r.scale)
+	r.pdf.ClipRect(x, y, w, h, false)
+	top := y + pad
+	for _, line := range lines {
+		r.pdf.SetFont(line.family, line.style, line.size)
+		height := line.size * mmPerPt * 1.3
+		if line.gap {
+			top += height / 3
+		}
+		width := w - 2*pad - line.indent
+		for _, text := range r.pdf.SplitText(line.text, width+2*r.pdf.GetCellMargin()) {
+			if top > y+h {
+				break
+			}
+			if line.color && r.options.ColorLinks {
+				r.pdf.SetTextColor(0, 0, 255)
+			}
+			r.pdf.Text(x+pad+line.indent, top+height*0.75, text)
+			r.pdf.SetTextColor(0, 0, 0)
+			top += height
+		}
+	}
+	r.pdf.ClipEnd()
+}
+
+// sides are the directions out of a card's sides
+var sides = map[string][2]float64{"top": {0, -1}, "right": {1, 0}, "bottom": {0, 1}, "left": {-1, 0}}
+
+// facing is the side of a card that faces another, for edges that don't name one
+func facing(from, to canvasNode) string {
+	dx := to.X + to.Width/2 - (from.X + from.Width/2)
+	dy := to.Y + to.Height/2 - (from.Y + from.Height/2)
+	switch {
+	case math.Abs(dx)*from.Height > math.Abs(dy)*from.Width && dx > 0:
+		return "right"
+	case math.Abs(dx)*from.Height > math.Abs(dy)*from.Width:
+		return "left"
+	case dy > 0:
+		return "bottom"
+	}
+	return "top"
+}
+
+// anchor is the middle of a card's side on the page, and the direction out of it
+func (r *canvasRenderer) anchor(n canvasNode, side string) (x, y float64, out [2]float64) {
+	out = sides[side]
+	x, y = r.at(n.X+n.Width/2*(1+out[0]), n.Y+n.Height/2*(1+out[1]))
+	return x, y, out
+}
+
+// edge draws a curve between two cards' sides, leaving and arriving square to them as
+// in obsidian, with arrowheads at the ends that have them and its label halfway
+func (r *canvasRenderer) edge(e canvasEdge) {
+	from, ok := r.nodes[e.FromNode]
+	to, ok2 := r.nodes[e.ToNode]
+	if !ok || !ok2 {
+		return
+	}
+	fromSide, toSide := e.FromSide, e.ToSide
+	if _, ok := sides[fromSide]; !ok {
+		fromSide = facing(from, to)
+	}
+	if _, ok := sides[toSide]; !ok {
+		toSide = facing(to, from)
+	}
+	x0, y0, out0 := r.anchor(from, fromSide)
+	x1, y1, out1 := r.anchor(to, toSide)
+	reach := math.Min(math.Hypot(x1-x0, y1-y0)/2, 150*r.scale)
+	cx0, cy0 := x0+out0[0]*reach, y0+out0[1]*reach
+	cx1, cy1 := x1+out1[0]*reach, y1+out1[1]*reach
+
+	r.pdf.SetDrawColor(110, 110, 110)
+	r.pdf.SetFillColor(110, 110, 110)
+	if rgb, ok := canvasColor(e.Color); ok {
+		r.pdf.SetDrawColor(rgb[0], rgb[1], rgb[2])
+		r.pdf.SetFillColor(rgb[0], rgb[1], rgb[2])
+	}
+	r.pdf.SetLineWidth(math.Max(0.2, 2*r.scale))
+	r.pdf.CurveBezierCubic(x0, y0, cx0, cy0, cx1, cy1, x1, y1, "D")
+	if e.FromEnd == "arrow" {
+		r.arrowhead(x0, y0, out0)
+	}
+	if e.ToEnd != "none" {
+		r.arrowhead(x1, y1, out1)
+	}
+
+	if e.Label != "" {
+		// the curve's midpoint
+		mx, my := (x0+3*cx0+3*cx1+x1)/8, (y0+3*cy0+3*cy1+y1)/8
+		r.pdf.SetFont(mainFamily, "", r.size*0.9)
+		text := fitText(r.pdf, e.Label, 200*r.scale)
+		tw, th := r.pdf.GetStringWidth(text), r.size*0.9*mmPerPt
+		r.pdf.SetFillColor(255, 255, 255)
+		r.pdf.Rect(mx-tw/2-1, my-th/2-1, tw+2, th+2, "F")
+		r.pdf.Text(mx-tw/2, my+th*0.35, text)
+	}
+}
+
+// arrowhead draws a filled arrow pointing into a card at x, y; out is the direction
+// out of the card's side
+func (r *canvasRenderer) arrowhead(x, y float64, out [2]float64) {
+	length := math.Max(1.2, 12*r.scale)
+	bx, by := x+out[0]*length, y+out[1]*length
+	half := length / 2
+	r.pdf.Polygon([]gofpdf.PointType{
+		{X: x, Y: y},
+		{X: bx - out[1]*half, Y: by + out[0]*half},
+		{X: bx + out[1]*half, Y: by - out[0]*half},
+	}, "F")
+}
@@ -0,0 +1,99 @@
+package convert
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testCanvas = `{
+	"nodes": [
+		{"id": "g", "type": "group", "x": -40, "y": -40, "width": 900, "height": 300, "label": "Backend"},
+		{"id": "api", "type": "text", "text": "# API\nHandles **auth**\n\n- parse\n- route", "x": 0, "y": 0, "width": 250, "height": 200, "color": "4"},
+		{"id": "db", "type": "file", "file": "Notes/Storage.md", "subpath": "#Tables", "x": 500, "y": 0, "width": 300, "height": 200},
+		{"id": "docs", "type": "link", "url": "https://example.com", "x": 0, "y": 400, "width": 250, "height": 60}
+	],
+	"edges": [
+		{"id": "e1", "fromNode": "api", "fromSide": "right", "toNode": "db", "toSide": "left", "label": "queries"},
+		{"id": "e2", "fromNode": "api", "toNode": "docs", "toEnd": "none"},
+		{"id": "e3", "fromNode": "api", "toNode": "gone"}
+	]
+}`
+
+func TestCanvas(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "Notes"), 0755)
+	os.WriteFile(filepath.Join(root, "Notes", "Storage.md"), []byte("# Storage\n\nskipped\n\n## Tables\n\nusers and orders\n"), 0644)
+
+	board, err := parseCanvas([]byte(testCanvas), DefaultPDFOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the file card's name goes above it
+	if x, y, w, h := board.bounds(); x != -40 || y != -70 || w != 900 || h != 530 {
+		t.Errorf("bounds %v %v %v %v", x, y, w, h)
+	}
+	if !board.wide() {
+		t.Error("board not wide")
+	}
+	if _, err := parseCanvas([]byte("{nodes"), DefaultPDFOptions()); err == nil {
+		t.Error("broken canvas parsed")
+	}
+
+	options := DefaultPDFOptions()
+	options.landscape = true
+	pdf := setupPDF(options)
+	pdf.SetCompression(false)
+	c := &Converter{options: options, vault: &vault{root: root}}
+	if err := c.processCanvas(pdf, options, filepath.Join(root, "board.canvas"), board); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := pdf.Output(&out); err != nil {
+		t.Fatal(err)
+	}
+	data := out.String()
+
+	if w, h := pdf.GetPageSize(); w < h {
+		t.Errorf("page is %vx%v, want landscape", w, h)
+	}
+	for _, want := range []string{"Backend", "API", "Handles auth", "• parse", "Storage#Tables", "users and orders", "https://example.com", "queries"} {
+		if !strings.Contains(data, "("+pdfText(want)+") Tj") {
+			t.Errorf("pdf is missing %s", want)
+		}
+	}
+	if strings.Contains(data, pdfText("skipped")) {
+		t.Error("file card shows more than its section")
+	}
+	if !strings.Contains(data, "/URI (https://example.com)") {
+		t.Error("link card isn't clickable")
+	}
+}
+
+func TestCanvasGeometry(t *testing.T) {
+	a := canvasNode{X: 0, Y: 0, Width: 100, Height: 100}
+	for _, tt := range []struct {
+		to   canvasNode
+		want string
+	}{
+		{canvasNode{X: 300, Y: 20, Width: 100, Height: 100}, "right"},
+		{canvasNode{X: -300, Y: 0, Width: 100, Height: 100}, "left"},
+		{canvasNode{X: 20, Y: 300, Width: 100, Height: 100}, "bottom"},
+		{canvasNode{X: 0, Y: -300, Width: 100, Height: 100}, "top"},
+	} {
+		if got := facing(a, tt.to); got != tt.want {
+			t.Errorf("facing %+v = %s, want %s", tt.to, got, tt.want)
+		}
+	}
+
+	for c, want := range map[string][3]int{"1": {251, 70, 76}, "#3366cc": {0x33, 0x66, 0xcc}} {
+		if got, ok := canvasColor(c); !ok || got != want {
+			t.Errorf("color %s = %v", c, got)
+		}
+	}
+	if _, ok := canvasColor("blue"); ok {
+		t.Error("unknown color accepted")
+	}
+}
@@ -0,0 +1,182 @@
+package convert
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/yuin/goldmark/ast"
+)
+
+const (
+	codeLineH   = 5.0
+	codePadding = 1.5 // mm between the shaded band and the code
+)
+
+// codeRun is a piece of a code line printed in one style
+type codeRun struct {
+	text  string
+	style string // gofpdf font style
+	gray  int    // text shade, 0 is black
+}
+
+// codeLine is one printed line of a code block, number is 0 on wrapped continuations
+type codeLine struct {
+	number int
+	runs   []codeRun
+}
+
+// codeText is the content of a code block
+func codeText(n ast.Node, source []byte) string {
+	var b strings.Builder
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		line := lines.At(i)
+		b.Write(line.Value(source))
+	}
+	return b.String()
+}
+
+// codeStyle is how a token prints on e-ink: weight, slant and shades of gray rather than color
+func codeStyle(t chroma.TokenType) (string, int) {
+	switch {
+	case t == chroma.CommentPreproc, t == chroma.CommentPreprocFile:
+		return "B", 90
+	case t.InCategory(chroma.Comment):
+		return "I", 120
+	case t.InCategory(chroma.Keyword), t == chroma.NameBuiltin, t == chroma.NameTag:
+		return "B", 0
+	case t == chroma.NameFunction, t == chroma.NameClass, t == chroma.NameDecorator:
+		return "B", 60
+	case t.InSubCategory(chroma.LiteralString):
+		return "", 90
+	case t == chroma.GenericDeleted:
+		return "", 140
+	case t == chroma.GenericInserted, t == chroma.GenericHeading, t == chroma.GenericSubheading:
+		return "B", 0
+	case t == chroma.GenericEmph:
+		return "I", 0
+	}
+	return "", 0
+}
+
+// highlightCode splits code into lines of styled runs, plain ones when
+// highlighting is off or the language isn't known
+func (r *pdfRenderer) highlightCode(lang, code string) [][]codeRun {
+	code = strings.ReplaceAll(strings.TrimRight(code, "\n"), "\t", "    ")
+
+	var lexer chroma.Lexer
+	if r.options.Highlight && lang != "" {
+		lexer = lexers.Get(lang)
+	}
+	if lexer == nil {
+		var lines [][]codeRun
+		for _, line := range strings.Split(code, "\n") {
+			lines = append(lines, []codeRun{{text: line}})
+		}
+		return lines
+	}
+
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, code)
+	if err != nil {
+		return [][]codeRun{{{text: code}}}
+	}
+	var lines [][]codeRun
+	for _, tokens := range chroma.SplitTokensIntoLines(iterator.Tokens()) {
+		var runs []codeRun
+		for _, token := range tokens {
+			style, gray := codeStyle(token.Type)
+			if text := strings.TrimRight(token.Value, "\n"); text != "" {
+				runs = append(runs, codeRun{text: text, style: style, gray: gray})
+			}
+		}
+		lines = append(lines, runs)
+	}
+	return lines
+}
+
+// wrapCode breaks lines wider than width between characters; code has no words to wrap at
+func (r *pdfRenderer) wrapCode(lines [][]codeRun, width float64) []codeLine {
+	var wrapped []codeLine
+	for i, runs := range lines {
+		line := codeLine{number: i + 1}
+		used := 0.0
+		for _, run := range runs {
+			r.pdf.SetFont(monoFamily, run.style, r.options.FontSize-1)
+			start := 0
+			for j, c := range run.text {
+				w := r.pdf.GetStringWidth(string(c))
+				if used+w > width && used > 0 {
+					if j > start {
+						line.runs = append(line.runs, codeRun{text: run.text[start:j], style: run.style, gray: run.gray})
+					}
+					wrapped = append(wrapped, line)
+					line, used, start = codeLine{}, 0, j
+				}
+				used += w
+			}
+			if start < len(run.text) {
+				line.runs = append(line.runs, codeRun{text: run.text[start:], style: run.style, gray: run.gray})
+			}
+		}
+		wrapped = append(wrapped, line)
+	}
+	return wrapped
+}
+
+// renderCode prints a code block line by line on a shaded band, wrapping long lines
+// and optionally numbering them in a gutter
+func (r *pdfRenderer) renderCode(lang, code string) {
+	r.pdf.Ln(3)
+	lMargin, _, rMargin, _ := r.pdf.GetMargins()
+	pageW, pageH := r.pdf.GetPageSize()
+	_, bottom := r.pdf.GetAutoPageBreak()
+
+	lines := r.highlightCode(lang, code)
+	gutter := 0.0
+	if r.options.LineNumbers {
+		r.pdf.SetFont(monoFamily, "", r.options.FontSize-2)
+		gutter = r.pdf.GetStringWidth(strconv.Itoa(len(lines))) + 2*codePadding
+	}
+	textX := lMargin + gutter + codePadding
+	wrapped := r.wrapCode(lines, pageW-rMargin-codePadding-textX)
+
+	for _, line := range wrapped {
+		if r.pdf.GetY()+codeLineH > pageH-bottom {
+			r.pdf.AddPage()
+		}
+		y := r.pdf.GetY()
+		if r.options.Highlight {
+			r.pdf.SetFillColor(245, 245, 245)
+			r.pdf.Rect(lMargin, y, pageW-lMargin-rMargin, codeLineH, "F")
+		}
+
+		if line.number > 0 && r.options.LineNumbers {
+			r.pdf.SetFont(monoFamily, "", r.options.FontSize-2)
+			r.pdf.SetTextColor(150, 150, 150)
+			number := strconv.Itoa(line.number)
+			r.pdf.Text(lMargin+gutter-codePadding-r.pdf.GetStringWidth(number), r.codeBaseline(y), number)
+		}
+
+		x := textX
+		for _, run := range line.runs {
+			r.pdf.SetFont(monoFamily, run.style, r.options.FontSize-1)
+			r.pdf.SetTextColor(run.gray, run.gray, run.gray)
+			r.pdf.Text(x, r.codeBaseline(y), run.text)
+			x += r.pdf.GetStringWidth(run.text)
+		}
+		r.pdf.SetXY(lMargin, y+codeLineH)
+	}
+
+	r.pdf.SetTextColor(0, 0, 0)
+	r.pdf.SetFillColor(255, 255, 255)
+	r.pdf.SetFont(mainFamily, r.currentFont(), r.options.FontSize)
+	r.pdf.Ln(3)
+}
+
+// codeBaseline is where text sits in a code line starting at y, centered as Cell does
+func (r *pdfRenderer) codeBaseline(y float64) float64 {
+	_, size := r.pdf.GetFontSize()
+	return y + codeLineH/2 + 0.3*size
+}
@@ -0,0 +1,84 @@
+package convert
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHighlightCode(t *testing.T) {
+	options := DefaultPDFOptions()
+	r := &pdfRenderer{pdf: setupPDF(options), options: options}
+	code := "func main() {\n\t// say hi\n\tprintln(\"hi\")\n}\n"
+
+	lines := r.highlightCode("go", code)
+	if len(lines) != 4 {
+		t.Fatalf("got %d lines, want 4", len(lines))
+	}
+	styles := map[string]codeRun{}
+	for _, runs := range lines {
+		for _, run := range runs {
+			styles[strings.TrimSpace(run.text)] = run
+		}
+	}
+	for text, want := range map[string]codeRun{
+		"func":      {style: "B"},
+		"// say hi": {style: "I", gray: 120},
+		`"hi"`:      {gray: 90},
+		"println":   {style: "B"},
+	} {
+		got := styles[text]
+		if got.style != want.style || got.gray != want.gray {
+			t.Errorf("%s printed as %q/%d, want %q/%d", text, got.style, got.gray, want.style, want.gray)
+		}
+	}
+	if lines[1][0].text != "    " {
+		t.Errorf("tab not expanded: %q", lines[1][0].text)
+	}
+
+	r.options.Highlight = false
+	for _, runs := range r.highlightCode("go", code) {
+		if len(runs) != 1 || runs[0].style != "" {
+			t.Errorf("unhighlighted line split into %+v", runs)
+		}
+	}
+}
+
+func TestWrapCode(t *testing.T) {
+	options := DefaultPDFOptions()
+	r := &pdfRenderer{pdf: setupPDF(options), options: options}
+	long := strings.Repeat("x", 200)
+
+	wrapped := r.wrapCode([][]codeRun{{{text: "short"}}, {{text: long[:100], style: "B"}, {text: long[100:]}}}, 100)
+	if len(wrapped) < 3 || wrapped[0].number != 1 || wrapped[1].number != 2 || wrapped[2].number != 0 {
+		t.Fatalf("got %+v", wrapped)
+	}
+	total := 0
+	for _, line := range wrapped[1:] {
+		width := 0.0
+		for _, run := range line.runs {
+			r.pdf.SetFont(monoFamily, run.style, options.FontSize-1)
+			width += r.pdf.GetStringWidth(run.text)
+			total += len(run.text)
+		}
+		if width > 100 {
+			t.Errorf("wrapped line is %.1fmm wide", width)
+		}
+	}
+	if total != 200 {
+		t.Errorf("wrapping kept %d of 200 characters", total)
+	}
+}
+
+func TestCodeBlockLineNumbers(t *testing.T) {
+	options := DefaultPDFOptions()
+	options.TOC = false
+	options.LineNumbers = true
+	source := "```python\n" + strings.Repeat("print('x')\n", 12) + "```\n\n    indented\n"
+	_, data := renderPDF(t, options, source)
+
+	for _, want := range []string{"1", "12", "print", "indented"} {
+		if !strings.Contains(data, "("+pdfText(want)+") Tj") {
+			t.Errorf("pdf is missing %s", want)
+		}
+	}
+}
@@ -1,11 +1,16 @@
 package convert
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -13,20 +18,32 @@ import (
 	"github.com/ledongthuc/pdf"
 	"github.com/yuin/goldmark"
 	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	east "github.com/yuin/goldmark/extension/ast"
 	"github.com/yuin/goldmark/text"
-	"gopkg.in/yaml.v3"
 )
 
 // pdf generation config
 type PDFOptions struct {
-	Margins    float64
-	FontSize   float64
-	MainFont   string
-	MonoFont   string
-	PageSize   string
-	ColorLinks bool
-	TOC        bool
-	Highlight  bool
+	Margins     float64
+	RightMargin float64 // wider for notes in the margin, 0 for the same as Margins
+	FontSize    float64
+	MainFont    string
+	MonoFont    string
+	MathFont    string // for formulas, "" to look for one with the symbols they use
+	PageSize    string
+	ColorLinks  bool
+	TOC         bool
+	Highlight   bool
+	Grayscale   bool   // images in shades of gray, as the tablet shows them
+	LineNumbers bool   // number the lines of code blocks
+	Header      string // page header template, see noteInfo.fill and drawTemplate
+	Footer      string
+	// margins and font size given on the command line, which a device profile leaves alone
+	// even when a note picks it
+	FixedMargins  bool
+	FixedFontSize bool
+	landscape     bool // pages turned sideways, for canvases wider than tall
 }
 
 // default pdf options
@@ -40,6 +57,7 @@ func DefaultPDFOptions() PDFOptions {
 		ColorLinks: true,
 		TOC:        true,
 		Highlight:  true,
+		Footer:     "{title}|{page} / {pages}",
 	}
 }
 
@@ -63,6 +81,9 @@ type Converter struct {
 	TempDir   string
 	options   PDFOptions
 	mdOptions MarkdownOptions
+	vault     *vault
+	now       func() time.Time // the clock for {date}, time.Now when nil
+	logf      func(string, ...interface{})
 }
 
 func NewConverter() (*Converter, error) {
@@ -75,6 +96,7 @@ func NewConverter() (*Converter, error) {
 		TempDir:   tmpDir,
 		options:   DefaultPDFOptions(),
 		mdOptions: DefaultMarkdownOptions(),
+		vault:     &vault{},
 	}, nil
 }
 
@@ -86,33 +108,37 @@ func (c *Converter) SetMarkdownOptions(options MarkdownOptions) {
 	c.mdOptions = options
 }
 
-func (c *Converter) Close() error {
-	return os.RemoveAll(c.TempDir)
+// SetLogger reports what's wrong with a file that's converted all the same to logf
+func (c *Converter) SetLogger(logf func(string, ...interface{})) {
+	c.logf = logf
 }
 
-func (c *Converter) setupPDF() *gofpdf.Fpdf {
-	pdf := gofpdf.New("P", "mm", c.options.PageSize, "")
-	pdf.SetMargins(c.options.Margins, c.options.Margins, c.options.Margins)
-	pdf.AddPage()
-	return pdf
+func (c *Converter) warnf(format string, args ...interface{}) {
+	if c.logf != nil {
+		c.logf("warning: "+format, args...)
+	}
 }
 
-func (c *Converter) processYAML(pdf *gofpdf.Fpdf, content []byte) error {
-	var data interface{}
-	if err := yaml.Unmarshal(content, &data); err != nil {
-		return fmt.Errorf("failed to parse YAML: %w", err)
-	}
+// SetVault sets the obsidian vault embeds and images are looked up in
+func (c *Converter) SetVault(dir string) {
+	c.vault = &vault{root: dir}
+}
 
-	pdf.SetFont(c.options.MonoFont, "", c.options.FontSize)
-	yamlStr := fmt.Sprintf("```yaml\n%s\n```", string(content))
-	pdf.MultiCell(0, 5, yamlStr, "", "", false)
-	return nil
+func (c *Converter) Close() error {
+	return os.RemoveAll(c.TempDir)
 }
 
-func (c *Converter) processConfig(pdf *gofpdf.Fpdf, content []byte) error {
-	pdf.SetFont(c.options.MonoFont, "", c.options.FontSize)
-	pdf.MultiCell(0, 5, string(content), "", "", false)
-	return nil
+func setupPDF(options PDFOptions) *gofpdf.Fpdf {
+	pdf := newPDF(options.PageSize, options.landscape)
+	rMargin := options.Margins
+	if options.RightMargin > 0 {
+		rMargin = options.RightMargin
+	}
+	pdf.SetMargins(options.Margins, options.Margins, rMargin)
+	loadFonts(pdf, options)
+	setupPages(pdf, options)
+	pdf.AddPage()
+	return pdf
 }
 
 // pdfRenderer renders goldmark AST to gofpdf
@@ -123,11 +149,31 @@ type pdfRenderer struct {
 	listDepth      int
 	fontStack      []string // track font style (B, I, BI, "")
 	baseLeftMargin float64  // original left margin
+	toc            *tableOfContents
+	vault          *vault
+	notePath       string                // the note being rendered
+	embeds         []string              // notes being transcluded, innermost last
+	bound          map[string]*boundNote // notes of the same binder, by absolute path
+	panels         []panel               // callouts and embeds still open
+	highlight      int                   // inside ==highlights== when above 0
+	linkURL        string                // external link the current text belongs to
+	linkID         int                   // internal link the current text belongs to
+	script         int                   // inside <sup> when above 0, <sub> when below
+	kbd            bool                  // inside <kbd>
+	openTags       []openTag             // inline html tags in effect, innermost last
 }
 
+// pushFont adds style to the styles already in effect
 func (r *pdfRenderer) pushFont(style string) {
+	current := r.currentFont()
+	for _, s := range style {
+		if !strings.ContainsRune(current, s) {
+			current += string(s)
+		}
+	}
+	style = current
 	r.fontStack = append(r.fontStack, style)
-	r.pdf.SetFont(r.options.MainFont, style, r.options.FontSize)
+	r.pdf.SetFont(mainFamily, style, r.options.FontSize)
 }
 
 func (r *pdfRenderer) popFont() {
@@ -135,9 +181,9 @@ func (r *pdfRenderer) popFont() {
 		r.fontStack = r.fontStack[:len(r.fontStack)-1]
 	}
 	if len(r.fontStack) > 0 {
-		r.pdf.SetFont(r.options.MainFont, r.fontStack[len(r.fontStack)-1], r.options.FontSize)
+		r.pdf.SetFont(mainFamily, r.fontStack[len(r.fontStack)-1], r.options.FontSize)
 	} else {
-		r.pdf.SetFont(r.options.MainFont, "", r.options.FontSize)
+		r.pdf.SetFont(mainFamily, "", r.options.FontSize)
 	}
 }
 
@@ -148,20 +194,106 @@ func (r *pdfRenderer) currentFont() string {
 	return ""
 }
 
+// write puts text at the current position, as part of the link being rendered if any
+func (r *pdfRenderer) write(txt string) {
+	if r.highlight > 0 {
+		r.writeHighlighted(txt)
+		return
+	}
+	r.writeText(txt)
+}
+
+func (r *pdfRenderer) writeText(txt string) {
+	switch {
+	case r.script != 0:
+		size, _ := r.pdf.GetFontSize()
+		offset := size * 0.4
+		if r.script < 0 {
+			offset = -size * 0.2
+		}
+		r.pdf.SubWrite(5, txt, size*0.7, offset, r.linkID, r.linkURL)
+	case r.linkID != 0:
+		r.pdf.WriteLinkID(5, txt, r.linkID)
+	case r.linkURL != "":
+		r.pdf.WriteLinkString(5, txt, r.linkURL)
+	default:
+		r.pdf.Write(5, txt)
+	}
+}
+
+// startLink makes the text that follows link to dest, a url or a #heading in the note
+// anything else, like a relative path, stays plain text
+func (r *pdfRenderer) startLink(dest string) {
+	if fragment, ok := strings.CutPrefix(dest, "#"); ok {
+		r.linkID = r.toc.anchor(fragment)
+	} else if u, err := url.Parse(dest); err == nil && u.Scheme != "" {
+		r.linkURL = dest
+	}
+	if r.options.ColorLinks && (r.linkID != 0 || r.linkURL != "") {
+		r.pdf.SetTextColor(0, 0, 255)
+	}
+}
+
+func (r *pdfRenderer) endLink() {
+	r.linkURL = ""
+	r.linkID = 0
+	r.pdf.SetTextColor(0, 0, 0)
+}
+
+// taskCheckBox returns the checkbox a task list item starts with, or nil
+func taskCheckBox(item *ast.ListItem) *east.TaskCheckBox {
+	if block := item.FirstChild(); block != nil {
+		if box, ok := block.FirstChild().(*east.TaskCheckBox); ok {
+			return box
+		}
+	}
+	return nil
+}
+
+// listMarker is an item's number in an ordered list, counting from the list's start,
+// or a bullet that changes with the nesting depth
+func (r *pdfRenderer) listMarker(item *ast.ListItem) string {
+	list := item.Parent().(*ast.List)
+	if !list.IsOrdered() {
+		return []string{"•", "◦", "▪"}[(r.listDepth-1)%3]
+	}
+	number := list.Start
+	for sibling := item.PreviousSibling(); sibling != nil; sibling = sibling.PreviousSibling() {
+		number++
+	}
+	return strconv.Itoa(number) + string(list.Marker)
+}
+
+// drawCheckBox draws an empty or ticked box where the bullet goes
+func (r *pdfRenderer) drawCheckBox(checked bool) {
+	const size = 3.2
+	x, y := r.pdf.GetX(), r.pdf.GetY()+(5-size)/2
+	r.pdf.Rect(x, y, size, size, "D")
+	if checked {
+		r.pdf.Line(x+0.6, y+size/2, x+size*0.4, y+size-0.6)
+		r.pdf.Line(x+size*0.4, y+size-0.6, x+size-0.5, y+0.5)
+	}
+	r.pdf.SetX(x + 5)
+}
+
 func (r *pdfRenderer) render(node ast.Node, entering bool) ast.WalkStatus {
+	if !entering && node.Type() == ast.TypeBlock {
+		r.closeBlockTags(node)
+	}
 	switch n := node.(type) {
 	case *ast.Document:
 		if entering {
-			r.pdf.SetFont(r.options.MainFont, "", r.options.FontSize)
+			r.pdf.SetFont(mainFamily, "", r.options.FontSize)
 		}
 
 	case *ast.Heading:
 		if entering {
 			r.pdf.Ln(6) // Space before heading
+			r.toc.mark(r.pdf, n)
 			size := r.options.FontSize + float64(6-n.Level)*2
-			r.pdf.SetFont(r.options.MainFont, "B", size)
+			r.pdf.SetFont(mainFamily, "B", size)
 		} else {
-			r.pdf.SetFont(r.options.MainFont, "", r.options.FontSize)
+			r.pdf.SetFont(mainFamily, "", r.options.FontSize)
 			r.pdf.Ln(5) // Space after heading
 		}
 
@@ -195,17 +327,122 @@ func (r *pdfRenderer) render(node ast.Node, entering bool) ast.WalkStatus {
 			lMargin, _, _, _ := r.pdf.GetMargins()
 			r.pdf.SetX(lMargin)
 
-			// writes bullet/number / use simple ASCII bullet for compatibility
-			if n.Parent().(*ast.List).IsOrdered() {
-				r.pdf.Cell(5, 5, "1.")
+			if box := taskCheckBox(n); box != nil {
+				r.drawCheckBox(box.IsChecked)
 			} else {
-				r.pdf.Cell(5, 5, "*") // Use asterisk instead of Unicode bullet
+				marker := r.listMarker(n)
+				r.pdf.Cell(max(5, r.pdf.GetStringWidth(marker)+1), 5, marker)
 			}
 			r.pdf.Write(5, " ")
 		} else {
 			r.pdf.Ln(5)
 		}
 
+	case *ast.Blockquote:
+		if entering {
+			r.startPanel(false)
+		} else {
+			r.endPanel()
+		}
+
+	case *ast.ThematicBreak:
+		if entering {
+			lMargin, _, rMargin, _ := r.pdf.GetMargins()
+			pageW, _ := r.pdf.GetPageSize()
+			r.pdf.Ln(3)
+			y := r.pdf.GetY()
+			r.pdf.SetDrawColor(150, 150, 150)
+			r.pdf.Line(lMargin, y, pageW-rMargin, y)
+			r.pdf.SetDrawColor(0, 0, 0)
+			r.pdf.Ln(4)
+		}
+
+	case *ast.HTMLBlock:
+		if entering {
+			if text := htmlText(n, r.source); text != "" {
+				r.write(text)
+				r.pdf.Ln(4)
+			}
+			return ast.WalkSkipChildren
+		}
+
+	case *ast.RawHTML:
+		if entering {
+			r.inlineHTML(n)
+		}
+
+	case *east.TaskCheckBox:
+		// drawn in place of the list bullet
+
+	case *east.Strikethrough:
+		if entering {
+			r.pushFont("S")
+		} else {
+			r.popFont()
+		}
+
+	case *east.Table:
+		if entering {
+			r.renderTable(n)
+			return ast.WalkSkipChildren
+		}
+
+	case *Highlight:
+		if entering {
+			r.highlight++
+		} else {
+			r.highlight--
+		}
+
+	case *Tag:
+		if entering {
+			r.pdf.SetTextColor(110, 110, 110)
+			r.write("#" + n.Name)
+			r.pdf.SetTextColor(0, 0, 0)
+		}
+
+	case *Callout:
+		if entering {
+			r.startPanel(true)
+			r.pdf.SetFont(mainFamily, "B", r.options.FontSize)
+			r.pdf.Write(5, n.Heading())
+			r.pdf.SetFont(mainFamily, r.currentFont(), r.options.FontSize)
+			r.pdf.Ln(7)
+		} else {
+			r.endPanel()
+		}
+
+	case *Embed:
+		if entering {
+			r.embed(n)
+		}
+
+	case *Math:
+		if entering {
+			r.renderMath(n, n.TeX, n.Display)
+		}
+
+	case *MathBlock:
+		if entering {
+			r.renderMath(n, n.TeX(r.source), true)
+			r.pdf.Ln(2)
+			return ast.WalkSkipChildren
+		}
+
+	case *ast.Image:
+		if entering {
+			// obsidian takes a size after the alt text, ![alt|300](img.png)
+			alt, width := plainText(n, r.source), 0.0
+			if i := strings.LastIndex(alt, "|"); i >= 0 && imageWidth(alt[i+1:]) > 0 {
+				alt, width = alt[:i], imageWidth(alt[i+1:])
+			}
+			path, ok := r.vault.imagePath(string(n.Destination), r.notePath)
+			if !ok || !r.drawImage(path, width) {
+				r.write(alt)
+			}
+			return ast.WalkSkipChildren
+		}
+
 	case *ast.Emphasis:
 		if entering {
 			if n.Level == 2 {
@@ -219,43 +456,57 @@ func (r *pdfRenderer) render(node ast.Node, entering bool) ast.WalkStatus {
 
 	case *ast.CodeSpan:
 		if entering {
-			r.pdf.SetFont(r.options.MonoFont, "", r.options.FontSize-1)
+			r.pdf.SetFont(monoFamily, "", r.options.FontSize-1)
 			if r.options.Highlight {
 				r.pdf.SetFillColor(240, 240, 240)
 			}
 			code := string(n.Text(r.source))
-			r.pdf.Write(5, code)
-			r.pdf.SetFont(r.options.MainFont, r.currentFont(), r.options.FontSize)
+			r.write(code)
+			r.pdf.SetFont(mainFamily, r.currentFont(), r.options.FontSize)
 			return ast.WalkSkipChildren
 		}
 
 	case *ast.FencedCodeBlock:
 		if entering {
-			r.pdf.Ln(3)
-			r.pdf.SetFont(r.options.MonoFont, "", r.options.FontSize-1)
-			if r.options.Highlight {
-				r.pdf.SetFillColor(245, 245, 245)
-			}
-
-			lines := n.Lines()
-			for i := 0; i < lines.Len(); i++ {
-				line := lines.At(i)
-				r.pdf.MultiCell(0, 5, string(line.Value(r.source)), "", "", r.options.Highlight)
-			}
+			r.renderCode(string(n.Language(r.source)), codeText(n, r.source))
+			return ast.WalkSkipChildren
+		}
 
-			r.pdf.SetFont(r.options.MainFont, r.currentFont(), r.options.FontSize)
-			r.pdf.SetFillColor(255, 255, 255)
-			r.pdf.Ln(3)
+	case *ast.CodeBlock:
+		if entering {
+			r.renderCode("", codeText(n, r.source))
 			return ast.WalkSkipChildren
 		}
 
 	case *ast.Link:
 		if entering {
-			if r.options.ColorLinks {
-				r.pdf.SetTextColor(0, 0, 255)
-			}
+			r.startLink(string(n.Destination))
 		} else {
-			r.pdf.SetTextColor(0, 0, 0)
+			r.endLink()
+		}
+
+	case *ast.AutoLink:
+		if entering {
+			dest := string(n.URL(r.source))
+			if n.AutoLinkType == ast.AutoLinkEmail && !strings.HasPrefix(dest, "mailto:") {
+				dest = "mailto:" + dest
+			}
+			r.startLink(dest)
+			r.write(string(n.Label(r.source)))
+			r.endLink()
+		}
+
+	case *WikiLink:
+		if entering {
+			// only headings of this note, or of the notes bound with it, are in the pdf to link to
+			title := strings.TrimSuffix(filepath.Base(r.notePath), filepath.Ext(r.notePath))
+			if n.Fragment != "" && (n.Target == "" || strings.EqualFold(n.Target, title)) {
+				r.startLink("#" + n.Fragment)
+			} else if note := r.boundNote(n.Target); note != nil {
+				r.startNoteLink(note, n.Fragment)
+			}
+			r.write(n.Display())
+			r.endLink()
 		}
 
 	case *ast.Text:
@@ -267,35 +518,78 @@ func (r *pdfRenderer) render(node ast.Node, entering bool) ast.WalkStatus {
 				txt += " "
 			}
 
-			r.pdf.Write(5, txt)
+			r.write(txt)
+			if n.HardLineBreak() {
+				r.pdf.Ln(5)
+			}
 		}
 
 	case *ast.String:
 		if entering {
-			r.pdf.Write(5, string(n.Value))
+			r.write(string(n.Value))
 		}
 	}
 
 	return ast.WalkContinue
 }
 
-func (c *Converter) processMarkdown(pdf *gofpdf.Fpdf, content []byte) error {
+// parseMarkdown parses a note with the extensions the renderer understands
+func parseMarkdown(content []byte) ast.Node {
 	md := goldmark.New(
-		goldmark.WithExtensions(),
+		goldmark.WithExtensions(extension.GFM, obsidian{}),
 	)
 
 	reader := text.NewReader(content)
-	doc := md.Parser().Parse(reader)
+	return md.Parser().Parse(reader)
+}
+
+func (c *Converter) processMarkdown(pdf *gofpdf.Fpdf, options PDFOptions, notePath string, content []byte) error {
+	content = stripComments(content)
+	doc := parseMarkdown(content)
+
+	// every heading goes in the outline, the contents page needs a few to be worth it
+	toc := collectHeadings(doc, content)
+	toc.page = options.TOC && len(toc.entries) > 1
+	if toc.page {
+		// a first render finds the page numbers, the contents take the same pages both times
+		scratch := setupPDF(options)
+		if err := c.renderMarkdown(scratch, options, notePath, doc, content, toc); err != nil {
+			return err
+		}
+	}
+
+	return c.renderMarkdown(pdf, options, notePath, doc, content, toc)
+}
+
+func (c *Converter) renderMarkdown(pdf *gofpdf.Fpdf, options PDFOptions, notePath string, doc ast.Node, content []byte, toc *tableOfContents) error {
+	if c.vault == nil {
+		c.vault = &vault{}
+	}
 
+	toc.addLinks(pdf)
+	if toc.page {
+		toc.write(pdf, options)
+	}
+	return c.renderNote(pdf, options, notePath, doc, content, toc, nil)
+}
+
+// renderNote writes a parsed note where the pdf has got to, bound being the other
+// notes of a binder it can link to
+func (c *Converter) renderNote(pdf *gofpdf.Fpdf, options PDFOptions, notePath string, doc ast.Node, content []byte, toc *tableOfContents, bound map[string]*boundNote) error {
 	// gets initial left margin
 	lMargin, _, _, _ := pdf.GetMargins()
 
 	renderer := &pdfRenderer{
 		pdf:            pdf,
-		options:        c.options,
+		options:        options,
 		source:         content,
 		fontStack:      []string{},
 		baseLeftMargin: lMargin,
+		toc:            toc,
+		vault:          c.vault,
+		notePath:       notePath,
+		embeds:         []string{absPath(notePath)},
+		bound:          bound,
 	}
 
 	err := ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
@@ -305,30 +599,67 @@ func (c *Converter) processMarkdown(pdf *gofpdf.Fpdf, content []byte) error {
 	return err
 }
 
-func (c *Converter) MarkdownToPDF(mdPath string) (string, error) {
+// outputPath returns a new file in the temp dir for the pdf of mdPath, as notes of the
+// same name in different folders each need their own until the plan is applied
+func (c *Converter) outputPath(mdPath string) (string, error) {
 	title := strings.TrimSuffix(filepath.Base(mdPath), filepath.Ext(mdPath))
-	pdfPath := filepath.Join(c.TempDir, title+".pdf")
+	f, err := os.CreateTemp(c.TempDir, title+"-*.pdf")
+	if err != nil {
+		return "", fmt.Errorf("failed to create pdf: %w", err)
+	}
+	f.Close()
+	return f.Name(), nil
+}
+
+func (c *Converter) MarkdownToPDF(mdPath string) (string, error) {
+	pdfPath, err := c.outputPath(mdPath)
+	if err != nil {
+		return "", err
+	}
 
 	content, err := os.ReadFile(mdPath)
 	if err != nil {
 		return "", fmt.Errorf("failed to read markdown: %w", err)
 	}
 
-	pdf := c.setupPDF()
+	options, note, content, err := c.fileOptions(mdPath, content)
+	if err != nil {
+		return "", err
+	}
+	// in the font the frontmatter picks
+	content = fontText(content, options)
+	ext := strings.ToLower(filepath.Ext(mdPath))
+	var board *canvas
+	if ext == ".canvas" {
+		if board, err = parseCanvas(content, options); err != nil {
+			return "", err
+		}
+		options.landscape = board.wide()
+	}
+	info := c.noteInfo(mdPath, note)
+	options.Header, options.Footer = info.fillText(options.Header, options), info.fillText(options.Footer, options)
+
+	pdf := setupPDF(options)
+
+	// stamps the pdf with the source mtime so unchanged notes produce identical bytes
+	if info, err := os.Stat(mdPath); err == nil {
+		pdf.SetCreationDate(info.ModTime())
+		pdf.SetModificationDate(info.ModTime())
+		pdf.SetCatalogSort(true)
+	}
 
 	// don't add title separately / it's in the markdown as H1
 
 	// process content based on file type
-	ext := strings.ToLower(filepath.Ext(mdPath))
 	var processErr error
 
-	switch ext {
-	case ".yml", ".yaml":
-		processErr = c.processYAML(pdf, content)
-	case ".conf", ".ini", ".config":
-		processErr = c.processConfig(pdf, content)
+	switch {
+	case ext == ".canvas":
+		processErr = c.processCanvas(pdf, options, mdPath, board)
+	case IsSource(mdPath):
+		processErr = c.processSource(pdf, options, mdPath, content)
 	default:
-		processErr = c.processMarkdown(pdf, content)
+		processErr = c.processMarkdown(pdf, options, mdPath, content)
 	}
 
 	if processErr != nil {
@@ -343,6 +674,44 @@ func (c *Converter) MarkdownToPDF(mdPath string) (string, error) {
 	return pdfPath, nil
 }
 
+// fileOptions returns the options for path, which the frontmatter of a note can override,
+// and what's left of its content after the frontmatter
+func (c *Converter) fileOptions(path string, content []byte) (PDFOptions, NoteOptions, []byte, error) {
+	options := c.options
+	var note NoteOptions
+	if isNote(path) {
+		var err error
+		if note, content, err = parseNoteOptions(content); err != nil {
+			return options, note, nil, err
+		}
+		options = note.Apply(options)
+	}
+	return options, note, content, nil
+}
+
+// RenderHash fingerprints what goes into the pdf of path besides its own text, the options
+// it's rendered with and the files it embeds, so it's rendered again when they change
+func (c *Converter) RenderHash(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	options, _, content, err := c.fileOptions(path, content)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	if err := json.NewEncoder(h).Encode(options); err != nil {
+		return "", err
+	}
+	for _, dep := range c.dependencies(path, content) {
+		data, _ := os.ReadFile(dep)
+		fmt.Fprintf(h, "%s %x\n", dep, sha256.Sum256(data))
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
 // cleanupMarkdownText improves the extracted text quality
 func (c *Converter) cleanupMarkdownText(text string) string {
 	lines := strings.Split(text, "\n")
@@ -0,0 +1,174 @@
+package convert
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/jung-kurt/gofpdf"
+	"github.com/yuin/goldmark/ast"
+)
+
+// renderPDF renders markdown source to an uncompressed pdf, to search it for text and annotations
+func renderPDF(t *testing.T, options PDFOptions, source string) (*gofpdf.Fpdf, string) {
+	t.Helper()
+	converter := &Converter{options: options}
+	pdf := setupPDF(options)
+	pdf.SetCompression(false)
+	if err := converter.processMarkdown(pdf, options, "note", []byte(source)); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := pdf.Output(&out); err != nil {
+		t.Fatal(err)
+	}
+	return pdf, out.String()
+}
+
+// pdfText is text the way gofpdf writes it in a unicode font: utf-16, with ( ) and \ escaped
+func pdfText(s string) string {
+	var b strings.Builder
+	for _, u := range utf16.Encode([]rune(s)) {
+		for _, c := range []byte{byte(u >> 8), byte(u)} {
+			if c == '(' || c == ')' || c == '\\' {
+				b.WriteByte('\\')
+			}
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// tj is a run of text shown on a page
+func tj(s string) string {
+	return "(" + pdfText(s) + ")Tj"
+}
+
+func TestLinks(t *testing.T) {
+	options := DefaultPDFOptions()
+	options.TOC = false
+	source := "# Intro\n\nSee [the site](https://example.com/a), <https://example.org> and [below](#second-part).\n\n" +
+		"Also [[#Second part]], [[note#Intro|the intro]], [[Other note]] and [a file](other.md).\n\n## Second part\n"
+	_, data := renderPDF(t, options, source)
+
+	for _, want := range []string{"/URI (https://example.com/a)", "/URI (https://example.org)", tj("Other note")} {
+		if !strings.Contains(data, want) {
+			t.Errorf("pdf is missing %s", want)
+		}
+	}
+	if strings.Contains(data, pdfText("other.md")) || strings.Contains(data, pdfText("[[")) {
+		t.Error("unresolvable link rendered as a link or raw")
+	}
+	// #second-part, [[#Second part]] and [[note#Intro]]
+	if n := strings.Count(data, "/Border [0 0 0] /Dest"); n != 3 {
+		t.Errorf("got %d internal links, want 3", n)
+	}
+}
+
+func TestSlugs(t *testing.T) {
+	source := []byte("# Set up\n\n## Set up\n\n## What's new?\n")
+	pdf := setupPDF(DefaultPDFOptions())
+	toc := collectHeadings(parseMarkdown(source), source)
+	toc.addLinks(pdf)
+
+	if got := []string{toc.entries[0].slug, toc.entries[1].slug, toc.entries[2].slug}; strings.Join(got, " ") != "set-up set-up-1 whats-new" {
+		t.Errorf("slugs = %v", got)
+	}
+	if toc.anchor("set-up-1") != toc.entries[1].link || toc.anchor("What's%20new?") != toc.entries[2].link {
+		t.Error("anchors resolved to the wrong heading")
+	}
+	if toc.anchor("missing") != 0 {
+		t.Error("missing anchor resolved")
+	}
+}
+
+func TestGFM(t *testing.T) {
+	options := DefaultPDFOptions()
+	options.TOC = false
+	source := "| Name | Qty |\n|:-----|----:|\n| apples | 3 |\n| ~~pears~~ | 12 |\n\n" +
+		"- [ ] todo\n- [x] done\n\nVisit www.example.com or mail me@example.com\n"
+	_, data := renderPDF(t, options, source)
+
+	for _, want := range []string{tj("Name"), tj("Qty"), tj("apples"), tj("pears"), tj("todo"),
+		"/URI (http://www.example.com)", "/URI (mailto:me@example.com)"} {
+		if !strings.Contains(data, want) {
+			t.Errorf("pdf is missing %s", want)
+		}
+	}
+	for _, raw := range []string{"|", "~~", "[ ]", "[x]"} {
+		if strings.Contains(data, pdfText(raw)+")Tj") || strings.Contains(data, "("+pdfText(raw)) {
+			t.Errorf("markdown syntax %q rendered as text", raw)
+		}
+	}
+}
+
+func TestColumnWidths(t *testing.T) {
+	options := DefaultPDFOptions()
+	r := &pdfRenderer{pdf: setupPDF(options), options: options}
+	lMargin, _, rMargin, _ := r.pdf.GetMargins()
+	pageW, _ := r.pdf.GetPageSize()
+	available := pageW - lMargin - rMargin
+
+	// narrow tables keep their natural widths
+	narrow := r.columnWidths([][]tableCell{{{text: "a"}, {text: "b"}}}, 2)
+	if narrow[0]+narrow[1] >= available/2 {
+		t.Errorf("narrow table stretched to %v", narrow)
+	}
+
+	// a long column wraps, the short one keeps its width
+	long := strings.Repeat("word ", 100)
+	wide := r.columnWidths([][]tableCell{{{text: "id"}, {text: long}}}, 2)
+	if total := wide[0] + wide[1]; total > available+0.01 {
+		t.Errorf("table is %.1fmm wide, page has %.1fmm", total, available)
+	}
+	if wide[0] > 20 {
+		t.Errorf("short column widened to %.1fmm", wide[0])
+	}
+}
+
+func TestBlocks(t *testing.T) {
+	options := DefaultPDFOptions()
+	options.TOC = false
+	source := "3. three\n4. four\n   1. inner\n   - dot\n     - circle\n\n" +
+		"> quoted\n\n---\n\nfirst\\\nsecond\n\n" +
+		"H<sub>2</sub>O, x<sup>2</sup>, <kbd>Ctrl</kbd> and a<br>break\n\n" +
+		"<div>\n<p>block <b>html</b> &amp; more</p>\n</div>\n\n<!-- hidden -->\n"
+	_, data := renderPDF(t, options, source)
+
+	for _, want := range []string{"3.", "4.", "1.", "◦", "▪", "quoted", "first", "second", "2", "Ctrl", "break", "block html & more"} {
+		if !strings.Contains(data, tj(want)) {
+			t.Errorf("pdf is missing %s", want)
+		}
+	}
+	for _, unwanted := range []string{"hidden", "<sub>", "<div>", "\\"} {
+		if strings.Contains(data, pdfText(unwanted)) {
+			t.Errorf("pdf has %s", unwanted)
+		}
+	}
+}
+
+func TestInlineHTMLTags(t *testing.T) {
+	options := DefaultPDFOptions()
+	source := []byte("<b>open\n\n</i>stray close then <i>x</i>\n\n<b><i>both</b> italic</i>\n\n<sup>up\n\nplain\n")
+	r := &pdfRenderer{pdf: setupPDF(options), options: options, source: source, toc: &tableOfContents{}}
+
+	// the style each piece of text is written in, and whether it's raised
+	var got []string
+	ast.Walk(parseMarkdown(source), func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		status := r.render(node, entering)
+		if text, ok := node.(*ast.Text); ok && entering {
+			got = append(got, fmt.Sprintf("%s:%s%d", text.Segment.Value(source), r.currentFont(), r.script))
+		}
+		return status, nil
+	})
+	want := []string{"open:B0", "stray close then :0", "x:I0", "both:BI0", " italic:I0", "up:1", "plain:0"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if len(r.openTags) != 0 || len(r.fontStack) != 0 {
+		t.Errorf("left open: %v, fonts %v", r.openTags, r.fontStack)
+	}
+}
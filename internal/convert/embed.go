@@ -0,0 +1,267 @@
+package convert
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+// notes embedding notes embedding notes stop here
+const maxEmbedDepth = 4
+
+// panel is where an indented block started, its rule is drawn once its end is known
+type panel struct {
+	page        int
+	y           float64
+	left, right float64 // indentation
+	framed      bool    // a box around it as well as the rule down the left
+}
+
+// startPanel indents what follows so a rule, and a frame if framed, can be drawn beside it
+func (r *pdfRenderer) startPanel(framed bool) {
+	r.pdf.Ln(2)
+	p := panel{page: r.pdf.PageNo(), y: r.pdf.GetY(), left: 4, framed: framed}
+	if framed {
+		p.right = 2
+	}
+	r.panels = append(r.panels, p)
+
+	lMargin, _, rMargin, _ := r.pdf.GetMargins()
+	r.pdf.SetLeftMargin(lMargin + p.left)
+	r.pdf.SetRightMargin(rMargin + p.right)
+	r.baseLeftMargin += p.left
+	r.pdf.SetY(r.pdf.GetY() + 2)
+}
+
+// endPanel draws the rule and frame beside everything since the matching startPanel,
+// on every page it covers
+func (r *pdfRenderer) endPanel() {
+	start := r.panels[len(r.panels)-1]
+	r.panels = r.panels[:len(r.panels)-1]
+
+	lMargin, tMargin, rMargin, _ := r.pdf.GetMargins()
+	lMargin, rMargin = lMargin-start.left, rMargin-start.right
+	r.pdf.SetLeftMargin(lMargin)
+	r.pdf.SetRightMargin(rMargin)
+	r.baseLeftMargin -= start.left
+
+	pageW, pageH := r.pdf.GetPageSize()
+	_, bottom := r.pdf.GetAutoPageBreak()
+	endPage, endY := r.pdf.PageNo(), r.pdf.GetY()+1
+	r.pdf.SetFillColor(150, 150, 150)
+	for page := start.page; page <= endPage; page++ {
+		top, end := tMargin, pageH-bottom
+		if page == start.page {
+			top = start.y
+		}
+		if page == endPage {
+			end = endY
+		}
+		r.pdf.SetPage(page)
+		if start.framed {
+			r.pdf.Rect(lMargin, top, pageW-lMargin-rMargin, end-top, "D")
+		}
+		r.pdf.Rect(lMargin, top, 1.2, end-top, "F")
+	}
+	r.pdf.SetPage(endPage)
+	r.pdf.SetFillColor(255, 255, 255)
+
+	r.pdf.SetY(endY)
+	r.pdf.Ln(3)
+}
+
+var words = regexp.MustCompile(`\S+\s*|\s+`)
+
+// writeHighlighted writes text word by word over a shaded band, wrapping like Write
+func (r *pdfRenderer) writeHighlighted(txt string) {
+	lMargin, _, rMargin, _ := r.pdf.GetMargins()
+	pageW, pageH := r.pdf.GetPageSize()
+	_, bottom := r.pdf.GetAutoPageBreak()
+
+	r.pdf.SetFillColor(215, 215, 215)
+	for _, word := range words.FindAllString(txt, -1) {
+		if r.pdf.GetX()+r.pdf.GetStringWidth(strings.TrimRight(word, " ")) > pageW-rMargin && r.pdf.GetX() > lMargin {
+			r.pdf.Ln(5)
+			if r.pdf.GetY()+5 > pageH-bottom {
+				r.pdf.AddPage()
+			}
+			word = strings.TrimLeft(word, " ")
+		}
+		r.pdf.Rect(r.pdf.GetX(), r.pdf.GetY()+0.3, r.pdf.GetStringWidth(word), 4.4, "F")
+		r.writeText(word)
+	}
+	r.pdf.SetFillColor(255, 255, 255)
+}
+
+// embed transcludes an embedded note, or a section of it, inside a frame, or draws
+// an embedded image; embeds that can't be shown are written as their name
+func (r *pdfRenderer) embed(n *Embed) {
+	if isImage(n.Target) {
+		if path, ok := r.vault.attachment(n.Target, r.notePath); ok && r.drawImage(path, imageWidth(n.Label)) {
+			return
+		}
+		if imageWidth(n.Label) > 0 {
+			r.write(n.Target)
+		} else {
+			r.write(n.Display())
+		}
+		return
+	}
+
+	path, ok := r.notePath, n.Target == ""
+	if !ok {
+		path, ok = r.vault.resolve(n.Target, r.notePath)
+	}
+	if !ok || !strings.EqualFold(filepath.Ext(path), ".md") || !r.transclude(path, n.Fragment) {
+		r.write(n.Display())
+	}
+}
+
+// transclude renders a note's blocks in place and reports whether there was anything to render
+func (r *pdfRenderer) transclude(path, fragment string) bool {
+	path = absPath(path)
+	if len(r.embeds) > maxEmbedDepth {
+		return false
+	}
+	for _, open := range r.embeds {
+		// a note embedding itself whole would never end
+		if open == path && fragment == "" {
+			return false
+		}
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	_, body, _ := parseNoteOptions(content)
+	body = stripComments(fontText(body, r.options))
+	doc := parseMarkdown(body)
+	nodes := section(doc, body, fragment)
+	if len(nodes) == 0 {
+		return false
+	}
+
+	// images and #links inside resolve against the embedded note, as they would in it
+	toc := collectHeadings(doc, body)
+	toc.embedded = true
+	toc.addSectionLinks(r.pdf, nodes)
+
+	source, notePath, outer := r.source, r.notePath, r.toc
+	r.source, r.notePath, r.toc = body, path, toc
+	r.embeds = append(r.embeds, path)
+	r.startPanel(true)
+	for _, node := range nodes {
+		ast.Walk(node, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+			return r.render(node, entering), nil
+		})
+	}
+	r.endPanel()
+	r.embeds = r.embeds[:len(r.embeds)-1]
+	r.source, r.notePath, r.toc = source, notePath, outer
+	return true
+}
+
+// section returns the top level blocks of doc under the heading fragment names,
+// up to the next heading as high; all of them for an empty fragment
+func section(doc ast.Node, source []byte, fragment string) []ast.Node {
+	var nodes []ast.Node
+	level := 0
+	for node := doc.FirstChild(); node != nil; node = node.NextSibling() {
+		heading, isHeading := node.(*ast.Heading)
+		switch {
+		case fragment == "":
+			nodes = append(nodes, node)
+		case level == 0:
+			if isHeading && slug(plainText(heading, source)) == slug(fragment) {
+				level = heading.Level
+				nodes = append(nodes, node)
+			}
+		case isHeading && heading.Level <= level:
+			return nodes
+		default:
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// dependencies returns the files besides path that go into its pdf, as absolute paths: the
+// images and notes it embeds, and theirs in turn, or the files on a canvas' cards
+// content is what's left of path after its frontmatter
+func (c *Converter) dependencies(path string, content []byte) []string {
+	if c.vault == nil {
+		c.vault = &vault{}
+	}
+	seen := map[string]bool{absPath(path): true}
+	var deps []string
+	add := func(dep string) bool {
+		dep = absPath(dep)
+		if seen[dep] {
+			return false
+		}
+		seen[dep] = true
+		deps = append(deps, dep)
+		return true
+	}
+
+	switch {
+	case strings.EqualFold(filepath.Ext(path), ".canvas"):
+		if board, err := parseCanvas(content, c.options); err == nil {
+			for _, n := range board.Nodes {
+				if dep, ok := c.vault.resolve(n.File, path); ok && n.Type == "file" {
+					add(dep)
+				}
+			}
+		}
+	case !IsSource(path):
+		c.noteDependencies(path, content, 0, add)
+	}
+	return deps
+}
+
+// noteDependencies passes the images and notes a note embeds to add, following the notes
+// add hasn't seen before as deep as they're rendered
+func (c *Converter) noteDependencies(path string, content []byte, depth int, add func(string) bool) {
+	var embeds []string
+	ast.Walk(parseMarkdown(stripComments(content)), func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := node.(type) {
+		case *Embed:
+			if isImage(n.Target) {
+				if dep, ok := c.vault.attachment(n.Target, path); ok {
+					add(dep)
+				}
+			} else if dep, ok := c.vault.resolve(n.Target, path); ok && strings.EqualFold(filepath.Ext(dep), ".md") && add(dep) {
+				embeds = append(embeds, dep)
+			}
+		case *ast.Image:
+			if dep, ok := c.vault.imagePath(string(n.Destination), path); ok {
+				add(dep)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+
+	if depth >= maxEmbedDepth {
+		return
+	}
+	for _, embed := range embeds {
+		if data, err := os.ReadFile(embed); err == nil {
+			_, body, _ := parseNoteOptions(data)
+			c.noteDependencies(embed, body, depth+1, add)
+		}
+	}
+}
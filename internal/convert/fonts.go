@@ -0,0 +1,313 @@
+package convert
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/jung-kurt/gofpdf"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gobolditalic"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/gofont/gomonobolditalic"
+	"golang.org/x/image/font/gofont/gomonoitalic"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/text/unicode/norm"
+)
+
+// the families every pdf registers, whatever fonts the options name
+const (
+	mainFamily = "main"
+	monoFamily = "mono"
+	mathFamily = "math"
+)
+
+// mathFonts are tried in turn for formulas when no math font is given, as they have
+// the symbols most text fonts lack; without any the main font stands in
+var mathFonts = []string{"DejaVu Sans", "Noto Sans Math", "FreeSerif", "Apple Symbols"}
+
+// fontFamily is a font's TrueType data by gofpdf style: "", "B", "I" and "BI"
+type fontFamily map[string][]byte
+
+// the Go fonts ship in the binary, for names that can't be found
+var (
+	bundledMain = fontFamily{"": goregular.TTF, "B": gobold.TTF, "I": goitalic.TTF, "BI": gobolditalic.TTF}
+	bundledMono = fontFamily{"": gomono.TTF, "B": gomonobold.TTF, "I": gomonoitalic.TTF, "BI": gomonobolditalic.TTF}
+)
+
+var (
+	fontMu     sync.Mutex
+	fontCache  = map[string]fontFamily{}
+	glyphCache = map[*byte]*sfnt.Font{}
+)
+
+// loadFonts registers the main, mono and math fonts of options with pdf, as unicode fonts
+// a font file that can't be used leaves the error on pdf
+func loadFonts(pdf *gofpdf.Fpdf, options PDFOptions) {
+	main, err := familyOf(options.MainFont, bundledMain)
+	if err != nil {
+		pdf.SetError(err)
+		return
+	}
+	mono, err := familyOf(options.MonoFont, bundledMono)
+	if err != nil {
+		pdf.SetError(err)
+		return
+	}
+	math, err := mathFont(options)
+	if err != nil {
+		pdf.SetError(err)
+		return
+	}
+	for _, f := range []struct {
+		family string
+		fonts  fontFamily
+	}{{mainFamily, main}, {monoFamily, mono}, {mathFamily, math}} {
+		for _, style := range []string{"", "B", "I", "BI"} {
+			pdf.AddUTF8FontFromBytes(f.family, style, f.fonts.style(style))
+		}
+	}
+}
+
+// familyOf finds a font by name, the fallback standing in when there's no such font
+func familyOf(name string, fallback fontFamily) (fontFamily, error) {
+	fonts, err := findFont(name)
+	if fonts == nil && err == nil {
+		fonts = fallback
+	}
+	return fonts, err
+}
+
+// mathFont is the font formulas are set in: the one options name, else the first
+// of mathFonts installed, else the main font
+func mathFont(options PDFOptions) (fontFamily, error) {
+	if options.MathFont != "" {
+		return familyOf(options.MathFont, bundledMain)
+	}
+	for _, name := range mathFonts {
+		if fonts, err := findFont(name); err == nil && fonts != nil {
+			return fonts, nil
+		}
+	}
+	return familyOf(options.MainFont, bundledMain)
+}
+
+// glyphs reads a font's outlines, to tell which characters it has and how tall they are;
+// nil for data it can't read
+func glyphs(data []byte) *sfnt.Font {
+	if len(data) == 0 {
+		return nil
+	}
+	fontMu.Lock()
+	defer fontMu.Unlock()
+	if f, ok := glyphCache[&data[0]]; ok {
+		return f
+	}
+	f, _ := sfnt.Parse(data)
+	glyphCache[&data[0]] = f
+	return f
+}
+
+// style is the data for a style, standing in the closest one the family has
+func (f fontFamily) style(style string) []byte {
+	for _, s := range map[string][]string{"": {""}, "B": {"B", ""}, "I": {"I", ""}, "BI": {"BI", "B", "I", ""}}[style] {
+		if data, ok := f[s]; ok {
+			return data
+		}
+	}
+	return nil
+}
+
+// findFont loads a font given as a file or as a family name installed on the system,
+// nil when there's no such font
+func findFont(name string) (fontFamily, error) {
+	if name == "" {
+		return nil, nil
+	}
+	fontMu.Lock()
+	defer fontMu.Unlock()
+	if fonts, ok := fontCache[name]; ok {
+		return fonts, nil
+	}
+
+	var paths map[string]string
+	if isFontFile(name) {
+		if _, err := os.Stat(name); err != nil {
+			return nil, fmt.Errorf("font not found: %w", err)
+		}
+		// the other styles sit next to the regular one, DejaVuSans.ttf and DejaVuSans-Bold.ttf
+		family := strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+		family = strings.TrimSuffix(normalizeFontName(family), "regular")
+		paths = familyFiles([]string{filepath.Dir(name)}, family, false)
+		paths[""] = name
+	} else {
+		paths = familyFiles(systemFontDirs(), normalizeFontName(name), true)
+		if paths[""] == "" {
+			fontCache[name] = nil
+			return nil, nil
+		}
+	}
+
+	fonts := fontFamily{}
+	for style, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read font: %w", err)
+		}
+		if !isTrueType(data) {
+			if style == "" {
+				return nil, fmt.Errorf("%s: only TrueType outlines are supported", path)
+			}
+			continue
+		}
+		fonts[style] = data
+	}
+	fontCache[name] = fonts
+	return fonts, nil
+}
+
+// fontText makes content writable in the main font of options: gofpdf only encodes
+// characters up to U+FFFF, so one past it, like most emoji, is written as its plainer form
+// when it has one the font covers, 𝐀 or 🄰 as A, and as U+FFFD, or ? in a font without
+// that either, when it hasn't
+func fontText(content []byte, options PDFOptions) []byte {
+	if !hasWide(string(content)) {
+		return content
+	}
+	var f *sfnt.Font
+	if fonts, err := familyOf(options.MainFont, bundledMain); err == nil {
+		f = glyphs(fonts.style(""))
+	}
+	var buf sfnt.Buffer
+	has := func(s string) bool {
+		if f == nil {
+			// a font that can't be read is trusted to have everything
+			return true
+		}
+		for _, r := range s {
+			if i, err := f.GlyphIndex(&buf, r); err != nil || i == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	replacement := string(unicode.ReplacementChar)
+	if !has(replacement) {
+		replacement = "?"
+	}
+
+	var b bytes.Buffer
+	for _, r := range string(content) {
+		if r <= 0xffff {
+			b.WriteRune(r)
+			continue
+		}
+		if plain := norm.NFKC.String(string(r)); plain != string(r) && !hasWide(plain) && has(plain) {
+			b.WriteString(plain)
+		} else {
+			b.WriteString(replacement)
+		}
+	}
+	return b.Bytes()
+}
+
+// hasWide reports whether s has characters past U+FFFF
+func hasWide(s string) bool {
+	for _, r := range s {
+		if r > 0xffff {
+			return true
+		}
+	}
+	return false
+}
+
+func isFontFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".ttf", ".otf":
+		return true
+	}
+	return false
+}
+
+// isTrueType tells TrueType fonts, which gofpdf reads, from CFF based OpenType ones, which it doesn't
+func isTrueType(data []byte) bool {
+	return bytes.HasPrefix(data, []byte{0, 1, 0, 0}) || bytes.HasPrefix(data, []byte("true"))
+}
+
+// normalizeFontName lowercases a font or file name and drops spaces, dashes and underscores
+func normalizeFontName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' || r == '_' {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, name)
+}
+
+// fontStyles maps what follows the family in a font's file name to its style,
+// covering "DejaVuSans-BoldOblique.ttf", "Arial Bold Italic.ttf" and windows' "arialbi.ttf"
+var fontStyles = map[string]string{
+	"": "", "regular": "", "book": "", "roman": "", "normal": "",
+	"bold": "B", "bd": "B", "b": "B",
+	"italic": "I", "oblique": "I", "it": "I", "i": "I",
+	"bolditalic": "BI", "boldoblique": "BI", "bi": "BI", "z": "BI",
+}
+
+// familyFiles finds the font files of a family in dirs by style, the first found winning
+func familyFiles(dirs []string, family string, recursive bool) map[string]string {
+	var files []string
+	for _, dir := range dirs {
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() && path != dir && !recursive {
+				return filepath.SkipDir
+			}
+			if !d.IsDir() && isFontFile(path) {
+				files = append(files, path)
+			}
+			return nil
+		})
+	}
+	// shortest paths first, so a family's own files beat look-alikes deeper down
+	sort.SliceStable(files, func(i, j int) bool { return len(files[i]) < len(files[j]) })
+
+	paths := map[string]string{}
+	for _, path := range files {
+		name := normalizeFontName(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+		rest, ok := strings.CutPrefix(name, family)
+		if !ok {
+			continue
+		}
+		if style, ok := fontStyles[rest]; ok && paths[style] == "" {
+			paths[style] = path
+		}
+	}
+	return paths
+}
+
+// systemFontDirs lists where the platform keeps installed fonts
+func systemFontDirs() []string {
+	home, _ := os.UserHomeDir()
+	switch runtime.GOOS {
+	case "darwin":
+		return []string{"/System/Library/Fonts", "/Library/Fonts", filepath.Join(home, "Library", "Fonts")}
+	case "windows":
+		return []string{
+			filepath.Join(os.Getenv("WINDIR"), "Fonts"),
+			filepath.Join(os.Getenv("LOCALAPPDATA"), "Microsoft", "Windows", "Fonts"),
+		}
+	}
+	return []string{"/usr/share/fonts", "/usr/local/share/fonts", filepath.Join(home, ".local", "share", "fonts"), filepath.Join(home, ".fonts")}
+}
@@ -0,0 +1,95 @@
+package convert
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func TestFamilyFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"DejaVuSans.ttf", "DejaVuSans-Bold.ttf", "DejaVuSans-Oblique.ttf", "DejaVuSans-BoldOblique.ttf",
+		"DejaVuSansMono.ttf", "DejaVuSansCondensed-Bold.ttf",
+		"arial.ttf", "arialbd.ttf", "arialbi.ttf", "arialn.ttf", "notes.txt",
+	} {
+		os.WriteFile(filepath.Join(dir, name), nil, 0644)
+	}
+
+	tests := []struct {
+		family string
+		want   map[string]string
+	}{
+		{"DejaVu Sans", map[string]string{"": "DejaVuSans.ttf", "B": "DejaVuSans-Bold.ttf", "I": "DejaVuSans-Oblique.ttf", "BI": "DejaVuSans-BoldOblique.ttf"}},
+		{"Arial", map[string]string{"": "arial.ttf", "B": "arialbd.ttf", "BI": "arialbi.ttf"}},
+		{"Missing", map[string]string{}},
+	}
+	for _, tt := range tests {
+		got := familyFiles([]string{dir}, normalizeFontName(tt.family), true)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.family, got, tt.want)
+			continue
+		}
+		for style, name := range tt.want {
+			if got[style] != filepath.Join(dir, name) {
+				t.Errorf("%s %q: got %s, want %s", tt.family, style, got[style], name)
+			}
+		}
+	}
+}
+
+func TestFindFontFile(t *testing.T) {
+	dir := t.TempDir()
+	regular := filepath.Join(dir, "Custom-Regular.ttf")
+	os.WriteFile(regular, goregular.TTF, 0644)
+	os.WriteFile(filepath.Join(dir, "Custom-Bold.ttf"), gobold.TTF, 0644)
+	cff := filepath.Join(dir, "Cff.otf")
+	os.WriteFile(cff, []byte("OTTO\x00\x0a"), 0644)
+
+	fonts, err := findFont(regular)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fonts) != 2 || len(fonts.style("BI")) != len(gobold.TTF) || len(fonts.style("I")) != len(goregular.TTF) {
+		t.Errorf("got %d styles, want regular and bold standing in for the rest", len(fonts))
+	}
+
+	if _, err := findFont(cff); err == nil {
+		t.Error("cff font accepted")
+	}
+	if fonts, err := findFont("No Such Font Family"); fonts != nil || err != nil {
+		t.Errorf("got %v, %v for a missing family, want the fallback", fonts, err)
+	}
+
+	// a font file that can't be used fails the conversion
+	options := DefaultPDFOptions()
+	options.MainFont = filepath.Join(dir, "missing.ttf")
+	if err := setupPDF(options).Error(); err == nil {
+		t.Error("missing font file didn't fail")
+	}
+}
+
+func TestUnicodeText(t *testing.T) {
+	options := DefaultPDFOptions()
+	options.TOC = false
+	_, data := renderPDF(t, options, "# Zoë’s café\n\nnaïve — Ελληνικά, Русский\n\n- item\n")
+
+	for _, want := range []string{"Zoë’s", "café", "naïve —", "Ελληνικά", "Русский"} {
+		if !strings.Contains(data, pdfText(want)) {
+			t.Errorf("pdf is missing %s", want)
+		}
+	}
+	if !strings.Contains(data, tj("•")) {
+		t.Error("list bullet missing")
+	}
+
+	// past U+FFFF gofpdf can't go, so the plain letters stand in for math ones and
+	// the rest are replaced
+	if got := string(fontText([]byte("ok 😀 ✓ 𝐀𝑏 🄰"), options)); got != "ok � ✓ Ab A" {
+		t.Errorf("fontText = %q", got)
+	}
+}
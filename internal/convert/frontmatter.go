@@ -0,0 +1,151 @@
+package convert
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// NoteOptions are the per-note settings under the "remarkable" key of a note's frontmatter, e.g.
+//
+//	remarkable: {folder: "Reading/Books", pagesize: Letter, fontsize: 13, toc: false}
+//
+// anything left out falls back to the command line
+type NoteOptions struct {
+	Folder      string  `yaml:"folder"` // tablet folder, replaces --folder
+	PageSize    string  `yaml:"pagesize"`
+	FontSize    float64 `yaml:"fontsize"`
+	Margins     float64 `yaml:"margins"`
+	MainFont    string  `yaml:"font"`
+	MonoFont    string  `yaml:"monofont"`
+	MathFont    string  `yaml:"mathfont"`
+	ColorLinks  *bool   `yaml:"colorlinks"`
+	TOC         *bool   `yaml:"toc"`
+	Highlight   *bool   `yaml:"highlight"`
+	Grayscale   *bool   `yaml:"grayscale"`
+	LineNumbers *bool   `yaml:"linenumbers"`
+	Header      *string `yaml:"header"` // "" for none
+	Footer      *string `yaml:"footer"`
+	Sync        *bool   `yaml:"sync"` // false keeps the note off the tablet
+
+	// from the top level of the frontmatter, for headers and footers
+	Title string   `yaml:"-"`
+	Tags  []string `yaml:"-"`
+	Order *float64 `yaml:"-"` // place in a binder ordered by frontmatter
+}
+
+// Skip reports whether the note opted out with sync: false
+func (n NoteOptions) Skip() bool {
+	return n.Sync != nil && !*n.Sync
+}
+
+// Apply overrides options with whatever the note sets
+func (n NoteOptions) Apply(options PDFOptions) PDFOptions {
+	if n.PageSize != "" {
+		options.PageSize = n.PageSize
+		// a device brings its margins and font size, which the note and the command line
+		// can still set
+		if profile, ok := LookupProfile(n.PageSize); ok {
+			options = profile.Apply(options)
+		}
+	}
+	if n.FontSize > 0 {
+		options.FontSize = n.FontSize
+	}
+	if n.Margins > 0 {
+		options.Margins = n.Margins
+	}
+	if n.MainFont != "" {
+		options.MainFont = n.MainFont
+	}
+	if n.MonoFont != "" {
+		options.MonoFont = n.MonoFont
+	}
+	if n.MathFont != "" {
+		options.MathFont = n.MathFont
+	}
+	if n.ColorLinks != nil {
+		options.ColorLinks = *n.ColorLinks
+	}
+	if n.TOC != nil {
+		options.TOC = *n.TOC
+	}
+	if n.Highlight != nil {
+		options.Highlight = *n.Highlight
+	}
+	if n.Grayscale != nil {
+		options.Grayscale = *n.Grayscale
+	}
+	if n.LineNumbers != nil {
+		options.LineNumbers = *n.LineNumbers
+	}
+	if n.Header != nil {
+		options.Header = *n.Header
+	}
+	if n.Footer != nil {
+		options.Footer = *n.Footer
+	}
+	return options
+}
+
+// splitFrontmatter separates a leading "---" yaml block from the markdown after it
+// front is nil when there's no frontmatter
+func splitFrontmatter(content []byte) (front, body []byte) {
+	first, rest, _ := bytes.Cut(bytes.TrimPrefix(content, []byte("\ufeff")), []byte("\n"))
+	if string(bytes.TrimSpace(first)) != "---" {
+		return nil, content
+	}
+
+	for start := 0; start < len(rest); {
+		next := len(rest)
+		if i := bytes.IndexByte(rest[start:], '\n'); i >= 0 {
+			next = start + i + 1
+		}
+		if line := string(bytes.TrimSpace(rest[start:next])); line == "---" || line == "..." {
+			return rest[:start], rest[next:]
+		}
+		start = next
+	}
+	// never closed, so it's just markdown
+	return nil, content
+}
+
+// parseNoteOptions reads the remarkable settings out of the frontmatter of content
+// and returns the markdown body without it
+func parseNoteOptions(content []byte) (NoteOptions, []byte, error) {
+	front, body := splitFrontmatter(content)
+	if front == nil {
+		return NoteOptions{}, body, nil
+	}
+
+	var fm struct {
+		Remarkable NoteOptions `yaml:"remarkable"`
+		Title      string      `yaml:"title"`
+		Tags       tagList     `yaml:"tags"`
+		Order      *float64    `yaml:"order"`
+	}
+	if err := yaml.Unmarshal(front, &fm); err != nil {
+		return NoteOptions{}, body, fmt.Errorf("failed to parse frontmatter: %w", err)
+	}
+	fm.Remarkable.Title, fm.Remarkable.Tags, fm.Remarkable.Order = fm.Title, fm.Tags, fm.Order
+	return fm.Remarkable, body, nil
+}
+
+// ReadNoteOptions returns the remarkable settings in a note's frontmatter, none for files
+// that aren't notes
+func ReadNoteOptions(mdPath string) (NoteOptions, error) {
+	if !isNote(mdPath) {
+		return NoteOptions{}, nil
+	}
+	content, err := os.ReadFile(mdPath)
+	if err != nil {
+		return NoteOptions{}, fmt.Errorf("failed to read markdown: %w", err)
+	}
+	note, _, err := parseNoteOptions(content)
+	if err != nil {
+		return NoteOptions{}, fmt.Errorf("%s: %w", mdPath, err)
+	}
+	return note, nil
+}
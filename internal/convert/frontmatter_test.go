@@ -0,0 +1,85 @@
+package convert
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseNoteOptions(t *testing.T) {
+	content := "---\ntitle: Dune\ntags: [books]\nremarkable: {folder: \"Reading/Books\", pagesize: Letter, fontsize: 13, toc: false, sync: false}\n---\n# Dune\n"
+	note, body, err := parseNoteOptions([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "# Dune\n" {
+		t.Errorf("body = %q", body)
+	}
+	if note.Folder != "Reading/Books" || note.PageSize != "Letter" || note.FontSize != 13 || !note.Skip() {
+		t.Errorf("note options = %+v", note)
+	}
+
+	options := note.Apply(DefaultPDFOptions())
+	if options.PageSize != "Letter" || options.FontSize != 13 || options.TOC {
+		t.Errorf("applied options = %+v", options)
+	}
+	// unset fields keep the command line value
+	if options.Margins != 20 || !options.ColorLinks || options.MainFont != "Arial" {
+		t.Errorf("unset options changed: %+v", options)
+	}
+}
+
+func TestSplitFrontmatter(t *testing.T) {
+	tests := []struct {
+		name, content, front, body string
+	}{
+		{"none", "# Title\n---\n", "", "# Title\n---\n"},
+		{"empty", "---\n---\ntext", "", "text"},
+		{"dots", "---\na: 1\n...\ntext", "a: 1\n", "text"},
+		{"crlf", "---\r\na: 1\r\n---\r\ntext", "a: 1\r\n", "text"},
+		{"unclosed", "---\na: 1\n", "", "---\na: 1\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			front, body := splitFrontmatter([]byte(tt.content))
+			if string(front) != tt.front || string(body) != tt.body {
+				t.Errorf("split = %q, %q", front, body)
+			}
+		})
+	}
+}
+
+func TestReadNoteOptionsInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "note.md")
+	if err := os.WriteFile(path, []byte("---\nremarkable: [\n---\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadNoteOptions(path); err == nil || !strings.Contains(err.Error(), "frontmatter") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestMarkdownToPDFPageSize(t *testing.T) {
+	converter, err := NewConverter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer converter.Close()
+
+	path := filepath.Join(t.TempDir(), "note.md")
+	if err := os.WriteFile(path, []byte("---\nremarkable: {pagesize: Letter}\n---\n# Note\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pdfPath, err := converter.MarkdownToPDF(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(pdfPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "/MediaBox [0 0 612.00 792.00]") {
+		t.Error("frontmatter page size wasn't used")
+	}
+}
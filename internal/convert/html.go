@@ -0,0 +1,140 @@
+package convert
+
+import (
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+var (
+	htmlTag     = regexp.MustCompile(`^<(/?)([a-zA-Z][a-zA-Z0-9]*)\b[^>]*>$`)
+	htmlTags    = regexp.MustCompile(`(?s)<!--.*?-->|<[^>]*>`)
+	htmlBreaks  = regexp.MustCompile(`(?i)<br\s*/?>|</(p|div|li|tr|h[1-6])>`)
+	blankLines  = regexp.MustCompile(`\n{3,}`)
+	inlineStyle = map[string]string{"b": "B", "strong": "B", "i": "I", "em": "I", "u": "U", "ins": "U", "s": "S", "del": "S", "strike": "S"}
+)
+
+// openTag is a tag of inline html that's in effect, with the block it was opened in
+type openTag struct {
+	name  string
+	block ast.Node
+}
+
+// inlineHTML follows the tags of inline html that change how text looks: <br> breaks
+// the line, <b>, <i>, <u> and <s> style, <sub> and <sup> shift, <kbd> is monospaced and
+// <mark> highlights; other tags are dropped and their text kept
+// a closing tag with nothing to close is ignored, and tags left open end with their block
+func (r *pdfRenderer) inlineHTML(n *ast.RawHTML) {
+	var raw strings.Builder
+	for i := 0; i < n.Segments.Len(); i++ {
+		segment := n.Segments.At(i)
+		raw.Write(segment.Value(r.source))
+	}
+	m := htmlTag.FindStringSubmatch(strings.TrimSpace(raw.String()))
+	if m == nil {
+		return
+	}
+	closing, tag := m[1] == "/", strings.ToLower(m[2])
+
+	switch tag {
+	case "br":
+		r.pdf.Ln(5)
+		return
+	case "sub", "sup", "kbd", "mark":
+	default:
+		if _, ok := inlineStyle[tag]; !ok {
+			return
+		}
+	}
+
+	if !closing {
+		block := n.Parent()
+		for block != nil && block.Type() != ast.TypeBlock {
+			block = block.Parent()
+		}
+		r.openTags = append(r.openTags, openTag{name: tag, block: block})
+		r.startTag(tag)
+		return
+	}
+	for i := len(r.openTags) - 1; i >= 0; i-- {
+		if r.openTags[i].name == tag {
+			r.closeTag(i)
+			return
+		}
+	}
+}
+
+// closeTag ends the i-th open tag; those opened after it end with it and start again,
+// so the text after </b> in <b><i></b></i> stays italic
+func (r *pdfRenderer) closeTag(i int) {
+	inner := append([]openTag(nil), r.openTags[i+1:]...)
+	for j := len(r.openTags) - 1; j >= i; j-- {
+		r.endTag(r.openTags[j].name)
+	}
+	r.openTags = append(r.openTags[:i], inner...)
+	for _, tag := range inner {
+		r.startTag(tag.name)
+	}
+}
+
+// closeBlockTags ends the tags left open in block, which are the innermost as the blocks
+// inside it have ended already
+func (r *pdfRenderer) closeBlockTags(block ast.Node) {
+	for len(r.openTags) > 0 && r.openTags[len(r.openTags)-1].block == block {
+		r.endTag(r.openTags[len(r.openTags)-1].name)
+		r.openTags = r.openTags[:len(r.openTags)-1]
+	}
+}
+
+func (r *pdfRenderer) startTag(tag string) {
+	switch tag {
+	case "sub":
+		r.script = -1
+	case "sup":
+		r.script = 1
+	case "kbd":
+		r.kbd = true
+		r.pdf.SetFont(monoFamily, "", r.options.FontSize-1)
+	case "mark":
+		r.highlight++
+	default:
+		r.pushFont(inlineStyle[tag])
+	}
+}
+
+func (r *pdfRenderer) endTag(tag string) {
+	switch tag {
+	case "sub", "sup":
+		r.script = 0
+	case "kbd":
+		r.kbd = false
+		r.pdf.SetFont(mainFamily, r.currentFont(), r.options.FontSize)
+	case "mark":
+		r.highlight--
+	default:
+		r.popFont()
+	}
+}
+
+// htmlText is the text of an html block, with line breaks where its tags break lines
+func htmlText(n *ast.HTMLBlock, source []byte) string {
+	var b strings.Builder
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		line := lines.At(i)
+		b.Write(line.Value(source))
+	}
+	if n.HasClosure() {
+		b.Write(n.ClosureLine.Value(source))
+	}
+
+	text := htmlBreaks.ReplaceAllString(b.String(), "$0\n")
+	text = html.UnescapeString(htmlTags.ReplaceAllString(text, ""))
+	var out []string
+	for _, line := range strings.Split(text, "\n") {
+		out = append(out, strings.TrimSpace(line))
+	}
+	return strings.TrimSpace(blankLines.ReplaceAllString(strings.Join(out, "\n"), "\n\n"))
+}
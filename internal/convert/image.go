@@ -0,0 +1,202 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// screenshots are sized as if shown at this many pixels per inch
+const imageDPI = 96.0
+
+// isImage reports whether a file is an image gofpdf can embed
+func isImage(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png", ".jpg", ".jpeg", ".gif":
+		return true
+	}
+	return false
+}
+
+// attachment finds an image a note links to: next to the note, in the attachment
+// folder set in obsidian, then anywhere in the vault
+func (v *vault) attachment(target, from string) (string, bool) {
+	if dir := v.attachmentDir(from); dir != "" {
+		path := filepath.Join(dir, filepath.FromSlash(target))
+		if st, err := os.Stat(path); err == nil && !st.IsDir() {
+			return path, true
+		}
+	}
+	return v.resolve(target, from)
+}
+
+// attachmentDir is obsidian's "Default location for new attachments" for a note
+func (v *vault) attachmentDir(from string) string {
+	setting := v.attachmentSetting()
+	if setting == "" {
+		return ""
+	}
+	// "./" and "./assets" are relative to the note, anything else to the vault
+	if rel, ok := strings.CutPrefix(setting, "./"); ok || setting == "." {
+		return filepath.Join(filepath.Dir(from), filepath.FromSlash(rel))
+	}
+	return filepath.Join(v.root, filepath.FromSlash(setting))
+}
+
+// attachmentSetting reads the attachment folder from .obsidian/app.json, once per vault
+func (v *vault) attachmentSetting() string {
+	if v.attachments != nil {
+		return *v.attachments
+	}
+	var config struct {
+		AttachmentFolderPath string `json:"attachmentFolderPath"`
+	}
+	if v.root != "" {
+		if data, err := os.ReadFile(filepath.Join(v.root, ".obsidian", "app.json")); err == nil {
+			json.Unmarshal(data, &config)
+		}
+	}
+	v.attachments = &config.AttachmentFolderPath
+	return *v.attachments
+}
+
+// loadImage reads an image for gofpdf; pngs and gifs are re-encoded since gofpdf
+// can't read every png (interlaced ones for a start), grayscale ones always are
+func loadImage(path string, grayscale bool) ([]byte, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	kind := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	if (kind == "jpg" || kind == "jpeg") && !grayscale {
+		return data, "JPG", nil
+	}
+
+	var img image.Image
+	switch kind {
+	case "png":
+		img, err = png.Decode(bytes.NewReader(data))
+	case "gif":
+		img, err = gif.Decode(bytes.NewReader(data))
+	case "jpg", "jpeg":
+		img, err = jpeg.Decode(bytes.NewReader(data))
+	default:
+		return nil, "", fmt.Errorf("unsupported image type: %s", kind)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+
+	if grayscale {
+		// transparency goes onto white paper before dropping the color
+		gray := image.NewGray(img.Bounds())
+		draw.Draw(gray, gray.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+		draw.Draw(gray, gray.Bounds(), img, img.Bounds().Min, draw.Over)
+		img = gray
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, "", fmt.Errorf("failed to encode %s: %w", path, err)
+	}
+	return buf.Bytes(), "PNG", nil
+}
+
+var imageSize = regexp.MustCompile(`^(\d+)(?:x(\d+))?$`)
+
+// imageWidth reads obsidian's ![[img.png|300]] and ![alt|300x200](img.png) sizes, in mm
+func imageWidth(label string) float64 {
+	m := imageSize.FindStringSubmatch(strings.TrimSpace(label))
+	if m == nil {
+		return 0
+	}
+	px, _ := strconv.Atoi(m[1])
+	return float64(px) * 25.4 / imageDPI
+}
+
+// imagePath resolves the destination of a markdown image in the note from, false for
+// remote ones
+func (v *vault) imagePath(dest, from string) (string, bool) {
+	if u, err := url.Parse(dest); err == nil && u.Scheme != "" {
+		return "", false
+	}
+	if unescaped, err := url.PathUnescape(dest); err == nil {
+		dest = unescaped
+	}
+	return v.attachment(dest, from)
+}
+
+// registerImage reads an image into the pdf once, returning the name to draw it by;
+// its info is nil when it can't be read
+func registerImage(pdf *gofpdf.Fpdf, path string, grayscale bool) (string, *gofpdf.ImageInfoType) {
+	name := path
+	if grayscale {
+		name += "#gray"
+	}
+
+	info := pdf.GetImageInfo(name)
+	if info == nil {
+		data, kind, err := loadImage(path, grayscale)
+		if err != nil {
+			return name, nil
+		}
+		info = pdf.RegisterImageOptionsReader(name, gofpdf.ImageOptions{ImageType: kind}, bytes.NewReader(data))
+		if pdf.Err() || info == nil {
+			pdf.ClearError()
+			return name, nil
+		}
+	}
+	return name, info
+}
+
+// drawImage puts an image on its own line, scaled down to the text width and page
+// height; width is the requested size in mm, 0 for none
+// it reports false when the image can't be read, leaving the caller to write its name
+func (r *pdfRenderer) drawImage(path string, width float64) bool {
+	name, info := registerImage(r.pdf, path, r.options.Grayscale)
+	if info == nil {
+		return false
+	}
+
+	lMargin, tMargin, rMargin, _ := r.pdf.GetMargins()
+	pageW, pageH := r.pdf.GetPageSize()
+	_, bottom := r.pdf.GetAutoPageBreak()
+	maxW, maxH := pageW-lMargin-rMargin, pageH-tMargin-bottom
+
+	// gofpdf sizes images at 72dpi
+	w, h := info.Width()*72/imageDPI, info.Height()*72/imageDPI
+	if width > 0 {
+		w, h = width, h*width/w
+	}
+	if w > maxW {
+		w, h = maxW, h*maxW/w
+	}
+	if h > maxH {
+		w, h = w*maxH/h, maxH
+	}
+
+	if r.pdf.GetX() > lMargin {
+		r.pdf.Ln(5)
+	}
+	if r.pdf.GetY()+h > pageH-bottom {
+		r.pdf.AddPage()
+	}
+	r.pdf.ImageOptions(name, lMargin, r.pdf.GetY()+1, w, h, false, gofpdf.ImageOptions{}, r.linkID, r.linkURL)
+	r.pdf.SetXY(lMargin, r.pdf.GetY()+h+2)
+	return true
+}
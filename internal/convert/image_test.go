@@ -0,0 +1,116 @@
+package convert
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writePNG(t *testing.T, path string, w, h int) {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			img.Set(x, y, color.RGBA{R: 200, G: 30, B: 30, A: 255})
+		}
+	}
+	os.MkdirAll(filepath.Dir(path), 0755)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAttachmentFolder(t *testing.T) {
+	root := t.TempDir()
+	note := filepath.Join(root, "Notes", "Note.md")
+	writePNG(t, filepath.Join(root, "assets", "a.png"), 2, 2)
+	writePNG(t, filepath.Join(root, "Notes", "local", "a.png"), 2, 2)
+
+	tests := []struct{ setting, want string }{
+		{"assets", "assets/a.png"},
+		{"./local", "Notes/local/a.png"},
+		{"", "assets/a.png"}, // found by name
+	}
+	for _, tt := range tests {
+		os.MkdirAll(filepath.Join(root, ".obsidian"), 0755)
+		os.WriteFile(filepath.Join(root, ".obsidian", "app.json"), []byte(`{"attachmentFolderPath": "`+tt.setting+`"}`), 0644)
+		v := &vault{root: root}
+		got, ok := v.attachment("a.png", note)
+		if !ok || got != filepath.Join(root, filepath.FromSlash(tt.want)) {
+			t.Errorf("%q: got %q, want %s", tt.setting, got, tt.want)
+		}
+	}
+
+	// the setting is read once per vault, not for every image
+	v := &vault{root: root}
+	os.WriteFile(filepath.Join(root, ".obsidian", "app.json"), []byte(`{"attachmentFolderPath": "./local"}`), 0644)
+	v.attachment("a.png", note)
+	os.Remove(filepath.Join(root, ".obsidian", "app.json"))
+	if got, _ := v.attachment("a.png", note); got != filepath.Join(root, "Notes", "local", "a.png") {
+		t.Errorf("after app.json went, got %q", got)
+	}
+}
+
+func TestImages(t *testing.T) {
+	root := t.TempDir()
+	writePNG(t, filepath.Join(root, "attachments", "wide.png"), 4000, 100)
+	writePNG(t, filepath.Join(root, "small image.png"), 40, 40)
+	note := filepath.Join(root, "Note.md")
+
+	for _, grayscale := range []bool{false, true} {
+		options := DefaultPDFOptions()
+		options.TOC = false
+		options.Grayscale = grayscale
+		converter := &Converter{options: options, vault: &vault{root: root}}
+		pdf := setupPDF(options)
+		pdf.SetCompression(false)
+		source := "![[wide.png]]\n\n![[wide.png|200]]\n\n![small|100](small%20image.png)\n\n![gone](missing.png) ![remote](https://example.com/x.png)\n"
+		if err := converter.processMarkdown(pdf, options, note, []byte(source)); err != nil {
+			t.Fatal(err)
+		}
+		var out strings.Builder
+		if err := pdf.Output(&out); err != nil {
+			t.Fatal(err)
+		}
+		data := out.String()
+
+		// the same file is embedded once however often it's shown
+		if n := strings.Count(data, "/Subtype /Image"); n != 2 {
+			t.Errorf("grayscale %v: %d images embedded, want 2", grayscale, n)
+		}
+		if got := strings.Contains(data, "/ColorSpace /DeviceGray"); got != grayscale {
+			t.Errorf("grayscale %v: gray color space %v", grayscale, got)
+		}
+		for _, want := range []string{tj("gone"), tj("remote")} {
+			if !strings.Contains(data, want) {
+				t.Errorf("pdf is missing %s", want)
+			}
+		}
+		if strings.Contains(data, pdfText("small|100")) {
+			t.Error("image size rendered as alt text")
+		}
+
+		// wide.png shrinks to the 170mm text width, 481.89pt
+		if !strings.Contains(data, "q 481.89") {
+			t.Errorf("grayscale %v: wide image not fitted to the page", grayscale)
+		}
+	}
+}
+
+func TestImageWidth(t *testing.T) {
+	for label, want := range map[string]float64{"96": 25.4, "192x50": 50.8, "caption": 0, "": 0} {
+		if got := imageWidth(label); math.Abs(got-want) > 1e-9 {
+			t.Errorf("imageWidth(%q) = %v, want %v", label, got, want)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package convert
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Math is a $formula$ in running text, or a $$formula$$ inside a paragraph, which is
+// shown on a line of its own
+type Math struct {
+	ast.BaseInline
+	TeX     string
+	Display bool
+}
+
+var KindMath = ast.NewNodeKind("Math")
+
+func (n *Math) Kind() ast.NodeKind {
+	return KindMath
+}
+
+func (n *Math) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"TeX": n.TeX}, nil)
+}
+
+// MathBlock is a $$ formula $$ block, its lines being the TeX between the markers
+type MathBlock struct {
+	ast.BaseBlock
+	closed bool // its closing $$ has been read
+}
+
+var KindMathBlock = ast.NewNodeKind("MathBlock")
+
+func (n *MathBlock) Kind() ast.NodeKind {
+	return KindMathBlock
+}
+
+func (n *MathBlock) IsRaw() bool {
+	return true
+}
+
+func (n *MathBlock) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+// TeX is the block's formula
+func (n *MathBlock) TeX(source []byte) string {
+	var b strings.Builder
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		line := lines.At(i)
+		b.Write(line.Value(source))
+	}
+	return strings.TrimSpace(b.String())
+}
+
+type mathParser struct{}
+
+func (p *mathParser) Trigger() []byte {
+	return []byte{'$'}
+}
+
+// Parse takes $formula$ the way pandoc does: the opening $ can't be followed by a space
+// nor the closing one preceded by one or followed by a digit, so "$5 and $10" stays text
+func (p *mathParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+	if tex, ok := bytes.CutPrefix(line, []byte("$$")); ok {
+		end := bytes.Index(tex, []byte("$$"))
+		if end < 0 || len(bytes.TrimSpace(tex[:end])) == 0 {
+			return nil
+		}
+		block.Advance(2 + end + 2)
+		return &Math{TeX: string(bytes.TrimSpace(tex[:end])), Display: true}
+	}
+
+	if len(line) < 3 || util.IsSpace(line[1]) {
+		return nil
+	}
+	for i := 1; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '$':
+			if util.IsSpace(line[i-1]) || (i+1 < len(line) && util.IsNumeric(line[i+1])) {
+				return nil
+			}
+			block.Advance(i + 1)
+			return &Math{TeX: string(line[1:i])}
+		}
+	}
+	return nil
+}
+
+type mathBlockParser struct{}
+
+func (b *mathBlockParser) Trigger() []byte {
+	return []byte{'$'}
+}
+
+// Open starts a block on a line beginning with $$, the formula following on the same
+// line or the next ones; $$x$$ alone on a line is a block too
+func (b *mathBlockParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, segment := reader.PeekLine()
+	pos := pc.BlockOffset()
+	if pos < 0 || !bytes.HasPrefix(line[pos:], []byte("$$")) {
+		return nil, parser.NoChildren
+	}
+	rest := line[pos+2:]
+	start := segment.Start + pos + 2
+	node := &MathBlock{}
+
+	if end := bytes.Index(rest, []byte("$$")); end >= 0 {
+		// anything after the closing $$ makes it math inside a paragraph
+		if !util.IsBlank(rest[end+2:]) || util.IsBlank(rest[:end]) {
+			return nil, parser.NoChildren
+		}
+		node.Lines().Append(text.NewSegment(start, start+end))
+		node.closed = true
+		reader.Advance(lineLength(line))
+		return node, parser.NoChildren
+	}
+	if !util.IsBlank(rest) {
+		node.Lines().Append(text.NewSegment(start, segment.Stop))
+	}
+	reader.Advance(lineLength(line))
+	return node, parser.NoChildren
+}
+
+// Continue takes lines up to the one with the closing $$
+func (b *mathBlockParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	if node.(*MathBlock).closed {
+		return parser.Close
+	}
+	line, segment := reader.PeekLine()
+	if end := bytes.Index(line, []byte("$$")); end >= 0 {
+		node.Lines().Append(text.NewSegment(segment.Start, segment.Start+end))
+		reader.Advance(lineLength(line))
+		return parser.Close
+	}
+	node.Lines().Append(segment)
+	reader.Advance(lineLength(line))
+	return parser.Continue | parser.NoChildren
+}
+
+// lineLength is how far to advance to the end of a line, its newline left to the parser
+func lineLength(line []byte) int {
+	return len(bytes.TrimSuffix(line, []byte("\n")))
+}
+
+func (b *mathBlockParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {}
+
+func (b *mathBlockParser) CanInterruptParagraph() bool {
+	return true
+}
+
+func (b *mathBlockParser) CanAcceptIndentedLine() bool {
+	return false
+}
+
+// renderMath typesets a formula where the text has got to, or centered on a line of its own
+func (r *pdfRenderer) renderMath(n ast.Node, tex string, display bool) {
+	size, unitSize := r.pdf.GetFontSize()
+	style := r.currentFont()
+	for p := n.Parent(); p != nil; p = p.Parent() {
+		if _, ok := p.(*ast.Heading); ok {
+			style = "B"
+		}
+	}
+
+	box := newTypesetter(r.pdf, r.options, size).typeset(tex, display)
+	if display {
+		r.displayMath(box)
+	} else {
+		r.inlineMath(box, unitSize)
+	}
+	r.pdf.SetFont(mainFamily, style, size)
+}
+
+// inlineMath sets a formula on the line being written, on the text's baseline
+func (r *pdfRenderer) inlineMath(box *mathBox, unitSize float64) {
+	lMargin, _, rMargin, _ := r.pdf.GetMargins()
+	pageW, pageH := r.pdf.GetPageSize()
+	_, bottom := r.pdf.GetAutoPageBreak()
+	if r.pdf.GetX()+box.width > pageW-rMargin && r.pdf.GetX() > lMargin+0.01 {
+		r.pdf.Ln(5)
+	}
+	if r.pdf.GetY()+5 > pageH-bottom {
+		r.pdf.AddPage()
+	}
+	x, y := r.pdf.GetX(), r.pdf.GetY()
+	// where Write puts the baseline in a 5mm line
+	box.draw(x, y+2.5+0.3*unitSize)
+	r.pdf.SetX(x + box.width)
+}
+
+// displayMath centers a formula between the margins, shrinking it when it's too wide
+// as there's no scrolling sideways on the tablet
+func (r *pdfRenderer) displayMath(box *mathBox) {
+	lMargin, _, rMargin, _ := r.pdf.GetMargins()
+	pageW, pageH := r.pdf.GetPageSize()
+	_, bottom := r.pdf.GetAutoPageBreak()
+	if r.pdf.GetX() > lMargin+0.01 {
+		r.pdf.Ln(5)
+	}
+
+	width := pageW - lMargin - rMargin
+	scale := 1.0
+	if box.width > width {
+		scale = width / box.width
+	}
+	height := (box.ascent + box.descent) * scale
+	y := r.pdf.GetY() + 2
+	if y+height > pageH-bottom {
+		r.pdf.AddPage()
+		y = r.pdf.GetY()
+	}
+
+	x, baseline := lMargin+(width-box.width*scale)/2, y+box.ascent*scale
+	if scale < 1 {
+		r.pdf.TransformBegin()
+		r.pdf.TransformScale(scale*100, scale*100, x, baseline)
+	}
+	box.draw(x, baseline)
+	if scale < 1 {
+		r.pdf.TransformEnd()
+	}
+	r.pdf.SetY(y + height + 2)
+}
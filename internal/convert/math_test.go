@@ -0,0 +1,110 @@
+package convert
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+// formulas lists the math in a parsed document, display ones as $$tex$$
+func formulas(source string) []string {
+	var found []string
+	ast.Walk(parseMarkdown([]byte(source)), func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			switch n := node.(type) {
+			case *Math:
+				if n.Display {
+					found = append(found, "$$"+n.TeX+"$$")
+				} else {
+					found = append(found, "$"+n.TeX+"$")
+				}
+			case *MathBlock:
+				found = append(found, "block:"+n.TeX([]byte(source)))
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	return found
+}
+
+func TestMathSyntax(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"so $x^2$ and $a_i$", "$x^2$ $a_i$"},
+		{"price $5 and $10", ""},
+		{"a $ spaced $ dollar", ""},
+		{`cost \$5 or $\$5$`, `$\$5$`},
+		{"in $$e^x$$ text", "$$e^x$$"},
+		{"$$\n\\sum_i i\n= n\n$$\nafter", "block:\\sum_i i\n= n"},
+		{"$$\\int f$$\n\n$$\nx\n$$", "block:\\int f block:x"},
+		{"text\n$$\nx\n$$", "block:x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			if got := strings.Join(formulas(tt.source), " "); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTypeset(t *testing.T) {
+	options := DefaultPDFOptions()
+	pdf := setupPDF(options)
+	box := func(tex string, display bool) *mathBox {
+		return newTypesetter(pdf, options, options.FontSize).typeset(tex, display)
+	}
+
+	x := box("x", false)
+	if sup := box("x^2", false); sup.width <= x.width || sup.ascent <= x.ascent {
+		t.Errorf("x^2 is %+v, no bigger than x %+v", sup, x)
+	}
+	if frac := box(`\frac{a}{b}`, false); frac.ascent+frac.descent <= x.ascent+x.descent {
+		t.Error("fraction no taller than a letter")
+	}
+	// limits go above and below a sum in display, beside it in text
+	if inline, display := box(`\sum_{i=1}^n`, false), box(`\sum_{i=1}^n`, true); display.ascent+display.descent <= inline.ascent+inline.descent || display.width >= inline.width {
+		t.Errorf("display sum %+v, inline %+v", display, inline)
+	}
+	if one, two := box(`a = b`, true), box(`a &= b \\ &= c`, true); two.ascent+two.descent <= one.ascent+one.descent {
+		t.Error("aligned lines not stacked")
+	}
+	if wide := box(`\begin{pmatrix} a & b & c \end{pmatrix}`, false); wide.width <= box("abc", false).width {
+		t.Error("matrix columns not spaced")
+	}
+	// an optional argument left open after a line break runs to the end
+	for _, tex := range []string{`a\\[`, `a\\[2pt`} {
+		if b := box(tex, true); b.width <= 0 {
+			t.Errorf("%s typeset as %+v", tex, b)
+		}
+	}
+}
+
+func TestMathPDF(t *testing.T) {
+	options := DefaultPDFOptions()
+	options.TOC = false
+	_, data := renderPDF(t, options, "Energy $E=mc^2$ with $\\alpha \\leq \\beta$ and $\\foo$.\n\n$$\\sum_{i=1}^n i$$\n")
+	for _, want := range []string{"E", "m", "α", "≤", "β", "∑", `\foo`} {
+		if !strings.Contains(data, "("+pdfText(want)+") Tj") {
+			t.Errorf("pdf is missing %s", want)
+		}
+	}
+
+	// without a font that has them, symbols are drawn or stood in for
+	saved := mathFonts
+	defer func() { mathFonts = saved }()
+	mathFonts = nil
+	pdf := setupPDF(options)
+	ts := newTypesetter(pdf, options, options.FontSize)
+	for name, symbol := range mathSymbols {
+		r := []rune(symbol.text)
+		_, drawn := drawnSymbols[r[0]]
+		standIn, ok := standIns[r[0]]
+		if ts.family(symbol.text) == "" && !(len(r) == 1 && (drawn || ok && ts.family(standIn) != "")) {
+			t.Errorf("\\%s can't be shown with the bundled fonts", name)
+		}
+	}
+}
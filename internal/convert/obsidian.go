@@ -0,0 +1,260 @@
+package convert
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Highlight is ==marked== text
+type Highlight struct {
+	ast.BaseInline
+}
+
+var KindHighlight = ast.NewNodeKind("Highlight")
+
+func (n *Highlight) Kind() ast.NodeKind {
+	return KindHighlight
+}
+
+func (n *Highlight) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+// Tag is an inline #tag
+type Tag struct {
+	ast.BaseInline
+	Name string // without the #
+}
+
+var KindTag = ast.NewNodeKind("Tag")
+
+func (n *Tag) Kind() ast.NodeKind {
+	return KindTag
+}
+
+func (n *Tag) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Name": n.Name}, nil)
+}
+
+// Callout is a > [!type] Title blockquote, its children being the quoted blocks
+type Callout struct {
+	ast.BaseBlock
+	Variant string // the callout type, lowercased, e.g. warning
+	Title   string // empty for the type's name
+}
+
+var KindCallout = ast.NewNodeKind("Callout")
+
+func (n *Callout) Kind() ast.NodeKind {
+	return KindCallout
+}
+
+func (n *Callout) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Variant": n.Variant, "Title": n.Title}, nil)
+}
+
+// Heading is the title shown at the top of the panel
+func (n *Callout) Heading() string {
+	if n.Title != "" {
+		return n.Title
+	}
+	return strings.ToUpper(n.Variant[:1]) + n.Variant[1:]
+}
+
+type highlightDelimiterProcessor struct{}
+
+func (p *highlightDelimiterProcessor) IsDelimiter(b byte) bool {
+	return b == '='
+}
+
+func (p *highlightDelimiterProcessor) CanOpenCloser(opener, closer *parser.Delimiter) bool {
+	return opener.Char == closer.Char
+}
+
+func (p *highlightDelimiterProcessor) OnMatch(consumes int) ast.Node {
+	return &Highlight{}
+}
+
+type highlightParser struct{}
+
+func (p *highlightParser) Trigger() []byte {
+	return []byte{'='}
+}
+
+// Parse takes == as a delimiter the way goldmark's strikethrough takes ~~
+func (p *highlightParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	before := block.PrecendingCharacter()
+	line, segment := block.PeekLine()
+	node := parser.ScanDelimiter(line, before, 2, &highlightDelimiterProcessor{})
+	if node == nil || node.OriginalLength != 2 || before == '=' {
+		return nil
+	}
+	node.Segment = segment.WithStop(segment.Start + node.OriginalLength)
+	block.Advance(node.OriginalLength)
+	pc.PushDelimiter(node)
+	return node
+}
+
+type tagParser struct{}
+
+func (p *tagParser) Trigger() []byte {
+	return []byte{'#'}
+}
+
+// Parse takes #name after a space or at the start of a line; names can't be all digits,
+// so "#1" stays text
+func (p *tagParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	if before := block.PrecendingCharacter(); before != '\n' && !unicode.IsSpace(before) {
+		return nil
+	}
+	line, _ := block.PeekLine()
+
+	name := []rune{}
+	digits := true
+	for _, r := range string(line[1:]) {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '-' && r != '/' {
+			break
+		}
+		digits = digits && unicode.IsDigit(r)
+		name = append(name, r)
+	}
+	if len(name) == 0 || digits {
+		return nil
+	}
+
+	block.Advance(1 + len(string(name)))
+	return &Tag{Name: string(name)}
+}
+
+var calloutMarker = regexp.MustCompile(`^\[!([\w-]+)\][+-]?[ \t]*(.*)$`)
+
+// calloutTransformer turns blockquotes starting with [!type] into callouts
+type calloutTransformer struct{}
+
+func (t *calloutTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	var quotes []*ast.Blockquote
+	ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if quote, ok := node.(*ast.Blockquote); ok && entering {
+			quotes = append(quotes, quote)
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, quote := range quotes {
+		para, ok := quote.FirstChild().(*ast.Paragraph)
+		if !ok || para.Lines().Len() == 0 {
+			continue
+		}
+		first := para.Lines().At(0)
+		m := calloutMarker.FindSubmatch(bytes.TrimSpace(first.Value(source)))
+		if m == nil {
+			continue
+		}
+
+		callout := &Callout{Variant: strings.ToLower(string(m[1])), Title: string(m[2])}
+
+		// the marker line becomes the title, the rest of the paragraph stays
+		for child := para.FirstChild(); child != nil; {
+			next := child.NextSibling()
+			para.RemoveChild(para, child)
+			if t, ok := child.(*ast.Text); ok && (t.SoftLineBreak() || t.HardLineBreak()) {
+				break
+			}
+			child = next
+		}
+		if !para.HasChildren() {
+			quote.RemoveChild(quote, para)
+		}
+
+		for child := quote.FirstChild(); child != nil; {
+			next := child.NextSibling()
+			callout.AppendChild(callout, child)
+			child = next
+		}
+		quote.Parent().ReplaceChild(quote.Parent(), quote, callout)
+	}
+}
+
+// stripComments removes %%comments%%, which may span lines, outside fenced code
+func stripComments(content []byte) []byte {
+	if !bytes.Contains(content, []byte("%%")) {
+		return content
+	}
+
+	var out []byte
+	fence, inComment := "", false
+	for _, line := range bytes.SplitAfter(content, []byte("\n")) {
+		if !inComment {
+			// code is left alone, fences only close on the same marker
+			if marker := fenceMarker(line); marker != "" && (fence == "" || marker == fence) {
+				if fence == "" {
+					fence = marker
+				} else {
+					fence = ""
+				}
+				out = append(out, line...)
+				continue
+			}
+			if fence != "" {
+				out = append(out, line...)
+				continue
+			}
+		}
+
+		for len(line) > 0 {
+			i := bytes.Index(line, []byte("%%"))
+			if i < 0 {
+				if !inComment {
+					out = append(out, line...)
+				} else if bytes.HasSuffix(line, []byte("\n")) {
+					// keeps the line structure around a comment spanning lines
+					out = append(out, '\n')
+				}
+				break
+			}
+			if !inComment {
+				out = append(out, line[:i]...)
+			}
+			inComment = !inComment
+			line = line[i+2:]
+		}
+	}
+	return out
+}
+
+func fenceMarker(line []byte) string {
+	line = bytes.TrimSpace(line)
+	for _, marker := range []string{"```", "~~~"} {
+		if bytes.HasPrefix(line, []byte(marker)) {
+			return marker
+		}
+	}
+	return ""
+}
+
+// obsidian adds obsidian's markdown to a goldmark parser: [[links]], ![[embeds]],
+// ==highlights==, #tags, > [!callouts] and $math$
+type obsidian struct{}
+
+func (e obsidian) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithInlineParsers(
+			// ahead of the standard link parser, which would take [[ as a nested label
+			util.Prioritized(&wikiLinkParser{}, 199),
+			util.Prioritized(&tagParser{}, 500),
+			util.Prioritized(&highlightParser{}, 500),
+			util.Prioritized(&mathParser{}, 500),
+		),
+		parser.WithBlockParsers(util.Prioritized(&mathBlockParser{}, 700)),
+		parser.WithASTTransformers(util.Prioritized(&calloutTransformer{}, 100)),
+	)
+}
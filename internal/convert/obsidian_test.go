@@ -0,0 +1,227 @@
+package convert
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+// kinds lists the node kinds in a parsed document, in order
+func kinds(source string) []string {
+	var names []string
+	ast.Walk(parseMarkdown([]byte(source)), func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			switch n := node.(type) {
+			case *Tag:
+				names = append(names, "Tag:"+n.Name)
+			case *Callout:
+				names = append(names, "Callout:"+n.Variant+":"+n.Heading())
+			case *Highlight, *ast.Blockquote:
+				names = append(names, n.Kind().String())
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	return names
+}
+
+func TestObsidianSyntax(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"a ==marked== word", "Highlight"},
+		{"a == b and c==d", ""},
+		{"#project and #area/home but not #1 or a#b", "Tag:project Tag:area/home"},
+		{"> [!warning] Mind the gap\n> body", "Callout:warning:Mind the gap"},
+		{"> [!note]\n> body", "Callout:note:Note"},
+		{"> plain quote", "Blockquote"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			if got := strings.Join(kinds(tt.source), " "); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripComments(t *testing.T) {
+	source := "keep %%drop%% this\n%%\nwhole\nblock\n%%\n```\n%% code %%\n```\nend\n"
+	want := "keep  this\n\n\n\n\n```\n%% code %%\n```\nend\n"
+	if got := string(stripComments([]byte(source))); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestVaultResolve(t *testing.T) {
+	root := t.TempDir()
+	for _, path := range []string{"Notes/Deep/Target.md", "Target.md", "Notes/Other.md", "attachments/diagram.png", ".obsidian/Hidden.md"} {
+		path = filepath.Join(root, filepath.FromSlash(path))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte("x"), 0644)
+	}
+	from := filepath.Join(root, "Notes", "Other.md")
+	v := &vault{root: root}
+
+	tests := []struct{ target, want string }{
+		{"Target", "Target.md"},
+		{"Deep/Target", "Notes/Deep/Target.md"},
+		{"Other", "Notes/Other.md"},
+		{"diagram.png", "attachments/diagram.png"},
+		{"Hidden", ""},
+		{"Missing", ""},
+	}
+	for _, tt := range tests {
+		got, ok := v.resolve(tt.target, from)
+		if tt.want == "" {
+			if ok {
+				t.Errorf("%s resolved to %s", tt.target, got)
+			}
+			continue
+		}
+		if want := filepath.Join(root, filepath.FromSlash(tt.want)); got != want {
+			t.Errorf("%s resolved to %q, want %q", tt.target, got, want)
+		}
+	}
+}
+
+func TestEmbeds(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "Recipe.md"), []byte("---\ntags: [food]\n---\n# Recipe\n\nintro\n\n## Steps\n\nstir well\n\n## Notes\n\nskipped\n"), 0644)
+	os.WriteFile(filepath.Join(root, "Loop.md"), []byte("again ![[Loop]]\n"), 0644)
+	note := filepath.Join(root, "Host.md")
+
+	options := DefaultPDFOptions()
+	options.TOC = false
+	converter := &Converter{options: options, vault: &vault{root: root}}
+	pdf := setupPDF(options)
+	pdf.SetCompression(false)
+	source := "# Host\n\n![[Recipe#Steps]]\n\n![[Loop]]\n\n![[Nowhere]]\n"
+	if err := converter.processMarkdown(pdf, options, note, []byte(source)); err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	if err := pdf.Output(&out); err != nil {
+		t.Fatal(err)
+	}
+	data := out.String()
+
+	for _, want := range []string{tj("Steps"), tj("stir"), tj("again "), tj("Nowhere")} {
+		if !strings.Contains(data, want) {
+			t.Errorf("pdf is missing %s", want)
+		}
+	}
+	for _, unwanted := range []string{tj("skipped"), tj("intro"), pdfText("food")} {
+		if strings.Contains(data, unwanted) {
+			t.Errorf("pdf has %s from outside the embedded section", unwanted)
+		}
+	}
+	// Loop embeds itself once and then stops
+	if n := strings.Count(data, tj("again ")); n != 1 {
+		t.Errorf("self embed rendered %d times", n)
+	}
+}
+
+func TestEmbedResolvesFromItsNote(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "cards"), 0755)
+	writePNG(t, filepath.Join(root, "cards", "pic.png"), 8, 8)
+	writePNG(t, filepath.Join(root, "pic.png"), 4, 4)
+	os.WriteFile(filepath.Join(root, "cards", "Card.md"), []byte("![](pic.png)\n\nsee [[#Part]]\n\n# Part\n\nend\n"), 0644)
+	note := filepath.Join(root, "Host.md")
+
+	options := DefaultPDFOptions()
+	options.TOC = false
+	converter := &Converter{options: options, vault: &vault{root: root}}
+	pdf := setupPDF(options)
+	pdf.SetCompression(false)
+	// the host has no Part heading, and another pic.png beside it
+	if err := converter.processMarkdown(pdf, options, note, []byte("# Host\n\n![[Card]]\n")); err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	if err := pdf.Output(&out); err != nil {
+		t.Fatal(err)
+	}
+	data := out.String()
+
+	if !strings.Contains(data, "/Subtype /Image\n/Width 8") {
+		t.Error("image not the one beside the embedded note")
+	}
+	if n := strings.Count(data, "/Border [0 0 0] /Dest"); n != 1 {
+		t.Errorf("%d internal links, want the one to the embedded heading", n)
+	}
+	// the embedded heading stays out of the outline
+	if !strings.Contains(data, outlineTitle("Host")) || strings.Contains(data, outlineTitle("Part")) {
+		t.Error("outline isn't just the host's heading")
+	}
+}
+
+func TestRenderHash(t *testing.T) {
+	root := t.TempDir()
+	note := filepath.Join(root, "Host.md")
+	os.WriteFile(note, []byte("![[Recipe]]\n\n![](pics/cake.png)\n"), 0644)
+	os.WriteFile(filepath.Join(root, "Recipe.md"), []byte("stir ![[Loop]]\n"), 0644)
+	os.WriteFile(filepath.Join(root, "Loop.md"), []byte("again ![[Host]]\n"), 0644)
+	os.MkdirAll(filepath.Join(root, "pics"), 0755)
+	writePNG(t, filepath.Join(root, "pics", "cake.png"), 4, 4)
+
+	converter := &Converter{options: DefaultPDFOptions(), vault: &vault{root: root}}
+	hash := func() string {
+		t.Helper()
+		h, err := converter.RenderHash(note)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	var got []string
+	for _, dep := range converter.dependencies(note, []byte("![[Recipe]]\n\n![](pics/cake.png)\n")) {
+		rel, _ := filepath.Rel(root, dep)
+		got = append(got, filepath.ToSlash(rel))
+	}
+	if strings.Join(got, " ") != "Recipe.md pics/cake.png Loop.md" {
+		t.Errorf("dependencies are %v", got)
+	}
+
+	// an embed of an embed changing, the image, the options, each render again
+	first := hash()
+	os.WriteFile(filepath.Join(root, "Loop.md"), []byte("and again ![[Host]]\n"), 0644)
+	second := hash()
+	writePNG(t, filepath.Join(root, "pics", "cake.png"), 8, 8)
+	third := hash()
+	converter.options.FontSize++
+	fourth := hash()
+	if first == second || second == third || third == fourth {
+		t.Errorf("hashes %s %s %s %s", first, second, third, fourth)
+	}
+	if hash() != fourth {
+		t.Error("hash isn't stable")
+	}
+}
+
+func TestCalloutsAndHighlights(t *testing.T) {
+	options := DefaultPDFOptions()
+	options.TOC = false
+	source := "> [!warning] Mind the gap\n" + strings.Repeat("> line\n>\n", 70) +
+		"\n" + strings.Repeat("plain ", 30) + "==" + strings.TrimSpace(strings.Repeat("marked ", 40)) + "== #tag\n"
+	pdf, data := renderPDF(t, options, source)
+
+	if pdf.PageNo() < 2 {
+		t.Errorf("callout should run over a page, got %d", pdf.PageNo())
+	}
+	for _, want := range []string{tj("Mind the gap"), tj("marked "), tj("#tag")} {
+		if !strings.Contains(data, want) {
+			t.Errorf("pdf is missing %s", want)
+		}
+	}
+	for _, raw := range []string{"[!warning]", "=="} {
+		if strings.Contains(data, pdfText(raw)) {
+			t.Errorf("markdown syntax %q rendered as text", raw)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package convert
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+	"gopkg.in/yaml.v3"
+)
+
+// gofpdf swaps this for the page count when the pdf is written
+const pageCountAlias = "{nb}"
+
+// noteInfo is what header and footer templates can show about a note
+type noteInfo struct {
+	title    string
+	path     string // from the vault root when the note is in the vault
+	tags     []string
+	date     string // when the pdf was made
+	modified string // the note's last change, which the pdf is stamped with too
+}
+
+// noteInfo gathers a note's details, its frontmatter title and tags winning over the file's
+func (c *Converter) noteInfo(mdPath string, note NoteOptions) noteInfo {
+	info := noteInfo{
+		title: strings.TrimSuffix(filepath.Base(mdPath), filepath.Ext(mdPath)),
+		path:  filepath.Base(mdPath),
+		tags:  note.Tags,
+	}
+	if note.Title != "" {
+		info.title = note.Title
+	}
+	if c.vault != nil && c.vault.root != "" {
+		if rel, err := filepath.Rel(c.vault.root, mdPath); err == nil && !strings.HasPrefix(rel, "..") {
+			info.path = filepath.ToSlash(rel)
+		}
+	}
+	info.date = c.today()
+	if st, err := os.Stat(mdPath); err == nil {
+		info.modified = st.ModTime().Format("2006-01-02")
+	}
+	return info
+}
+
+// today is the date {date} shows
+func (c *Converter) today() string {
+	now := time.Now
+	if c.now != nil {
+		now = c.now
+	}
+	return now().Format("2006-01-02")
+}
+
+// fill puts a note's details into a template, page numbers are left for each page
+func (info noteInfo) fill(template string) string {
+	tags := make([]string, len(info.tags))
+	for i, tag := range info.tags {
+		tags[i] = "#" + strings.TrimPrefix(tag, "#")
+	}
+	return strings.NewReplacer(
+		"{title}", info.title,
+		"{path}", info.path,
+		"{tags}", strings.Join(tags, " "),
+		"{date}", info.date,
+		"{modified}", info.modified,
+	).Replace(template)
+}
+
+// fillText fills a template with text the main font of options can write, see fontText
+func (info noteInfo) fillText(template string, options PDFOptions) string {
+	return string(fontText([]byte(info.fill(template)), options))
+}
+
+// setupPages prints the header and footer templates of options on every page
+func setupPages(pdf *gofpdf.Fpdf, options PDFOptions) {
+	if options.Header == "" && options.Footer == "" {
+		return
+	}
+	// after the fonts are loaded, so their subsets keep the digits of the page count
+	pdf.AliasNbPages(pageCountAlias)
+
+	if options.Header != "" {
+		pdf.SetHeaderFunc(func() {
+			_, tMargin, _, _ := pdf.GetMargins()
+			drawTemplate(pdf, options, options.Header, tMargin/2)
+		})
+	}
+	if options.Footer != "" {
+		pdf.SetFooterFunc(func() {
+			_, pageH := pdf.GetPageSize()
+			_, bottom := pdf.GetAutoPageBreak()
+			drawTemplate(pdf, options, options.Footer, pageH-bottom/2)
+		})
+	}
+}
+
+// drawTemplate prints a template's "|" separated parts along a line centered on y:
+// one part is centered, two go left and right, three left, center and right
+func drawTemplate(pdf *gofpdf.Fpdf, options PDFOptions, template string, y float64) {
+	lMargin, _, rMargin, _ := pdf.GetMargins()
+	pageW, _ := pdf.GetPageSize()
+	width := pageW - lMargin - rMargin
+
+	pdf.SetFont(mainFamily, "", options.FontSize-3)
+	pdf.SetTextColor(120, 120, 120)
+	_, size := pdf.GetFontSize()
+
+	parts := strings.SplitN(template, "|", 3)
+	aligns := map[int][]string{1: {"C"}, 2: {"L", "R"}, 3: {"L", "C", "R"}}[len(parts)]
+	replacer := strings.NewReplacer("{page}", strconv.Itoa(pdf.PageNo()), "{pages}", pageCountAlias)
+	for i, part := range parts {
+		text := fitText(pdf, strings.TrimSpace(replacer.Replace(part)), width/float64(len(parts)))
+		x := lMargin
+		switch aligns[i] {
+		case "C":
+			x += (width - pdf.GetStringWidth(text)) / 2
+		case "R":
+			x += width - pdf.GetStringWidth(text)
+		}
+		pdf.Text(x, y+0.3*size, text)
+	}
+}
+
+// tagList reads frontmatter tags given as a list or as one comma or space separated string
+type tagList []string
+
+func (t *tagList) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*t = strings.FieldsFunc(value.Value, func(r rune) bool { return r == ',' || r == ' ' })
+		return nil
+	}
+	var tags []string
+	if err := value.Decode(&tags); err != nil {
+		return err
+	}
+	*t = tags
+	return nil
+}
@@ -0,0 +1,60 @@
+package convert
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNoteInfo(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "Projects", "plan.md")
+	os.MkdirAll(filepath.Dir(path), 0755)
+	os.WriteFile(path, nil, 0644)
+	os.Chtimes(path, time.Time{}, time.Date(2024, 3, 5, 12, 0, 0, 0, time.Local))
+
+	note, _, err := parseNoteOptions([]byte("---\ntitle: The Plan\ntags: [work, \"#q1\"]\n---\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// tags can be one string as well as a list
+	if single, _, _ := parseNoteOptions([]byte("---\ntags: work, q1\n---\n")); strings.Join(single.Tags, " ") != "work q1" {
+		t.Errorf("tags = %q", single.Tags)
+	}
+	c := &Converter{vault: &vault{root: root}, now: func() time.Time { return time.Date(2025, 1, 2, 9, 0, 0, 0, time.Local) }}
+	got := c.noteInfo(path, note).fill("{title} | {path} {tags} | {modified}, page {page} printed {date}")
+	if want := "The Plan | Projects/plan.md #work #q1 | 2024-03-05, page {page} printed 2025-01-02"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// no frontmatter and outside the vault
+	got = (&Converter{}).noteInfo(path, NoteOptions{}).fill("{title} {path}{tags}")
+	if got != "plan plan.md" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestHeadersAndFooters(t *testing.T) {
+	options := DefaultPDFOptions()
+	options.TOC = false
+	options.Header = "Dune|#books"
+	options.Footer = "page {page} of {pages}"
+	pdf, data := renderPDF(t, options, strings.Repeat("line\n\n", 80))
+
+	if pdf.PageNo() != 2 {
+		t.Fatalf("got %d pages, want 2", pdf.PageNo())
+	}
+	for _, want := range []string{"Dune", "#books", "page 1 of 2", "page 2 of 2"} {
+		if n := strings.Count(data, "("+pdfText(want)+") Tj"); n == 0 || (want == "Dune" && n != 2) {
+			t.Errorf("pdf has %s %d times", want, n)
+		}
+	}
+
+	// no templates, no page furniture
+	options.Header, options.Footer = "", ""
+	if _, data := renderPDF(t, options, "line\n"); strings.Contains(data, pdfText("page")) {
+		t.Error("footer printed without a template")
+	}
+}
@@ -0,0 +1,80 @@
+package convert
+
+import (
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// PageProfile is a tablet's screen as a page size, so pdfs fill it without zooming,
+// with margins and a font size that suit it
+type PageProfile struct {
+	Width, Height float64 // mm
+	Margins       float64
+	RightMargin   float64 // 0 for the same as Margins
+	FontSize      float64
+}
+
+// screen size in mm from its resolution
+func screen(width, height, dpi float64) (float64, float64) {
+	return width / dpi * 25.4, height / dpi * 25.4
+}
+
+var pageProfiles = func() map[string]PageProfile {
+	devices := map[string]struct {
+		width, height, dpi float64
+		margins, fontSize  float64
+	}{
+		"rm1":           {1404, 1872, 226, 10, 11},
+		"rm2":           {1404, 1872, 226, 10, 11},
+		"paperpro":      {1620, 2160, 229, 10, 11},
+		"paperpro-move": {954, 1696, 264, 6, 9},
+	}
+
+	profiles := map[string]PageProfile{}
+	for name, d := range devices {
+		w, h := screen(d.width, d.height, d.dpi)
+		profiles[name] = PageProfile{Width: w, Height: h, Margins: d.margins, FontSize: d.fontSize}
+		// a third of the page kept clear on the right for handwritten notes
+		profiles[name+"-annotate"] = PageProfile{Width: w, Height: h, Margins: d.margins, RightMargin: w / 3, FontSize: d.fontSize}
+	}
+	return profiles
+}()
+
+// LookupProfile returns the device profile a page size names, e.g. rm2 or paperpro-annotate
+func LookupProfile(pageSize string) (PageProfile, bool) {
+	profile, ok := pageProfiles[strings.ToLower(pageSize)]
+	return profile, ok
+}
+
+// Apply sets the profile's margins and font size on options, those fixed on the command
+// line aside; an annotation margin is kept clear either way
+func (p PageProfile) Apply(options PDFOptions) PDFOptions {
+	if !options.FixedMargins {
+		options.Margins = p.Margins
+		options.RightMargin = p.RightMargin
+	} else if p.RightMargin > 0 {
+		options.RightMargin = p.RightMargin
+	}
+	if !options.FixedFontSize {
+		options.FontSize = p.FontSize
+	}
+	return options
+}
+
+// newPDF starts a pdf in mm, on a device profile's page or a standard size, in portrait
+// unless it's turned sideways
+func newPDF(pageSize string, landscape bool) *gofpdf.Fpdf {
+	orientation := "P"
+	if landscape {
+		orientation = "L"
+	}
+	if profile, ok := LookupProfile(pageSize); ok {
+		return gofpdf.NewCustom(&gofpdf.InitType{
+			OrientationStr: orientation,
+			UnitStr:        "mm",
+			Size:           gofpdf.SizeType{Wd: profile.Width, Ht: profile.Height},
+		})
+	}
+	return gofpdf.New(orientation, "mm", pageSize, "")
+}
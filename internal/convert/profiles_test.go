@@ -0,0 +1,59 @@
+package convert
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPageProfiles(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height float64
+	}{
+		{"rm2", 157.8, 210.4},
+		{"RM1", 157.8, 210.4},
+		{"paperpro", 179.7, 239.6},
+		{"paperpro-move", 91.8, 163.2},
+	}
+	for _, tt := range tests {
+		options := DefaultPDFOptions()
+		options.PageSize = tt.name
+		w, h := setupPDF(options).GetPageSize()
+		if math.Abs(w-tt.width) > 0.05 || math.Abs(h-tt.height) > 0.05 {
+			t.Errorf("%s: page is %.1f x %.1f, want %.1f x %.1f", tt.name, w, h, tt.width, tt.height)
+		}
+	}
+
+	if _, ok := LookupProfile("A4"); ok {
+		t.Error("A4 taken for a device")
+	}
+
+	profile, _ := LookupProfile("rm2-annotate")
+	options := profile.Apply(DefaultPDFOptions())
+	options.PageSize = "rm2-annotate"
+	left, _, right, _ := setupPDF(options).GetMargins()
+	if left != 10 || math.Abs(right-157.8/3) > 0.05 || options.FontSize != 11 {
+		t.Errorf("annotate margins %.1f / %.1f, font %v", left, right, options.FontSize)
+	}
+}
+
+func TestNoteProfile(t *testing.T) {
+	margins := 15.0
+	options := NoteOptions{PageSize: "paperpro-annotate"}.Apply(DefaultPDFOptions())
+	if options.Margins != 10 || options.RightMargin == 0 {
+		t.Errorf("profile margins not applied: %+v", options)
+	}
+	// margins set by the note win over the device's, leaving room for annotations
+	options = NoteOptions{PageSize: "paperpro-annotate", Margins: margins}.Apply(DefaultPDFOptions())
+	if options.Margins != margins || options.RightMargin == 0 {
+		t.Errorf("note margins not kept: %+v", options)
+	}
+	// as do the margins and font size given on the command line
+	fixed := DefaultPDFOptions()
+	fixed.Margins, fixed.FontSize = margins, 14
+	fixed.FixedMargins, fixed.FixedFontSize = true, true
+	options = NoteOptions{PageSize: "rm2-annotate"}.Apply(fixed)
+	if options.Margins != margins || options.RightMargin == 0 || options.FontSize != 14 || options.PageSize != "rm2-annotate" {
+		t.Errorf("command line options not kept: %+v", options)
+	}
+}
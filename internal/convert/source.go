@@ -0,0 +1,98 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+	"gopkg.in/yaml.v3"
+)
+
+// sourceLanguages are the code and config files printed as code, by extension, with
+// the language they're highlighted as
+var sourceLanguages = map[string]string{
+	".yml":    "yaml",
+	".yaml":   "yaml",
+	".json":   "json",
+	".toml":   "toml",
+	".ini":    "ini",
+	".conf":   "ini",
+	".config": "ini",
+	".cfg":    "ini",
+	".sh":     "bash",
+	".bash":   "bash",
+	".zsh":    "bash",
+	".go":     "go",
+	".py":     "python",
+}
+
+// IsSource reports whether a file is printed as code, for one of sourceLanguages
+func IsSource(path string) bool {
+	_, ok := sourceLanguages[strings.ToLower(filepath.Ext(path))]
+	return ok
+}
+
+// isNote reports whether a file is markdown, whose frontmatter can set its options
+func isNote(path string) bool {
+	return !strings.EqualFold(filepath.Ext(path), ".canvas") && !IsSource(path)
+}
+
+// Convertible reports whether MarkdownToPDF can print a file: notes, canvases and
+// the code and config files of sourceLanguages
+func Convertible(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".md", ".canvas":
+		return true
+	}
+	return IsSource(path)
+}
+
+// processSource prints a code or config file under its name as the title, highlighted
+// for its language and wrapped to the page
+// yaml and json that doesn't parse is printed all the same, with a warning
+func (c *Converter) processSource(pdf *gofpdf.Fpdf, options PDFOptions, path string, content []byte) error {
+	r := &pdfRenderer{pdf: pdf, options: options}
+	language := sourceLanguages[strings.ToLower(filepath.Ext(path))]
+	if err := checkSyntax(language, content); err != nil {
+		c.warnf("%s: %v", path, err)
+	}
+
+	pdf.Bookmark(filepath.Base(path), 0, -1)
+	pdf.SetFont(mainFamily, "B", options.FontSize+10)
+	pdf.MultiCell(0, 10, filepath.Base(path), "", "L", false)
+
+	r.renderCode(language, string(content))
+	return nil
+}
+
+// checkSyntax parses yaml, every document of it, and json, nil for other languages
+func checkSyntax(language string, content []byte) error {
+	switch language {
+	case "yaml":
+		dec := yaml.NewDecoder(bytes.NewReader(content))
+		for {
+			var doc interface{}
+			if err := dec.Decode(&doc); err == io.EOF {
+				return nil
+			} else if err != nil {
+				return fmt.Errorf("invalid yaml: %w", err)
+			}
+		}
+	case "json":
+		var doc interface{}
+		if err := json.Unmarshal(content, &doc); err != nil {
+			var syntax *json.SyntaxError
+			if errors.As(err, &syntax) {
+				line := 1 + bytes.Count(content[:syntax.Offset], []byte("\n"))
+				return fmt.Errorf("invalid json on line %d: %w", line, err)
+			}
+			return fmt.Errorf("invalid json: %w", err)
+		}
+	}
+	return nil
+}
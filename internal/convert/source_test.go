@@ -0,0 +1,142 @@
+package convert
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConvertible(t *testing.T) {
+	for path, want := range map[string]bool{
+		"note.md": true, "Board.canvas": true, "config.YAML": true, "deploy.sh": true,
+		"main.go": true, "tool.py": true, "pyproject.toml": true, "photo.png": false, "paper.pdf": false,
+	} {
+		if got := Convertible(path); got != want {
+			t.Errorf("Convertible(%s) = %v", path, got)
+		}
+	}
+}
+
+func TestSourceHighlight(t *testing.T) {
+	options := DefaultPDFOptions()
+	r := &pdfRenderer{pdf: setupPDF(options), options: options}
+	for lang, want := range map[string]codeRun{
+		"yaml":   {text: "name", style: "B"},
+		"json":   {text: `"name"`, style: "B"},
+		"toml":   {text: "# comment", style: "I", gray: 120},
+		"bash":   {text: "echo", style: "B"},
+		"python": {text: "def", style: "B"},
+	} {
+		source := map[string]string{
+			"yaml":   "name: api # comment\n",
+			"json":   `{"name": "api"}`,
+			"toml":   "# comment\nname = \"api\"\n",
+			"bash":   "echo hi\n",
+			"python": "def f(): pass\n",
+		}[lang]
+		found := false
+		for _, runs := range r.highlightCode(lang, source) {
+			for _, run := range runs {
+				found = found || run == want
+			}
+		}
+		if !found {
+			t.Errorf("%s: no %+v in %+v", lang, want, r.highlightCode(lang, source))
+		}
+	}
+}
+
+func TestSourceToPDF(t *testing.T) {
+	converter, err := NewConverter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer converter.Close()
+
+	// a leading document marker isn't frontmatter in a yaml file
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte("---\nremarkable: {pagesize: Letter}\nname: api\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if note, err := ReadNoteOptions(path); err != nil || note.PageSize != "" {
+		t.Errorf("yaml read as a note: %+v, %v", note, err)
+	}
+	pdfPath, err := converter.MarkdownToPDF(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(pdfPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "/MediaBox [0 0 612.00 792.00]") {
+		t.Error("yaml set the page size")
+	}
+}
+
+func TestProcessSource(t *testing.T) {
+	render := func(lineNumbers bool) string {
+		t.Helper()
+		options := DefaultPDFOptions()
+		options.LineNumbers = lineNumbers
+		pdf := setupPDF(options)
+		pdf.SetCompression(false)
+		code := "package main\n\nfunc main() {}\n"
+		if err := (&Converter{}).processSource(pdf, options, "tools/main.go", []byte(code)); err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		if err := pdf.Output(&out); err != nil {
+			t.Fatal(err)
+		}
+		return out.String()
+	}
+
+	data := render(true)
+	if !strings.Contains(data, tj("main.go")) {
+		t.Error("pdf is missing its title")
+	}
+	for _, want := range []string{"1", "3", "package", "func"} {
+		if !strings.Contains(data, "("+pdfText(want)+") Tj") {
+			t.Errorf("pdf is missing %s", want)
+		}
+	}
+	// numbered only when asked to
+	if data := render(false); strings.Contains(data, "("+pdfText("3")+") Tj") {
+		t.Error("lines numbered without --pdf-linenumbers")
+	}
+}
+
+func TestSourceSyntax(t *testing.T) {
+	tests := []struct {
+		language, source, want string
+	}{
+		{"yaml", "name: api\n---\nother: doc\n", ""},
+		{"yaml", "name: api\n---\n- [unclosed\n", "invalid yaml"},
+		{"json", `{"name": "api"}`, ""},
+		{"json", "{\n  \"name\": \"api\",\n}\n", "invalid json on line 3"},
+		{"go", "not go at all {", ""},
+	}
+	for _, tt := range tests {
+		err := checkSyntax(tt.language, []byte(tt.source))
+		if got := fmt.Sprint(err); tt.want == "" && err != nil || tt.want != "" && !strings.Contains(got, tt.want) {
+			t.Errorf("%s %q: got %v, want %q", tt.language, tt.source, err, tt.want)
+		}
+	}
+
+	// the file is printed all the same, with a warning
+	var warnings []string
+	converter := &Converter{logf: func(format string, args ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(format, args...))
+	}}
+	options := DefaultPDFOptions()
+	if err := converter.processSource(setupPDF(options), options, "broken.json", []byte("{")); err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 || !strings.HasPrefix(warnings[0], "warning: broken.json: invalid json") {
+		t.Errorf("warnings are %q", warnings)
+	}
+}
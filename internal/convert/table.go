@@ -0,0 +1,213 @@
+package convert
+
+import (
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	east "github.com/yuin/goldmark/extension/ast"
+)
+
+const (
+	cellPadding = 1.5 // mm inside each side of a cell
+	cellLineH   = 5.0
+)
+
+// tableCell is the text and alignment of one cell, laid out before drawing
+type tableCell struct {
+	text  string
+	align string // gofpdf alignment, L, C or R
+}
+
+// plainText flattens the inline content of a node, for places that can't style it
+func plainText(node ast.Node, source []byte) string {
+	var b strings.Builder
+	ast.Walk(node, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.Text:
+			b.Write(n.Segment.Value(source))
+			if n.SoftLineBreak() {
+				b.WriteByte(' ')
+			}
+		case *ast.String:
+			b.Write(n.Value)
+		case *ast.AutoLink:
+			b.Write(n.Label(source))
+		case *WikiLink:
+			b.WriteString(n.Display())
+		case *Math:
+			b.WriteString(n.TeX)
+		}
+		return ast.WalkContinue, nil
+	})
+	return b.String()
+}
+
+func cellAlign(a east.Alignment) string {
+	switch a {
+	case east.AlignRight:
+		return "R"
+	case east.AlignCenter:
+		return "C"
+	}
+	return "L"
+}
+
+// renderTable draws a gfm table with borders, the header in bold and repeated after page breaks
+func (r *pdfRenderer) renderTable(table *east.Table) {
+	var rows [][]tableCell
+	for row := table.FirstChild(); row != nil; row = row.NextSibling() {
+		var cells []tableCell
+		for cell := row.FirstChild(); cell != nil; cell = cell.NextSibling() {
+			c := tableCell{text: plainText(cell, r.source), align: "L"}
+			if tc, ok := cell.(*east.TableCell); ok {
+				c.align = cellAlign(tc.Alignment)
+			}
+			cells = append(cells, c)
+		}
+		rows = append(rows, cells)
+	}
+	if len(rows) == 0 {
+		return
+	}
+
+	columns := len(table.Alignments)
+	for _, cells := range rows {
+		columns = max(columns, len(cells))
+	}
+
+	r.pdf.Ln(2)
+	widths := r.columnWidths(rows, columns)
+	_, hasHeader := table.FirstChild().(*east.TableHeader)
+	for i, cells := range rows {
+		header := hasHeader && i == 0
+		if r.rowBreaks(cells, widths, header) && hasHeader && !header {
+			// carry the header onto the new page
+			r.drawRow(rows[0], widths, true)
+		}
+		r.drawRow(cells, widths, header)
+	}
+
+	r.pdf.SetFont(mainFamily, r.currentFont(), r.options.FontSize)
+	r.pdf.Ln(3)
+}
+
+// columnWidths fits the columns to the text width: natural widths when they fit,
+// otherwise narrow columns keep theirs and wide ones share what's left
+func (r *pdfRenderer) columnWidths(rows [][]tableCell, columns int) []float64 {
+	natural := make([]float64, columns)
+	for i, cells := range rows {
+		style := ""
+		if i == 0 {
+			style = "B"
+		}
+		r.pdf.SetFont(mainFamily, style, r.options.FontSize)
+		for col, cell := range cells {
+			// CellFormat and SplitText keep the cell margin clear on both sides too
+			natural[col] = max(natural[col], r.pdf.GetStringWidth(cell.text)+2*(cellPadding+r.pdf.GetCellMargin())+0.1)
+		}
+	}
+
+	lMargin, _, rMargin, _ := r.pdf.GetMargins()
+	pageW, _ := r.pdf.GetPageSize()
+	available := pageW - lMargin - rMargin
+
+	sum := 0.0
+	for _, w := range natural {
+		sum += w
+	}
+	if sum <= available {
+		return natural
+	}
+
+	widths := make([]float64, columns)
+	remaining := available
+	share := available / float64(columns)
+	for col, w := range natural {
+		if w <= share {
+			widths[col] = w
+			remaining -= w
+		}
+	}
+
+	// split what's left in proportion to how much each wide column wants
+	total := 0.0
+	for _, w := range natural {
+		if w > share {
+			total += w
+		}
+	}
+	for col, w := range natural {
+		if w > share {
+			widths[col] = remaining * w / total
+		}
+	}
+	return widths
+}
+
+// wrapCell splits a cell's text into the lines that fit its column
+func (r *pdfRenderer) wrapCell(cell tableCell, width float64) []string {
+	if cell.text == "" {
+		return []string{""}
+	}
+	return r.pdf.SplitText(cell.text, width-2*cellPadding)
+}
+
+func (r *pdfRenderer) setCellFont(header bool) {
+	if header {
+		r.pdf.SetFont(mainFamily, "B", r.options.FontSize)
+	} else {
+		r.pdf.SetFont(mainFamily, "", r.options.FontSize)
+	}
+}
+
+// rowHeight is the height of the tallest cell in a row
+func (r *pdfRenderer) rowHeight(cells []tableCell, widths []float64, header bool) float64 {
+	r.setCellFont(header)
+	lines := 1
+	for col, cell := range cells {
+		lines = max(lines, len(r.wrapCell(cell, widths[col])))
+	}
+	return float64(lines)*cellLineH + 2*cellPadding
+}
+
+// rowBreaks starts a new page when the row won't fit on this one and reports whether it did
+func (r *pdfRenderer) rowBreaks(cells []tableCell, widths []float64, header bool) bool {
+	_, pageH := r.pdf.GetPageSize()
+	_, bottom := r.pdf.GetAutoPageBreak()
+	if r.pdf.GetY()+r.rowHeight(cells, widths, header) <= pageH-bottom {
+		return false
+	}
+	r.pdf.AddPage()
+	return true
+}
+
+func (r *pdfRenderer) drawRow(cells []tableCell, widths []float64, header bool) {
+	height := r.rowHeight(cells, widths, header)
+	lMargin, _, _, _ := r.pdf.GetMargins()
+	x, y := lMargin, r.pdf.GetY()
+	if header {
+		r.pdf.SetFillColor(235, 235, 235)
+	}
+
+	for col, width := range widths {
+		style := "D"
+		if header {
+			style = "FD"
+		}
+		r.pdf.Rect(x, y, width, height, style)
+
+		if col < len(cells) {
+			for i, line := range r.wrapCell(cells[col], width) {
+				r.pdf.SetXY(x+cellPadding, y+cellPadding+float64(i)*cellLineH)
+				r.pdf.CellFormat(width-2*cellPadding, cellLineH, line, "", 0, cells[col].align, false, 0, "")
+			}
+		}
+		x += width
+	}
+
+	r.pdf.SetFillColor(255, 255, 255)
+	r.pdf.SetXY(lMargin, y+height)
+}
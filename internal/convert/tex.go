@@ -0,0 +1,1459 @@
+package convert
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/jung-kurt/gofpdf"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+const mmPerPt = 25.4 / 72
+
+// mathStyle is TeX's display, text, script and scriptscript styles
+type mathStyle int
+
+const (
+	displayStyle mathStyle = iota
+	textStyle
+	scriptStyle
+	scriptScriptStyle
+)
+
+// scale is the font size of a style against the text's
+func (s mathStyle) scale() float64 {
+	return [...]float64{1, 1, 0.7, 0.5}[s]
+}
+
+// script is the style of sub- and superscripts
+func (s mathStyle) script() mathStyle {
+	return min(max(s+1, scriptStyle), scriptScriptStyle)
+}
+
+// fraction is the style of numerators and denominators
+func (s mathStyle) fraction() mathStyle {
+	return min(s+1, scriptScriptStyle)
+}
+
+// mathClass decides the space between atoms, as in TeX
+type mathClass int
+
+const (
+	ordClass mathClass = iota
+	opClass
+	binClass
+	relClass
+	openClass
+	closeClass
+	punctClass
+	innerClass
+)
+
+// mathSpacing is TeX's table of the space between atoms by class: 1, 2 and 3 are thin,
+// medium and thick spaces, a, b and c the same but left out of scripts
+var mathSpacing = [...]string{
+	ordClass:   "01bc000a",
+	opClass:    "110c000a",
+	binClass:   "bb00b00b",
+	relClass:   "cc00c00c",
+	openClass:  "00000000",
+	closeClass: "01bc000a",
+	punctClass: "aa0aaaaa",
+	innerClass: "a1bca0aa",
+}
+
+// mathSpace is the space between atoms of two classes, in em
+func mathSpace(left, right mathClass, style mathStyle) float64 {
+	mu := [...]float64{3.0 / 18, 4.0 / 18, 5.0 / 18}
+	switch c := mathSpacing[left][right]; {
+	case c >= '1' && c <= '3':
+		return mu[c-'1']
+	case c >= 'a' && c <= 'c' && style < scriptStyle:
+		return mu[c-'a']
+	}
+	return 0
+}
+
+// mathBox is laid out math: its size around the baseline in mm and how to draw it
+type mathBox struct {
+	width, ascent, descent float64
+	class                  mathClass
+	glue                   bool               // space, which doesn't count as an atom
+	limits                 bool               // scripts go above and below, as on \sum in display
+	skew                   float64            // how far right accents sit, for italic letters
+	draw                   func(x, y float64) // y is the baseline
+}
+
+func emptyBox(width float64) *mathBox {
+	return &mathBox{width: width, draw: func(x, y float64) {}}
+}
+
+type mathSymbol struct {
+	text  string
+	class mathClass
+}
+
+// mathSymbols are the commands for characters, by name without the backslash
+var mathSymbols = map[string]mathSymbol{
+	"alpha": {"α", ordClass}, "beta": {"β", ordClass}, "gamma": {"γ", ordClass}, "delta": {"δ", ordClass},
+	"epsilon": {"ϵ", ordClass}, "varepsilon": {"ε", ordClass}, "zeta": {"ζ", ordClass}, "eta": {"η", ordClass},
+	"theta": {"θ", ordClass}, "vartheta": {"ϑ", ordClass}, "iota": {"ι", ordClass}, "kappa": {"κ", ordClass},
+	"lambda": {"λ", ordClass}, "mu": {"μ", ordClass}, "nu": {"ν", ordClass}, "xi": {"ξ", ordClass},
+	"omicron": {"ο", ordClass}, "pi": {"π", ordClass}, "varpi": {"ϖ", ordClass}, "rho": {"ρ", ordClass},
+	"varrho": {"ϱ", ordClass}, "sigma": {"σ", ordClass}, "varsigma": {"ς", ordClass}, "tau": {"τ", ordClass},
+	"upsilon": {"υ", ordClass}, "phi": {"ϕ", ordClass}, "varphi": {"φ", ordClass}, "chi": {"χ", ordClass},
+	"psi": {"ψ", ordClass}, "omega": {"ω", ordClass},
+	"Gamma": {"Γ", ordClass}, "Delta": {"Δ", ordClass}, "Theta": {"Θ", ordClass}, "Lambda": {"Λ", ordClass},
+	"Xi": {"Ξ", ordClass}, "Pi": {"Π", ordClass}, "Sigma": {"Σ", ordClass}, "Upsilon": {"Υ", ordClass},
+	"Phi": {"Φ", ordClass}, "Psi": {"Ψ", ordClass}, "Omega": {"Ω", ordClass},
+
+	"infty": {"∞", ordClass}, "partial": {"∂", ordClass}, "nabla": {"∇", ordClass}, "forall": {"∀", ordClass},
+	"exists": {"∃", ordClass}, "emptyset": {"∅", ordClass}, "varnothing": {"∅", ordClass}, "neg": {"¬", ordClass},
+	"lnot": {"¬", ordClass}, "angle": {"∠", ordClass}, "prime": {"′", ordClass}, "ell": {"ℓ", ordClass},
+	"hbar": {"ℏ", ordClass}, "Re": {"ℜ", ordClass}, "Im": {"ℑ", ordClass}, "aleph": {"ℵ", ordClass},
+	"ldots": {"…", innerClass}, "dots": {"…", innerClass}, "cdots": {"⋯", innerClass}, "vdots": {"⋮", ordClass},
+	"ddots": {"⋱", innerClass}, "degree": {"°", ordClass}, "circ": {"∘", binClass}, "top": {"⊤", ordClass},
+	"bot": {"⊥", ordClass}, "triangle": {"△", ordClass}, "checkmark": {"✓", ordClass}, "dagger": {"†", ordClass},
+
+	"pm": {"±", binClass}, "mp": {"∓", binClass}, "times": {"×", binClass}, "div": {"÷", binClass},
+	"cdot": {"⋅", binClass}, "ast": {"∗", binClass}, "star": {"⋆", binClass}, "bullet": {"•", binClass},
+	"oplus": {"⊕", binClass}, "otimes": {"⊗", binClass}, "cup": {"∪", binClass}, "cap": {"∩", binClass},
+	"wedge": {"∧", binClass}, "land": {"∧", binClass}, "vee": {"∨", binClass}, "lor": {"∨", binClass},
+	"setminus": {"∖", binClass},
+
+	"leq": {"≤", relClass}, "le": {"≤", relClass}, "geq": {"≥", relClass}, "ge": {"≥", relClass},
+	"neq": {"≠", relClass}, "ne": {"≠", relClass}, "approx": {"≈", relClass}, "equiv": {"≡", relClass},
+	"sim": {"∼", relClass}, "simeq": {"≃", relClass}, "cong": {"≅", relClass}, "propto": {"∝", relClass},
+	"in": {"∈", relClass}, "ni": {"∋", relClass}, "subset": {"⊂", relClass}, "supset": {"⊃", relClass},
+	"subseteq": {"⊆", relClass}, "supseteq": {"⊇", relClass}, "ll": {"≪", relClass}, "gg": {"≫", relClass},
+	"to": {"→", relClass}, "rightarrow": {"→", relClass}, "leftarrow": {"←", relClass}, "gets": {"←", relClass},
+	"leftrightarrow": {"↔", relClass}, "Rightarrow": {"⇒", relClass}, "Leftarrow": {"⇐", relClass},
+	"Leftrightarrow": {"⇔", relClass}, "implies": {"⇒", relClass}, "iff": {"⇔", relClass},
+	"mapsto": {"↦", relClass}, "uparrow": {"↑", relClass}, "downarrow": {"↓", relClass},
+	"perp": {"⊥", relClass}, "parallel": {"∥", relClass}, "mid": {"|", relClass}, "coloneqq": {"≔", relClass},
+
+	"colon": {":", punctClass}, "vert": {"|", ordClass}, "Vert": {"‖", ordClass}, "|": {"‖", ordClass},
+	"{": {"{", openClass}, "}": {"}", closeClass}, "lbrace": {"{", openClass}, "rbrace": {"}", closeClass},
+	"langle": {"⟨", openClass}, "rangle": {"⟩", closeClass}, "lfloor": {"⌊", openClass}, "rfloor": {"⌋", closeClass},
+	"lceil": {"⌈", openClass}, "rceil": {"⌉", closeClass}, "lvert": {"|", openClass}, "rvert": {"|", closeClass},
+	"backslash": {"\\", ordClass}, "%": {"%", ordClass}, "$": {"$", ordClass}, "#": {"#", ordClass},
+	"&": {"&", ordClass}, "_": {"_", ordClass},
+}
+
+// bigOperators grow in display, the integrals more so
+var bigOperators = map[string]string{
+	"sum": "∑", "prod": "∏", "coprod": "∐", "bigcup": "⋃", "bigcap": "⋂", "bigoplus": "⨁",
+	"bigotimes": "⨂", "bigvee": "⋁", "bigwedge": "⋀", "int": "∫", "iint": "∬", "iiint": "∭", "oint": "∮",
+}
+
+// mathFunctions are set upright, those taking limits in display marked true
+var mathFunctions = map[string]bool{
+	"sin": false, "cos": false, "tan": false, "cot": false, "sec": false, "csc": false,
+	"arcsin": false, "arccos": false, "arctan": false, "sinh": false, "cosh": false, "tanh": false,
+	"coth": false, "log": false, "ln": false, "lg": false, "exp": false, "deg": false, "arg": false,
+	"dim": false, "hom": false, "ker": false,
+	"lim": true, "liminf": true, "limsup": true, "max": true, "min": true, "sup": true, "inf": true,
+	"det": true, "gcd": true, "Pr": true,
+}
+
+// mathSpaces are the spacing commands, in em
+var mathSpaces = map[string]float64{
+	",": 3.0 / 18, "thinspace": 3.0 / 18, ":": 4.0 / 18, ">": 4.0 / 18, "medspace": 4.0 / 18,
+	";": 5.0 / 18, "thickspace": 5.0 / 18, "!": -3.0 / 18, " ": 1.0 / 3,
+	"enspace": 0.5, "quad": 1, "qquad": 2,
+}
+
+// mathVariants are the commands switching the font of letters in their argument
+var mathVariants = map[string]string{
+	"mathrm": "rm", "mathup": "rm", "mathsf": "rm", "mathfrak": "rm", "mathbf": "bf", "mathit": "it",
+	"mathtt": "tt", "mathbb": "bb", "mathcal": "it", "mathscr": "it", "boldsymbol": "bi", "bm": "bi",
+}
+
+// textCommands set their argument as words, by gofpdf style
+var textCommands = map[string]string{
+	"text": "", "textrm": "", "textup": "", "textnormal": "", "mbox": "", "textbf": "B", "textit": "I", "emph": "I",
+}
+
+// negations are the symbols \not has a character for
+var negations = map[string]string{
+	"=": "≠", "<": "≮", ">": "≯", "\\equiv": "≢", "\\in": "∉", "\\subset": "⊄", "\\supset": "⊅",
+	"\\leq": "≰", "\\geq": "≱", "\\sim": "≁", "\\approx": "≉", "\\exists": "∄",
+}
+
+// delimiters are what \left, \right and \big take, as the character they stand for;
+// "." is no delimiter at all
+var delimiters = map[string]string{
+	"(": "(", ")": ")", "[": "[", "]": "]", "\\{": "{", "\\}": "}", "\\lbrace": "{", "\\rbrace": "}",
+	"|": "|", "\\vert": "|", "\\lvert": "|", "\\rvert": "|", "\\|": "‖", "\\Vert": "‖", "\\lVert": "‖",
+	"\\rVert": "‖", "\\langle": "⟨", "\\rangle": "⟩", "<": "⟨", ">": "⟩", "\\lfloor": "⌊", "\\rfloor": "⌋",
+	"\\lceil": "⌈", "\\rceil": "⌉", "/": "/", "\\backslash": "\\", ".": "",
+}
+
+// delimiterWidths are the widths of delimiters drawn to size, in em
+var delimiterWidths = map[string]float64{
+	"(": 0.45, "[": 0.4, "{": 0.55, "|": 0.3, "‖": 0.45, "⟨": 0.45, "⌊": 0.45, "⌈": 0.45, "/": 0.6, "\\": 0.6,
+}
+
+// mirroredDelimiters are the closing delimiters, drawn as their opening ones flipped
+var mirroredDelimiters = map[string]string{")": "(", "]": "[", "}": "{", "⟩": "⟨", "⌋": "⌊", "⌉": "⌈"}
+
+// bigDelimiters are \big and its larger kin, by height in em
+var bigDelimiters = map[string]float64{"big": 1.2, "Big": 1.8, "bigg": 2.4, "Bigg": 3}
+
+// typesetter lays out TeX math with the pdf's math font, the main font standing in
+// for characters it lacks
+type typesetter struct {
+	pdf    *gofpdf.Fpdf
+	size   float64               // pt, of text style
+	fonts  map[string]*sfnt.Font // by family, to tell what they have and how tall it is
+	buf    sfnt.Buffer
+	axis   float64 // height of the math axis, where fraction bars go, in em
+	tokens []string
+	pos    int
+}
+
+func newTypesetter(pdf *gofpdf.Fpdf, options PDFOptions, size float64) *typesetter {
+	t := &typesetter{pdf: pdf, size: size, fonts: map[string]*sfnt.Font{}, axis: 0.25}
+	if fonts, err := mathFont(options); err == nil {
+		t.fonts[mathFamily] = glyphs(fonts.style(""))
+	}
+	if fonts, err := familyOf(options.MainFont, bundledMain); err == nil {
+		t.fonts[mainFamily] = glyphs(fonts.style(""))
+	}
+	// the middle of the plus sign
+	if ascent, descent := t.extent(mathFamily, "+", 1); ascent > 0 {
+		t.axis = (ascent - descent) / 2 / mmPerPt
+	}
+	return t
+}
+
+// typeset lays out a formula, in display style for one on its own line, where lines
+// may be broken with \\ and aligned at &
+func (t *typesetter) typeset(tex string, display bool) *mathBox {
+	t.tokens, t.pos = tokenize(tex), 0
+	var box *mathBox
+	if display {
+		box = t.grid("aligned", "", displayStyle, "")
+	} else {
+		box = t.list(textStyle, "")
+	}
+
+	draw := box.draw
+	box.draw = func(x, y float64) {
+		// lines in the color of the text
+		width := t.pdf.GetLineWidth()
+		dr, dg, db := t.pdf.GetDrawColor()
+		fr, fg, fb := t.pdf.GetFillColor()
+		r, g, b := t.pdf.GetTextColor()
+		t.pdf.SetDrawColor(r, g, b)
+		t.pdf.SetFillColor(r, g, b)
+		t.pdf.SetLineCapStyle("round")
+		draw(x, y)
+		t.pdf.SetLineCapStyle("butt")
+		t.pdf.SetLineWidth(width)
+		t.pdf.SetDrawColor(dr, dg, db)
+		t.pdf.SetFillColor(fr, fg, fb)
+	}
+	return box
+}
+
+// tokenize splits TeX into commands, \name or \ and a symbol, single characters and
+// spaces, balancing the braces
+func tokenize(tex string) []string {
+	var tokens []string
+	depth := 0
+	runes := []rune(tex)
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; {
+		case r == '%':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case unicode.IsSpace(r):
+			if len(tokens) > 0 && tokens[len(tokens)-1] != " " {
+				tokens = append(tokens, " ")
+			}
+		case r == '\\' && i+1 < len(runes):
+			j := i + 2
+			if isASCIILetter(runes[i+1]) {
+				for j < len(runes) && isASCIILetter(runes[j]) {
+					j++
+				}
+			}
+			tokens = append(tokens, string(runes[i:j]))
+			i = j - 1
+		case r == '}' && depth == 0:
+		default:
+			depth += map[rune]int{'{': 1, '}': -1}[r]
+			tokens = append(tokens, string(r))
+		}
+	}
+	for ; depth > 0; depth-- {
+		tokens = append(tokens, "}")
+	}
+	return tokens
+}
+
+func isASCIILetter(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+}
+
+// peek is the next token past any spaces, "" at the end
+func (t *typesetter) peek() string {
+	for t.pos < len(t.tokens) && t.tokens[t.pos] == " " {
+		t.pos++
+	}
+	if t.pos >= len(t.tokens) {
+		return ""
+	}
+	return t.tokens[t.pos]
+}
+
+func (t *typesetter) next() string {
+	tok := t.peek()
+	if tok != "" {
+		t.pos++
+	}
+	return tok
+}
+
+// raw is the next {argument} as written, or the next token
+func (t *typesetter) raw() string {
+	if tok := t.next(); tok != "{" {
+		return tok
+	}
+	var b strings.Builder
+	for depth := 1; t.pos < len(t.tokens); t.pos++ {
+		switch tok := t.tokens[t.pos]; tok {
+		case "{":
+			depth++
+		case "}":
+			if depth--; depth == 0 {
+				t.pos++
+				return b.String()
+			}
+		default:
+			b.WriteString(tok)
+		}
+	}
+	return b.String()
+}
+
+// skipOptional passes over an [optional argument]
+func (t *typesetter) skipOptional() {
+	if t.peek() != "[" {
+		return
+	}
+	for t.pos < len(t.tokens) && t.tokens[t.pos] != "]" {
+		t.pos++
+	}
+	if t.pos < len(t.tokens) {
+		t.pos++
+	}
+}
+
+// pt is the font size of a style and em the same in mm
+func (t *typesetter) pt(style mathStyle) float64 {
+	return t.size * style.scale()
+}
+
+func (t *typesetter) em(style mathStyle) float64 {
+	return t.pt(style) * mmPerPt
+}
+
+// rule is the thickness of fraction bars and the lines math is drawn with
+func (t *typesetter) rule(style mathStyle) float64 {
+	return t.em(style) * 0.05
+}
+
+func (t *typesetter) axisHeight(style mathStyle) float64 {
+	return t.axis * t.em(style)
+}
+
+// list lays out atoms up to one of the until tokens or the end of the group
+func (t *typesetter) list(style mathStyle, variant string, until ...string) *mathBox {
+	return t.hlist(t.atoms(style, variant, until...), style)
+}
+
+func (t *typesetter) atoms(style mathStyle, variant string, until ...string) []*mathBox {
+	var items []*mathBox
+	for {
+		tok := t.peek()
+		if tok == "" || tok == "}" || slices.Contains(until, tok) {
+			return items
+		}
+		switch tok {
+		case "^", "_":
+			base := emptyBox(0)
+			if len(items) > 0 {
+				base, items = items[len(items)-1], items[:len(items)-1]
+			}
+			items = append(items, t.scripts(base, style, variant))
+		case "\\displaystyle", "\\textstyle", "\\scriptstyle", "\\scriptscriptstyle":
+			t.pos++
+			style = map[string]mathStyle{
+				"\\displaystyle": displayStyle, "\\textstyle": textStyle,
+				"\\scriptstyle": scriptStyle, "\\scriptscriptstyle": scriptScriptStyle,
+			}[tok]
+		case "\\limits", "\\nolimits":
+			t.pos++
+			if len(items) > 0 {
+				items[len(items)-1].limits = tok == "\\limits"
+			}
+		default:
+			t.pos++
+			if box := t.atom(tok, style, variant); box != nil {
+				items = append(items, box)
+			}
+		}
+	}
+}
+
+// hlist sets boxes side by side with TeX's spacing between them
+func (t *typesetter) hlist(items []*mathBox, style mathStyle) *mathBox {
+	var atoms []*mathBox
+	for _, b := range items {
+		if !b.glue {
+			atoms = append(atoms, b)
+		}
+	}
+	// a binary operator with nothing to act on is ordinary, as the minus of -x
+	for i, b := range atoms {
+		if b.class != binClass {
+			continue
+		}
+		if i == 0 || slices.Contains([]mathClass{binClass, opClass, relClass, openClass, punctClass}, atoms[i-1].class) ||
+			i == len(atoms)-1 || slices.Contains([]mathClass{relClass, closeClass, punctClass}, atoms[i+1].class) {
+			b.class = ordClass
+		}
+	}
+
+	em := t.em(style)
+	var spaced []*mathBox
+	var prev *mathBox
+	for _, b := range items {
+		if !b.glue {
+			if prev != nil {
+				if space := mathSpace(prev.class, b.class, style); space > 0 {
+					spaced = append(spaced, emptyBox(space*em))
+				}
+			}
+			prev = b
+		}
+		spaced = append(spaced, b)
+	}
+	box := concat(spaced...)
+	if len(atoms) == 1 && len(items) == 1 {
+		box.class, box.limits, box.skew = atoms[0].class, atoms[0].limits, atoms[0].skew
+	}
+	return box
+}
+
+// concat sets boxes side by side as they are
+func concat(items ...*mathBox) *mathBox {
+	box := &mathBox{}
+	offsets := make([]float64, len(items))
+	for i, b := range items {
+		offsets[i] = box.width
+		box.width += b.width
+		box.ascent = max(box.ascent, b.ascent)
+		box.descent = max(box.descent, b.descent)
+	}
+	box.draw = func(x, y float64) {
+		for i, b := range items {
+			b.draw(x+offsets[i], y)
+		}
+	}
+	return box
+}
+
+// argument is the next {group} or single atom, as ^, _ and commands take them
+func (t *typesetter) argument(style mathStyle, variant string) *mathBox {
+	if tok := t.next(); tok != "" {
+		if box := t.atom(tok, style, variant); box != nil {
+			return box
+		}
+	}
+	return emptyBox(0)
+}
+
+// atom lays out what a token starts, reading the arguments it takes; nil for tokens
+// that draw nothing
+func (t *typesetter) atom(tok string, style mathStyle, variant string) *mathBox {
+	em := t.em(style)
+	switch tok {
+	case "{":
+		box := t.list(style, variant)
+		t.next()
+		box.class = ordClass
+		return box
+	case "\\frac", "\\dfrac", "\\tfrac", "\\cfrac", "\\binom", "\\dbinom", "\\tbinom":
+		s := style
+		switch tok[1] {
+		case 'd', 'c':
+			s = displayStyle
+		case 't':
+			s = textStyle
+		}
+		num, den := t.argument(s.fraction(), variant), t.argument(s.fraction(), variant)
+		if strings.HasSuffix(tok, "binom") {
+			return t.fenced("(", t.fraction(num, den, s, false), ")", style)
+		}
+		return t.fraction(num, den, s, true)
+	case "\\sqrt":
+		var index *mathBox
+		if t.peek() == "[" {
+			t.pos++
+			index = t.list(scriptScriptStyle, variant, "]")
+			t.next()
+		}
+		return t.root(t.argument(style, variant), index, style)
+	case "\\left":
+		open := t.next()
+		inner := t.list(style, variant, "\\right")
+		close := "."
+		if t.next() == "\\right" {
+			close = t.next()
+		}
+		return t.fenced(open, inner, close, style)
+	case "\\right", "\\middle":
+		return t.delimiter(t.next(), 0, style, ordClass)
+	case "\\begin":
+		return t.environment(t.raw(), style, variant)
+	case "\\end", "\\label", "\\tag", "\\color":
+		t.raw()
+		return nil
+	case "\\textcolor":
+		t.raw()
+		return t.argument(style, variant)
+	case "\\not":
+		return t.not(t.next(), style, variant)
+	case "\\notin":
+		return t.not("\\in", style, variant)
+	case "\\nexists":
+		return t.not("\\exists", style, variant)
+	case "\\overset", "\\stackrel", "\\underset":
+		mark := t.argument(style.script(), variant)
+		base := t.argument(style, variant)
+		if tok == "\\underset" {
+			return t.stack(base, nil, mark, style)
+		}
+		box := t.stack(base, mark, nil, style)
+		if tok == "\\stackrel" {
+			box.class = relClass
+		}
+		return box
+	case "\\operatorname":
+		limits := t.peek() == "*"
+		if limits {
+			t.pos++
+		}
+		box := t.text(t.raw(), "", style)
+		box.class, box.limits = opClass, limits && style == displayStyle
+		return box
+	case "\\overbrace", "\\underbrace", "\\phantom", "\\hphantom", "\\vphantom":
+		box := t.argument(style, variant)
+		if strings.HasSuffix(tok, "phantom") {
+			box.draw = func(x, y float64) {}
+		}
+		return box
+	case "\\\\", "\\cr", "&", "\\nonumber", "\\notag":
+		return nil
+	}
+
+	name, command := strings.CutPrefix(tok, "\\")
+	if !command {
+		return t.char([]rune(tok)[0], style, variant)
+	}
+	if symbol, ok := mathSymbols[name]; ok {
+		r := []rune(symbol.text)[0]
+		box := t.glyph(symbol.text, t.pt(style), letterStyle(r, variant), symbol.class)
+		return box
+	}
+	if symbol, ok := bigOperators[name]; ok {
+		return t.bigOperator(name, symbol, style)
+	}
+	if limits, ok := mathFunctions[name]; ok {
+		box := t.text(name, "", style)
+		box.class, box.limits = opClass, limits && style == displayStyle
+		return box
+	}
+	if space, ok := mathSpaces[name]; ok {
+		box := emptyBox(space * em)
+		box.glue = true
+		return box
+	}
+	if v, ok := mathVariants[name]; ok {
+		return t.argument(style, v)
+	}
+	if fontStyle, ok := textCommands[name]; ok {
+		return t.text(unescapeTeX(t.raw()), fontStyle, style)
+	}
+	if isAccent(name) {
+		return t.accent(name, t.argument(style, variant), style)
+	}
+	if size, ok := bigDelimiters[strings.TrimRight(name, "lrm")]; ok {
+		class := map[byte]mathClass{'l': openClass, 'r': closeClass, 'm': relClass}[name[len(name)-1]]
+		return t.delimiter(t.next(), size*em, style, class)
+	}
+	// unknown commands show as written, so what's missing is plain to see
+	return t.text(tok, "", style)
+}
+
+// unescapeTeX turns the escaped characters of \text arguments back into themselves
+func unescapeTeX(s string) string {
+	return strings.NewReplacer(`\%`, "%", `\$`, "$", `\&`, "&", `\#`, "#", `\_`, "_", `\{`, "{", `\}`, "}", `\ `, " ", "~", " ").Replace(s)
+}
+
+// char lays out a character typed as is: letters are italic, and the few operators
+// on the keyboard get their class and proper glyph
+func (t *typesetter) char(r rune, style mathStyle, variant string) *mathBox {
+	class := ordClass
+	switch r {
+	case '+':
+		class = binClass
+	case '*':
+		r, class = '∗', binClass
+	case '-':
+		r, class = '−', binClass
+	case '=', '<', '>', ':':
+		class = relClass
+	case ',', ';':
+		class = punctClass
+	case '(', '[':
+		class = openClass
+	case ')', ']', '!', '?':
+		class = closeClass
+	case '\'':
+		r = '′'
+	case '~':
+		box := emptyBox(t.em(style) / 3)
+		box.glue = true
+		return box
+	}
+
+	fontStyle := letterStyle(r, variant)
+	switch variant {
+	case "tt":
+		return t.glyphIn(monoFamily, string(r), t.pt(style), "", class)
+	case "bb":
+		if bb, ok := doubleStruck[r]; ok && t.family(string(bb)) != "" {
+			r, fontStyle = bb, ""
+		}
+	}
+	return t.glyph(string(r), t.pt(style), fontStyle, class)
+}
+
+// doubleStruck are the \mathbb letters with a character outside the math alphabets
+var doubleStruck = map[rune]rune{'C': 'ℂ', 'H': 'ℍ', 'N': 'ℕ', 'P': 'ℙ', 'Q': 'ℚ', 'R': 'ℝ', 'Z': 'ℤ'}
+
+// letterStyle is the gofpdf style of a character in a font variant: latin and small
+// greek letters are italic unless the variant says otherwise, everything else upright
+func letterStyle(r rune, variant string) string {
+	switch variant {
+	case "bf", "bb":
+		return "B"
+	case "bi":
+		return "BI"
+	case "rm", "tt":
+		return ""
+	case "it":
+		return "I"
+	}
+	if unicode.IsLetter(r) && (r < 0x370 || unicode.IsLower(r)) {
+		return "I"
+	}
+	return ""
+}
+
+// text lays out words upright in the main font, as \text and function names are
+func (t *typesetter) text(s, fontStyle string, style mathStyle) *mathBox {
+	return t.glyphIn(mainFamily, s, t.pt(style), fontStyle, ordClass)
+}
+
+// glyph lays out characters in the math font, or the main font when the math one lacks
+// them; symbols neither has are drawn with lines or stood in for
+func (t *typesetter) glyph(s string, size float64, fontStyle string, class mathClass) *mathBox {
+	if family := t.family(s); family != "" {
+		return t.glyphIn(family, s, size, fontStyle, class)
+	}
+	if r := []rune(s); len(r) == 1 {
+		if symbol, ok := drawnSymbols[r[0]]; ok {
+			return t.drawn(symbol, size, class)
+		}
+		if alt, ok := standIns[r[0]]; ok {
+			return t.glyph(alt, size, fontStyle, class)
+		}
+	}
+	return t.glyphIn(mathFamily, s, size, fontStyle, class)
+}
+
+func (t *typesetter) glyphIn(family, s string, size float64, fontStyle string, class mathClass) *mathBox {
+	t.pdf.SetFont(family, fontStyle, size)
+	box := &mathBox{width: t.pdf.GetStringWidth(s), class: class}
+	box.ascent, box.descent = t.extent(family, s, size)
+	if strings.Contains(fontStyle, "I") {
+		box.skew = box.ascent * 0.2
+	}
+	box.draw = func(x, y float64) {
+		t.pdf.SetFont(family, fontStyle, size)
+		t.pdf.Text(x, y, s)
+	}
+	return box
+}
+
+// family is the font family that has all of s, the math font first; "" for none
+func (t *typesetter) family(s string) string {
+	for _, family := range []string{mathFamily, mainFamily} {
+		if t.has(family, s) {
+			return family
+		}
+	}
+	return ""
+}
+
+func (t *typesetter) has(family, s string) bool {
+	f := t.fonts[family]
+	if f == nil {
+		// a font that can't be read is trusted to have everything
+		return true
+	}
+	for _, r := range s {
+		if i, err := f.GlyphIndex(&t.buf, r); err != nil || i == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// extent is how far text reaches above and below the baseline, from its outlines
+func (t *typesetter) extent(family, s string, size float64) (ascent, descent float64) {
+	em := size * mmPerPt
+	f := t.fonts[family]
+	if f == nil {
+		return 0.7 * em, 0.2 * em
+	}
+	ppem := fixed.I(int(f.UnitsPerEm()))
+	for _, r := range s {
+		i, err := f.GlyphIndex(&t.buf, r)
+		if err != nil || i == 0 {
+			continue
+		}
+		bounds, _, err := f.GlyphBounds(&t.buf, i, ppem, font.HintingNone)
+		if err != nil {
+			continue
+		}
+		ascent = max(ascent, -float64(bounds.Min.Y)/float64(ppem)*em)
+		descent = max(descent, float64(bounds.Max.Y)/float64(ppem)*em)
+	}
+	return ascent, descent
+}
+
+// raise moves a box up, or down for a negative distance
+func raise(box *mathBox, up float64) *mathBox {
+	raised := *box
+	raised.ascent, raised.descent = box.ascent+up, box.descent-up
+	raised.draw = func(x, y float64) { box.draw(x, y-up) }
+	return &raised
+}
+
+// polyline draws lines joining points given as x, y pairs
+func (t *typesetter) polyline(width float64, points ...float64) {
+	t.pdf.SetLineWidth(width)
+	for i := 0; i+3 < len(points); i += 2 {
+		t.pdf.Line(points[i], points[i+1], points[i+2], points[i+3])
+	}
+}
+
+// bigOperator is \sum, \int and the like, grown in display and centered on the axis;
+// integrals keep their scripts to the side
+func (t *typesetter) bigOperator(name, symbol string, style mathStyle) *mathBox {
+	integral := strings.HasSuffix(name, "int")
+	scale := 1.0
+	switch {
+	case style == displayStyle && integral:
+		scale = 2
+	case style == displayStyle:
+		scale = 1.4
+	case integral:
+		scale = 1.3
+	}
+	box := t.glyph(symbol, t.pt(style)*scale, "", opClass)
+	box = raise(box, t.axisHeight(style)-(box.ascent-box.descent)/2)
+	box.limits = style == displayStyle && !integral
+	return box
+}
+
+// scripts sets the ^superscript and _subscript that follow base
+func (t *typesetter) scripts(base *mathBox, style mathStyle, variant string) *mathBox {
+	var sup, sub *mathBox
+	for {
+		switch t.peek() {
+		case "^":
+			t.pos++
+			sup = t.argument(style.script(), variant)
+		case "_":
+			t.pos++
+			sub = t.argument(style.script(), variant)
+		default:
+			if base.limits {
+				return t.stack(base, sup, sub, style)
+			}
+			return t.attach(base, sup, sub, style)
+		}
+	}
+}
+
+// attach sets scripts to the right of base, raised and lowered the way TeX does
+func (t *typesetter) attach(base, sup, sub *mathBox, style mathStyle) *mathBox {
+	if sup == nil && sub == nil {
+		return base
+	}
+	em, script := t.em(style), t.em(style.script())
+	var up, down, width float64
+	if sup != nil {
+		least := 0.363
+		if style == displayStyle {
+			least = 0.413
+		}
+		up = max(base.ascent-script*0.386, em*least, sup.descent+em*0.108)
+		width = sup.width
+	}
+	if sub != nil {
+		down = max(base.descent+script*0.05, em*0.15)
+		if sup == nil {
+			down = max(down, sub.ascent-em*0.344)
+		} else {
+			down = max(down, em*0.247)
+			// scripts kept apart
+			if gap := (up - sup.descent) - (sub.ascent - down); gap < em*0.16 {
+				down += em*0.16 - gap
+			}
+		}
+		width = max(width, sub.width)
+	}
+
+	box := &mathBox{width: base.width + width + em*0.05, ascent: base.ascent, descent: base.descent, class: base.class}
+	if sup != nil {
+		box.ascent = max(box.ascent, up+sup.ascent)
+	}
+	if sub != nil {
+		box.descent = max(box.descent, down+sub.descent)
+	}
+	box.draw = func(x, y float64) {
+		base.draw(x, y)
+		if sup != nil {
+			sup.draw(x+base.width, y-up)
+		}
+		if sub != nil {
+			sub.draw(x+base.width, y+down)
+		}
+	}
+	return box
+}
+
+// stack sets over above base and under below it, centered, as limits go on \sum
+func (t *typesetter) stack(base, over, under *mathBox, style mathStyle) *mathBox {
+	em := t.em(style)
+	gap := em * 0.15
+	box := &mathBox{width: base.width, ascent: base.ascent, descent: base.descent, class: base.class}
+	var up, down float64
+	if over != nil {
+		up = base.ascent + gap + over.descent
+		box.ascent = up + over.ascent + em*0.1
+		box.width = max(box.width, over.width)
+	}
+	if under != nil {
+		down = base.descent + gap + under.ascent
+		box.descent = down + under.descent + em*0.1
+		box.width = max(box.width, under.width)
+	}
+	box.draw = func(x, y float64) {
+		base.draw(x+(box.width-base.width)/2, y)
+		if over != nil {
+			over.draw(x+(box.width-over.width)/2, y-up)
+		}
+		if under != nil {
+			under.draw(x+(box.width-under.width)/2, y+down)
+		}
+	}
+	return box
+}
+
+// fraction sets num over den, with a bar between them unless it's a binomial
+func (t *typesetter) fraction(num, den *mathBox, style mathStyle, bar bool) *mathBox {
+	em, axis, rule := t.em(style), t.axisHeight(style), t.rule(style)
+	gap, numShift, denShift := rule*1.5, 0.394, 0.345
+	if style == displayStyle {
+		gap, numShift, denShift = rule*3, 0.677, 0.686
+	}
+	if !bar {
+		gap, rule = gap*2, 0
+	}
+	up := max(axis+rule/2+gap+num.descent, em*numShift)
+	down := max(den.ascent+gap+rule/2-axis, em*denShift)
+
+	pad := em * 0.12
+	box := &mathBox{width: max(num.width, den.width) + 2*pad, class: innerClass}
+	box.ascent, box.descent = up+num.ascent, down+den.descent
+	box.draw = func(x, y float64) {
+		num.draw(x+(box.width-num.width)/2, y-up)
+		den.draw(x+(box.width-den.width)/2, y+down)
+		if bar {
+			t.polyline(rule, x+pad, y-axis, x+box.width-pad, y-axis)
+		}
+	}
+	return box
+}
+
+// root draws the radical sign over x, with the index in its crook
+func (t *typesetter) root(x, index *mathBox, style mathStyle) *mathBox {
+	em, rule := t.em(style), t.rule(style)
+	gap := rule + em*0.1
+	if style == displayStyle {
+		gap = rule + em*0.2
+	}
+	top, bottom := x.ascent+gap+rule, max(x.descent, em*0.05)+em*0.05
+	height, sign := top+bottom, em*0.6
+
+	lead, indexUp := 0.0, 0.0
+	if index != nil {
+		lead = max(0, index.width-sign*0.45)
+		indexUp = height*0.55 - bottom + index.descent
+	}
+	box := &mathBox{width: lead + sign + x.width + em*0.15, ascent: top + rule/2, descent: bottom}
+	if index != nil {
+		box.ascent = max(box.ascent, indexUp+index.ascent)
+	}
+	box.draw = func(x0, y float64) {
+		sx, floor, ceiling := x0+lead, y+bottom, y-top
+		t.polyline(rule, sx, floor-height*0.42, sx+sign*0.2, floor-height*0.48)
+		t.polyline(rule*2, sx+sign*0.2, floor-height*0.48, sx+sign*0.5, floor)
+		t.polyline(rule, sx+sign*0.5, floor, sx+sign, ceiling, x0+box.width, ceiling)
+		x.draw(sx+sign+em*0.05, y)
+		if index != nil {
+			index.draw(sx+sign*0.45-index.width, y-indexUp)
+		}
+	}
+	return box
+}
+
+// fenced puts delimiters around inner, grown to cover it
+func (t *typesetter) fenced(open string, inner *mathBox, close string, style mathStyle) *mathBox {
+	axis := t.axisHeight(style)
+	half := max(inner.ascent-axis, inner.descent+axis)
+	// as TeX, delimiters may fall a little short of what they enclose
+	height := max(2*half*0.901, 2*half-t.em(style)*0.5)
+	box := concat(t.delimiter(open, height, style, openClass), inner, t.delimiter(close, height, style, closeClass))
+	box.class = innerClass
+	return box
+}
+
+// delimiter is a fence like ( or \{ at least height tall, centered on the axis: the
+// font's glyph when that's tall enough, otherwise drawn to size
+func (t *typesetter) delimiter(tok string, height float64, style mathStyle, class mathClass) *mathBox {
+	d, ok := delimiters[tok]
+	if !ok {
+		d = strings.TrimPrefix(tok, "\\")
+	}
+	em := t.em(style)
+	if d == "" {
+		return emptyBox(em * 0.12)
+	}
+	if height <= em*1.1 || delimiterWidths[mirrored(d)] == 0 {
+		return t.glyph(d, t.pt(style), "", class)
+	}
+
+	axis, width := t.axisHeight(style), delimiterWidths[mirrored(d)]*em
+	return &mathBox{
+		width: width, ascent: axis + height/2, descent: height/2 - axis, class: class,
+		draw: func(x, y float64) {
+			t.drawDelimiter(d, x, y-axis-height/2, width, height, t.rule(style)*1.6)
+		},
+	}
+}
+
+func mirrored(d string) string {
+	if open, ok := mirroredDelimiters[d]; ok {
+		return open
+	}
+	return d
+}
+
+// drawDelimiter draws a delimiter with lines in the box from x, top
+func (t *typesetter) drawDelimiter(d string, x, top, width, height, line float64) {
+	open, mirror := mirroredDelimiters[d]
+	if !mirror {
+		open = d
+	}
+	px := func(u float64) float64 {
+		if mirror {
+			u = 1 - u
+		}
+		return x + u*width
+	}
+	bottom, mid := top+height, top+height/2
+	t.pdf.SetLineWidth(line)
+
+	switch open {
+	case "(":
+		t.pdf.CurveBezierCubic(px(0.8), top, px(0.15), top+height*0.2, px(0.15), bottom-height*0.2, px(0.8), bottom, "D")
+	case "[":
+		t.polyline(line, px(0.8), top, px(0.3), top, px(0.3), bottom, px(0.8), bottom)
+	case "{":
+		hook := min(width*0.45, height*0.12)
+		t.pdf.CurveBezierCubic(px(0.85), top, px(0.45), top, px(0.45), top, px(0.45), top+hook, "D")
+		t.polyline(line, px(0.45), top+hook, px(0.45), mid-hook)
+		t.pdf.CurveBezierCubic(px(0.45), mid-hook, px(0.45), mid, px(0.45), mid, px(0.1), mid, "D")
+		t.pdf.CurveBezierCubic(px(0.1), mid, px(0.45), mid, px(0.45), mid, px(0.45), mid+hook, "D")
+		t.polyline(line, px(0.45), mid+hook, px(0.45), bottom-hook)
+		t.pdf.CurveBezierCubic(px(0.45), bottom-hook, px(0.45), bottom, px(0.45), bottom, px(0.85), bottom, "D")
+	case "⟨":
+		t.polyline(line, px(0.8), top, px(0.2), mid, px(0.8), bottom)
+	case "⌊":
+		t.polyline(line, px(0.35), top, px(0.35), bottom, px(0.85), bottom)
+	case "⌈":
+		t.polyline(line, px(0.85), top, px(0.35), top, px(0.35), bottom)
+	case "|":
+		t.polyline(line, px(0.5), top, px(0.5), bottom)
+	case "‖":
+		t.polyline(line, px(0.35), top, px(0.35), bottom)
+		t.polyline(line, px(0.65), top, px(0.65), bottom)
+	case "/":
+		t.polyline(line, px(0.85), top, px(0.15), bottom)
+	case "\\":
+		t.polyline(line, px(0.15), top, px(0.85), bottom)
+	}
+}
+
+// environment lays out \begin{name} ... \end{name}: matrices, cases, arrays and
+// aligned equations
+func (t *typesetter) environment(name string, style mathStyle, variant string) *mathBox {
+	var spec string
+	switch name {
+	case "array", "alignat", "alignat*", "alignedat":
+		spec = t.raw()
+	}
+	cellStyle := max(style, textStyle)
+	switch {
+	case name == "smallmatrix":
+		cellStyle = scriptStyle
+	case isAlign(name) || strings.HasPrefix(name, "gather") || strings.HasPrefix(name, "equation") || name == "multline":
+		cellStyle = style
+	}
+	if strings.HasPrefix(name, "alignat") {
+		spec = ""
+	}
+	grid := t.grid(name, spec, cellStyle, variant)
+
+	fences := map[string][2]string{
+		"pmatrix": {"(", ")"}, "bmatrix": {"[", "]"}, "Bmatrix": {"\\{", "\\}"}, "vmatrix": {"|", "|"},
+		"Vmatrix": {"\\|", "\\|"}, "cases": {"\\{", "."}, "rcases": {".", "\\}"},
+	}
+	if f, ok := fences[name]; ok {
+		return t.fenced(f[0], grid, f[1], style)
+	}
+	return grid
+}
+
+func isAlign(name string) bool {
+	switch strings.TrimSuffix(name, "*") {
+	case "align", "aligned", "alignat", "alignedat", "split", "flalign", "eqnarray":
+		return true
+	}
+	return false
+}
+
+// grid lays out rows split by \\ and cells by &, up to \end or the end of the formula,
+// centered on the axis with the columns lined up as the environment has them
+func (t *typesetter) grid(name, spec string, style mathStyle, variant string) *mathBox {
+	var rows [][]*mathBox
+	var row []*mathBox
+cells:
+	for {
+		var lead []*mathBox
+		if isAlign(name) && len(row)%2 == 1 {
+			// the relation after an & is spaced as if something came before it
+			lead = []*mathBox{emptyBox(0)}
+		}
+		row = append(row, t.hlist(append(lead, t.atoms(style, variant, "&", "\\\\", "\\cr", "\\end")...), style))
+		switch t.next() {
+		case "&":
+			continue
+		case "\\\\", "\\cr":
+			t.skipOptional()
+			rows, row = append(rows, row), nil
+			continue
+		case "\\end":
+			t.raw()
+		}
+		break cells
+	}
+	// a \\ ending the last line leaves an empty one
+	if len(rows) == 0 || len(row) > 1 || row[0].width > 0 {
+		rows = append(rows, row)
+	}
+	if len(rows) == 1 && len(rows[0]) == 1 {
+		return rows[0][0]
+	}
+
+	em := t.em(style)
+	cols := 0
+	for _, row := range rows {
+		cols = max(cols, len(row))
+	}
+	widths := make([]float64, cols)
+	for _, row := range rows {
+		for j, cell := range row {
+			widths[j] = max(widths[j], cell.width)
+		}
+	}
+	lefts := make([]float64, cols)
+	width := 0.0
+	for j := range widths {
+		if j > 0 {
+			width += columnGap(name, j, em)
+		}
+		lefts[j] = width
+		width += widths[j]
+	}
+
+	// rows at least a line apart, a little more between equations
+	gap := 0.0
+	if style == displayStyle {
+		gap = em * 0.25
+	}
+	ascents, descents := make([]float64, len(rows)), make([]float64, len(rows))
+	height := gap * float64(len(rows)-1)
+	for i, row := range rows {
+		ascents[i], descents[i] = em*0.84, em*0.36
+		for _, cell := range row {
+			ascents[i] = max(ascents[i], cell.ascent)
+			descents[i] = max(descents[i], cell.descent)
+		}
+		height += ascents[i] + descents[i]
+	}
+
+	axis := t.axisHeight(style)
+	box := &mathBox{width: width, ascent: height/2 + axis, descent: height/2 - axis}
+	box.draw = func(x, y float64) {
+		baseline := y - box.ascent
+		for i, row := range rows {
+			baseline += ascents[i]
+			for j, cell := range row {
+				offset := 0.0
+				switch columnAlign(name, spec, j, cols) {
+				case 'c':
+					offset = (widths[j] - cell.width) / 2
+				case 'r':
+					offset = widths[j] - cell.width
+				}
+				cell.draw(x+lefts[j]+offset, baseline)
+			}
+			baseline += descents[i] + gap
+		}
+	}
+	return box
+}
+
+// columnAlign is how a column lines up: as an array's spec says, left in cases, the
+// sides of the relations in aligned equations, centered otherwise
+func columnAlign(name, spec string, col, cols int) byte {
+	if spec != "" {
+		var aligns []byte
+		for _, c := range []byte(spec) {
+			if c == 'l' || c == 'c' || c == 'r' {
+				aligns = append(aligns, c)
+			}
+		}
+		if col < len(aligns) {
+			return aligns[col]
+		}
+	}
+	switch {
+	case name == "cases" || name == "rcases":
+		return 'l'
+	case isAlign(name) && cols > 1 && col%2 == 0:
+		return 'r'
+	case isAlign(name) && cols > 1:
+		return 'l'
+	}
+	return 'c'
+}
+
+// columnGap is the space before a column: aligned equations pair their columns
+// around the relations
+func columnGap(name string, col int, em float64) float64 {
+	if isAlign(name) {
+		if col%2 == 1 {
+			return 0
+		}
+		return 2 * em
+	}
+	return em
+}
+
+func isAccent(name string) bool {
+	switch name {
+	case "hat", "widehat", "check", "tilde", "widetilde", "bar", "overline", "underline", "vec",
+		"overrightarrow", "dot", "ddot", "acute", "grave", "breve":
+		return true
+	}
+	return false
+}
+
+// accent puts a mark like a hat or a bar over base, or a line under it
+func (t *typesetter) accent(name string, base *mathBox, style mathStyle) *mathBox {
+	em, rule := t.em(style), t.rule(style)
+	gap := em * 0.08
+	height := map[string]float64{"bar": rule, "overline": rule, "underline": rule, "vec": 0.2 * em,
+		"overrightarrow": 0.2 * em, "acute": 0.18 * em, "grave": 0.18 * em}[name]
+	if height == 0 {
+		height = 0.14 * em
+	}
+	wide := strings.HasPrefix(name, "wide") || strings.HasPrefix(name, "over") || name == "underline"
+
+	box := *base
+	top := max(base.ascent, em*0.45) + gap
+	if name == "underline" {
+		box.descent = base.descent + gap + rule
+	} else {
+		box.ascent = top + height
+	}
+	box.draw = func(x, y float64) {
+		base.draw(x, y)
+		cx, ty := x+base.width/2, y-top
+		half := min(em*0.22, base.width/2)
+		if !wide {
+			cx += base.skew
+		} else {
+			half = base.width / 2
+		}
+		switch name {
+		case "bar", "overline":
+			t.polyline(rule, cx-half, ty-rule/2, cx+half, ty-rule/2)
+		case "underline":
+			t.polyline(rule, x, y+base.descent+gap+rule/2, x+base.width, y+base.descent+gap+rule/2)
+		case "check":
+			t.polyline(rule, cx-half, ty-height, cx, ty, cx+half, ty-height)
+		case "tilde", "widetilde":
+			t.pdf.SetLineWidth(rule)
+			t.pdf.CurveBezierCubic(cx-half, ty-height*0.2, cx-half/3, ty-height*1.3, cx+half/3, ty+height*0.3, cx+half, ty-height, "D")
+		case "vec", "overrightarrow":
+			t.polyline(rule, cx-half, ty-height/2, cx+half, ty-height/2)
+			t.polyline(rule, cx+half-height/2, ty-height, cx+half, ty-height/2, cx+half-height/2, ty)
+		case "dot":
+			t.pdf.Circle(cx, ty-height/2, em*0.045, "F")
+		case "ddot":
+			t.pdf.Circle(cx-em*0.11, ty-height/2, em*0.045, "F")
+			t.pdf.Circle(cx+em*0.11, ty-height/2, em*0.045, "F")
+		case "acute":
+			t.polyline(rule*1.5, cx-half*0.3, ty, cx+half*0.5, ty-height)
+		case "grave":
+			t.polyline(rule*1.5, cx+half*0.3, ty, cx-half*0.5, ty-height)
+		case "breve":
+			t.pdf.SetLineWidth(rule)
+			t.pdf.CurveBezierCubic(cx-half, ty-height, cx-half, ty, cx+half, ty, cx+half, ty-height, "D")
+		default:
+			t.polyline(rule, cx-half, ty, cx, ty-height, cx+half, ty)
+		}
+	}
+	return &box
+}
+
+// not strikes through the symbol that follows, or takes its negated character when
+// a font has one
+func (t *typesetter) not(tok string, style mathStyle, variant string) *mathBox {
+	if negated, ok := negations[tok]; ok && t.family(negated) != "" {
+		return t.glyph(negated, t.pt(style), "", relClass)
+	}
+	base := emptyBox(t.em(style) * 0.5)
+	if tok != "" {
+		if box := t.atom(tok, style, variant); box != nil {
+			base = box
+		}
+	}
+	em, axis := t.em(style), t.axisHeight(style)
+	struck := *base
+	struck.draw = func(x, y float64) {
+		base.draw(x, y)
+		cx, a := x+base.width/2, y-axis
+		t.polyline(t.rule(style)*1.2, cx+em*0.18, a-em*0.42, cx-em*0.18, a+em*0.42)
+	}
+	return &struck
+}
+
+// drawnSymbol is a symbol drawn with lines for want of a font that has it; its size
+// is in em, ascent and descent from the axis for those centered on it
+type drawnSymbol struct {
+	width, ascent, descent float64
+	centered               bool
+	draw                   func(t *typesetter, x, y, axis, u float64) // u is the em
+}
+
+// drawn lays out a drawn symbol at a font size
+func (t *typesetter) drawn(symbol drawnSymbol, size float64, class mathClass) *mathBox {
+	u := size * mmPerPt
+	axis := t.axis * u
+	box := &mathBox{width: symbol.width * u, ascent: symbol.ascent * u, descent: symbol.descent * u, class: class}
+	if symbol.centered {
+		box.ascent, box.descent = box.ascent+axis, box.descent-axis
+	}
+	box.draw = func(x, y float64) {
+		t.pdf.SetLineWidth(u * 0.06)
+		symbol.draw(t, x, y, y-axis, u)
+	}
+	return box
+}
+
+// halfCircle draws the open side of ⊂, ⊃ and ∈: a half circle opening right, or left
+// when mirrored, with arms of the same length
+func (t *typesetter) halfCircle(x, a, width, r float64, mirror bool) {
+	const k = 0.5523 // for quarter circles of bézier curves
+	px := func(u float64) float64 {
+		if mirror {
+			return x + width - u
+		}
+		return x + u
+	}
+	cx := r + width*0.1
+	t.pdf.CurveBezierCubic(px(cx), a-r, px(cx-k*r), a-r, px(cx-r), a-k*r, px(cx-r), a, "D")
+	t.pdf.CurveBezierCubic(px(cx-r), a, px(cx-r), a+k*r, px(cx-k*r), a+r, px(cx), a+r, "D")
+	t.pdf.Line(px(cx), a-r, px(width*0.9), a-r)
+	t.pdf.Line(px(cx), a+r, px(width*0.9), a+r)
+}
+
+// doubleArrow draws ⇒, ⇐ when mirrored, and ⇔ with heads at both ends
+func doubleArrow(t *typesetter, x, a, width, u float64, left, right bool) {
+	t.pdf.Line(x+0.1*u, a-0.1*u, x+width-0.1*u, a-0.1*u)
+	t.pdf.Line(x+0.1*u, a+0.1*u, x+width-0.1*u, a+0.1*u)
+	if right {
+		t.polyline(u*0.06, x+width-0.35*u, a-0.28*u, x+width-0.06*u, a, x+width-0.35*u, a+0.28*u)
+	}
+	if left {
+		t.polyline(u*0.06, x+0.35*u, a-0.28*u, x+0.06*u, a, x+0.35*u, a+0.28*u)
+	}
+}
+
+// drawnSymbols stand in for the math symbols fonts most often lack
+var drawnSymbols = map[rune]drawnSymbol{
+	'∀': {0.7, 0.7, 0, false, func(t *typesetter, x, y, a, u float64) {
+		t.polyline(u*0.06, x+0.08*u, y-0.7*u, x+0.35*u, y, x+0.62*u, y-0.7*u)
+		t.pdf.Line(x+0.19*u, y-0.4*u, x+0.51*u, y-0.4*u)
+	}},
+	'∃': {0.62, 0.7, 0, false, func(t *typesetter, x, y, a, u float64) {
+		t.polyline(u*0.06, x+0.1*u, y-0.7*u, x+0.52*u, y-0.7*u, x+0.52*u, y, x+0.1*u, y)
+		t.pdf.Line(x+0.15*u, y-0.35*u, x+0.52*u, y-0.35*u)
+	}},
+	'∇': {0.8, 0.7, 0, false, func(t *typesetter, x, y, a, u float64) {
+		t.polyline(u*0.06, x+0.08*u, y-0.7*u, x+0.72*u, y-0.7*u, x+0.4*u, y, x+0.08*u, y-0.7*u)
+	}},
+	'∈': {0.72, 0.3, 0.3, true, func(t *typesetter, x, y, a, u float64) {
+		t.halfCircle(x, a, 0.72*u, 0.27*u, false)
+		t.pdf.Line(x+0.07*u, a, x+0.65*u, a)
+	}},
+	'∋': {0.72, 0.3, 0.3, true, func(t *typesetter, x, y, a, u float64) {
+		t.halfCircle(x, a, 0.72*u, 0.27*u, true)
+		t.pdf.Line(x+0.07*u, a, x+0.65*u, a)
+	}},
+	'⊂': {0.8, 0.32, 0.32, true, func(t *typesetter, x, y, a, u float64) { t.halfCircle(x, a, 0.8*u, 0.3*u, false) }},
+	'⊃': {0.8, 0.32, 0.32, true, func(t *typesetter, x, y, a, u float64) { t.halfCircle(x, a, 0.8*u, 0.3*u, true) }},
+	'⊆': {0.8, 0.42, 0.42, true, func(t *typesetter, x, y, a, u float64) {
+		t.halfCircle(x, a-0.1*u, 0.8*u, 0.28*u, false)
+		t.pdf.Line(x+0.1*u, a+0.38*u, x+0.72*u, a+0.38*u)
+	}},
+	'⊇': {0.8, 0.42, 0.42, true, func(t *typesetter, x, y, a, u float64) {
+		t.halfCircle(x, a-0.1*u, 0.8*u, 0.28*u, true)
+		t.pdf.Line(x+0.08*u, a+0.38*u, x+0.7*u, a+0.38*u)
+	}},
+	'⇒': {1, 0.3, 0.3, true, func(t *typesetter, x, y, a, u float64) { doubleArrow(t, x, a, u, u, false, true) }},
+	'⇐': {1, 0.3, 0.3, true, func(t *typesetter, x, y, a, u float64) { doubleArrow(t, x, a, u, u, true, false) }},
+	'⇔': {1.15, 0.3, 0.3, true, func(t *typesetter, x, y, a, u float64) { doubleArrow(t, x, a, 1.15*u, u, true, true) }},
+	'↦': {1, 0.22, 0.22, true, func(t *typesetter, x, y, a, u float64) {
+		t.pdf.Line(x+0.08*u, a-0.2*u, x+0.08*u, a+0.2*u)
+		t.pdf.Line(x+0.08*u, a, x+0.92*u, a)
+		t.polyline(u*0.06, x+0.7*u, a-0.2*u, x+0.92*u, a, x+0.7*u, a+0.2*u)
+	}},
+	'∘': {0.5, 0.16, 0.16, true, func(t *typesetter, x, y, a, u float64) { t.pdf.Circle(x+0.25*u, a, 0.14*u, "D") }},
+	'⋅': {0.3, 0.05, 0.05, true, func(t *typesetter, x, y, a, u float64) { t.pdf.Circle(x+0.15*u, a, 0.05*u, "F") }},
+	'⊕': {0.78, 0.32, 0.32, true, func(t *typesetter, x, y, a, u float64) {
+		t.pdf.Circle(x+0.39*u, a, 0.3*u, "D")
+		t.pdf.Line(x+0.09*u, a, x+0.69*u, a)
+		t.pdf.Line(x+0.39*u, a-0.3*u, x+0.39*u, a+0.3*u)
+	}},
+	'⊗': {0.78, 0.32, 0.32, true, func(t *typesetter, x, y, a, u float64) {
+		t.pdf.Circle(x+0.39*u, a, 0.3*u, "D")
+		t.pdf.Line(x+0.18*u, a-0.21*u, x+0.6*u, a+0.21*u)
+		t.pdf.Line(x+0.18*u, a+0.21*u, x+0.6*u, a-0.21*u)
+	}},
+	'∧': {0.8, 0.35, 0.3, true, func(t *typesetter, x, y, a, u float64) {
+		t.polyline(u*0.06, x+0.1*u, a+0.3*u, x+0.4*u, a-0.35*u, x+0.7*u, a+0.3*u)
+	}},
+	'∨': {0.8, 0.3, 0.35, true, func(t *typesetter, x, y, a, u float64) {
+		t.polyline(u*0.06, x+0.1*u, a-0.3*u, x+0.4*u, a+0.35*u, x+0.7*u, a-0.3*u)
+	}},
+	'⊥': {0.75, 0.68, 0, false, func(t *typesetter, x, y, a, u float64) {
+		t.pdf.Line(x+0.375*u, y-0.68*u, x+0.375*u, y)
+		t.pdf.Line(x+0.08*u, y, x+0.67*u, y)
+	}},
+	'⊤': {0.75, 0.68, 0, false, func(t *typesetter, x, y, a, u float64) {
+		t.pdf.Line(x+0.375*u, y-0.68*u, x+0.375*u, y)
+		t.pdf.Line(x+0.08*u, y-0.68*u, x+0.67*u, y-0.68*u)
+	}},
+	'∥': {0.5, 0.5, 0.5, true, func(t *typesetter, x, y, a, u float64) {
+		t.pdf.Line(x+0.17*u, a-0.5*u, x+0.17*u, a+0.5*u)
+		t.pdf.Line(x+0.33*u, a-0.5*u, x+0.33*u, a+0.5*u)
+	}},
+	'∠': {0.75, 0.6, 0, false, func(t *typesetter, x, y, a, u float64) {
+		t.polyline(u*0.06, x+0.65*u, y-0.6*u, x+0.08*u, y, x+0.7*u, y)
+	}},
+	'∓': {0.78, 0.35, 0.35, true, func(t *typesetter, x, y, a, u float64) {
+		t.pdf.Line(x+0.1*u, a-0.3*u, x+0.68*u, a-0.3*u)
+		t.pdf.Line(x+0.1*u, a+0.08*u, x+0.68*u, a+0.08*u)
+		t.pdf.Line(x+0.39*u, a-0.15*u, x+0.39*u, a+0.32*u)
+	}},
+	'∅': {0.8, 0.75, 0.05, false, func(t *typesetter, x, y, a, u float64) {
+		t.pdf.Circle(x+0.4*u, y-0.35*u, 0.3*u, "D")
+		t.pdf.Line(x+0.65*u, y-0.75*u, x+0.15*u, y+0.05*u)
+	}},
+	'∖': {0.6, 0.75, 0.2, false, func(t *typesetter, x, y, a, u float64) {
+		t.pdf.Line(x+0.1*u, y-0.75*u, x+0.5*u, y+0.2*u)
+	}},
+	'∼': {0.8, 0.12, 0.12, true, func(t *typesetter, x, y, a, u float64) {
+		t.pdf.CurveBezierCubic(x+0.1*u, a+0.06*u, x+0.3*u, a-0.25*u, x+0.5*u, a+0.25*u, x+0.7*u, a-0.06*u, "D")
+	}},
+	'⋯': {1, 0.05, 0.05, true, func(t *typesetter, x, y, a, u float64) {
+		for _, dx := range []float64{0.2, 0.5, 0.8} {
+			t.pdf.Circle(x+dx*u, a, 0.05*u, "F")
+		}
+	}},
+	'⋮': {0.3, 0.7, 0, false, func(t *typesetter, x, y, a, u float64) {
+		for _, dy := range []float64{0.1, 0.35, 0.6} {
+			t.pdf.Circle(x+0.15*u, y-dy*u, 0.05*u, "F")
+		}
+	}},
+	'⋱': {1, 0.7, 0, false, func(t *typesetter, x, y, a, u float64) {
+		for i, dx := range []float64{0.2, 0.5, 0.8} {
+			t.pdf.Circle(x+dx*u, y-(0.6-0.25*float64(i))*u, 0.05*u, "F")
+		}
+	}},
+	'⟨': {0.4, 0.75, 0.22, false, func(t *typesetter, x, y, a, u float64) { t.drawDelimiter("⟨", x, y-0.75*u, 0.4*u, 0.97*u, u*0.06) }},
+	'⟩': {0.4, 0.75, 0.22, false, func(t *typesetter, x, y, a, u float64) { t.drawDelimiter("⟩", x, y-0.75*u, 0.4*u, 0.97*u, u*0.06) }},
+	'⌈': {0.4, 0.75, 0.22, false, func(t *typesetter, x, y, a, u float64) { t.drawDelimiter("⌈", x, y-0.75*u, 0.4*u, 0.97*u, u*0.06) }},
+	'⌉': {0.4, 0.75, 0.22, false, func(t *typesetter, x, y, a, u float64) { t.drawDelimiter("⌉", x, y-0.75*u, 0.4*u, 0.97*u, u*0.06) }},
+	'⌊': {0.4, 0.75, 0.22, false, func(t *typesetter, x, y, a, u float64) { t.drawDelimiter("⌊", x, y-0.75*u, 0.4*u, 0.97*u, u*0.06) }},
+	'⌋': {0.4, 0.75, 0.22, false, func(t *typesetter, x, y, a, u float64) { t.drawDelimiter("⌋", x, y-0.75*u, 0.4*u, 0.97*u, u*0.06) }},
+	'‖': {0.4, 0.75, 0.22, false, func(t *typesetter, x, y, a, u float64) { t.drawDelimiter("‖", x, y-0.75*u, 0.4*u, 0.97*u, u*0.06) }},
+}
+
+// standIns are characters close enough to symbols neither font has, nor are drawn
+var standIns = map[rune]string{
+	'ϕ': "φ", 'ϵ': "ε", 'ϑ': "θ", 'ϱ': "ρ", 'ϖ': "π", 'ℏ': "ħ", 'ℓ': "l", 'ℜ': "Re", 'ℑ': "Im", 'ℵ': "N",
+	'ℂ': "C", 'ℍ': "H", 'ℕ': "N", 'ℙ': "P", 'ℚ': "Q", 'ℝ': "R", 'ℤ': "Z",
+	'∗': "*", '⋆': "*", '≪': "<<", '≫': ">>", '≃': "≈", '≅': "≈", '≔': ":=", '∝': "α",
+	'⋃': "∪", '⋂': "∩", '⨁': "⊕", '⨂': "⊗", '⋁': "∨", '⋀': "∧", '∐': "∏", '∬': "∫∫", '∭': "∫∫∫", '∮': "∫",
+	'△': "∆", '✓': "√", '†': "+",
+}
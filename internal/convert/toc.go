@@ -0,0 +1,168 @@
+package convert
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/jung-kurt/gofpdf"
+	"github.com/yuin/goldmark/ast"
+)
+
+// tocEntry is a heading listed in the table of contents and the pdf outline
+type tocEntry struct {
+	title string
+	slug  string // anchor for #links, unique within the note
+	depth int    // outline level, 0 at the top and never skipping one
+	link  int    // internal link to the heading, 0 until links are added
+	page  int    // page the heading landed on
+}
+
+// tableOfContents is the headings of a document, for the contents page and outline
+type tableOfContents struct {
+	entries  []*tocEntry // in document order
+	headings map[*ast.Heading]*tocEntry
+	page     bool // whether to write a contents page
+	embedded bool // an embedded note's, for its own #links and kept out of the outline
+}
+
+func collectHeadings(doc ast.Node, source []byte) *tableOfContents {
+	toc := &tableOfContents{headings: map[*ast.Heading]*tocEntry{}}
+	var open []int // levels of the headings enclosing the current one
+	slugs := map[string]int{}
+	ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		heading, ok := node.(*ast.Heading)
+		if !ok || !entering {
+			return ast.WalkContinue, nil
+		}
+		for len(open) > 0 && open[len(open)-1] >= heading.Level {
+			open = open[:len(open)-1]
+		}
+		entry := &tocEntry{title: plainText(heading, source), depth: len(open)}
+
+		// repeated headings get -1, -2... like github anchors
+		entry.slug = slug(entry.title)
+		if n := slugs[entry.slug]; n > 0 {
+			slugs[entry.slug] = n + 1
+			entry.slug = fmt.Sprintf("%s-%d", entry.slug, n)
+		} else {
+			slugs[entry.slug] = 1
+		}
+
+		toc.entries = append(toc.entries, entry)
+		toc.headings[heading] = entry
+		open = append(open, heading.Level)
+		return ast.WalkSkipChildren, nil
+	})
+	return toc
+}
+
+// addLinks reserves an internal link for every heading, so links can point ahead of it
+func (toc *tableOfContents) addLinks(pdf *gofpdf.Fpdf) {
+	for _, entry := range toc.entries {
+		entry.link = pdf.AddLink()
+	}
+}
+
+// addSectionLinks reserves links for the headings among nodes only, the part of
+// the note an embed shows, so #links to the rest stay plain text
+func (toc *tableOfContents) addSectionLinks(pdf *gofpdf.Fpdf, nodes []ast.Node) {
+	for _, node := range nodes {
+		ast.Walk(node, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+			if heading, ok := node.(*ast.Heading); ok && entering {
+				if entry := toc.headings[heading]; entry != nil {
+					entry.link = pdf.AddLink()
+				}
+			}
+			return ast.WalkContinue, nil
+		})
+	}
+}
+
+// anchor returns the link to the heading a #fragment names, 0 when there's none
+func (toc *tableOfContents) anchor(fragment string) int {
+	if unescaped, err := url.PathUnescape(fragment); err == nil {
+		fragment = unescaped
+	}
+	want := slug(fragment)
+	for _, entry := range toc.entries {
+		if entry.slug == want {
+			return entry.link
+		}
+	}
+	return 0
+}
+
+// slug lowercases a heading and keeps letters and digits, spaces becoming dashes
+func slug(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(s)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+		case r == ' ' || r == '-' || r == '_':
+			b.WriteRune('-')
+		}
+	}
+	return b.String()
+}
+
+// mark records where a heading landed, keeping it on the same page as the lines after it
+func (toc *tableOfContents) mark(pdf *gofpdf.Fpdf, heading *ast.Heading) {
+	entry := toc.headings[heading]
+	if entry == nil {
+		return
+	}
+
+	_, pageH := pdf.GetPageSize()
+	_, bottom := pdf.GetAutoPageBreak()
+	if pdf.GetY()+15 > pageH-bottom {
+		pdf.AddPage()
+	}
+
+	entry.page = pdf.PageNo()
+	if entry.link != 0 {
+		pdf.SetLink(entry.link, -1, -1)
+	}
+	if !toc.embedded {
+		pdf.Bookmark(entry.title, entry.depth, -1)
+	}
+}
+
+// write fills the first pages with a linked contents list, one line per heading
+// page numbers are the ones recorded by a previous render
+func (toc *tableOfContents) write(pdf *gofpdf.Fpdf, options PDFOptions) {
+	pdf.SetFont(mainFamily, "B", options.FontSize+4)
+	pdf.CellFormat(0, 10, "Contents", "", 1, "L", false, 0, "")
+	pdf.Ln(2)
+
+	pdf.SetFont(mainFamily, "", options.FontSize)
+	lMargin, _, rMargin, _ := pdf.GetMargins()
+	pageW, _ := pdf.GetPageSize()
+	const numberW = 12.0
+
+	for _, entry := range toc.entries {
+		indent := float64(entry.depth) * 5
+		titleW := pageW - lMargin - rMargin - indent - numberW
+
+		pdf.SetX(lMargin + indent)
+		pdf.CellFormat(titleW, 6, fitText(pdf, entry.title, titleW), "", 0, "L", false, entry.link, "")
+		pdf.CellFormat(numberW, 6, strconv.Itoa(entry.page), "", 1, "R", false, entry.link, "")
+	}
+
+	pdf.AddPage()
+}
+
+// fitText shortens s with an ellipsis until it fits in width
+func fitText(pdf *gofpdf.Fpdf, s string, width float64) string {
+	if pdf.GetStringWidth(s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 && pdf.GetStringWidth(string(runes)+"...") > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "..."
+}
@@ -0,0 +1,57 @@
+package convert
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCollectHeadings(t *testing.T) {
+	source := []byte("## Skipped top\n\n#### Deep\n\n# Title\n\n### Section\n\n## Part\n")
+	toc := collectHeadings(parseMarkdown(source), source)
+	want := []struct {
+		title string
+		depth int
+	}{{"Skipped top", 0}, {"Deep", 1}, {"Title", 0}, {"Section", 1}, {"Part", 1}}
+	if len(toc.entries) != len(want) {
+		t.Fatalf("got %d entries", len(toc.entries))
+	}
+	for i, entry := range toc.entries {
+		if entry.title != want[i].title || entry.depth != want[i].depth {
+			t.Errorf("entry %d = %q at depth %d, want %+v", i, entry.title, entry.depth, want[i])
+		}
+	}
+}
+
+// outlineTitle is a heading's entry in the pdf outline, utf-16 with a byte order mark
+func outlineTitle(s string) string {
+	return "/Title (\xfe\xff" + pdfText(s) + ")"
+}
+
+func TestTableOfContents(t *testing.T) {
+	// the filler pushes the last heading onto the page after the first section
+	source := "# One\n\ntext\n\n## Two\n\n" + strings.Repeat("filler\n\n", 60) + "# Three\n"
+	pdf, data := renderPDF(t, DefaultPDFOptions(), source)
+
+	if pdf.PageNo() != 3 {
+		t.Errorf("got %d pages, want contents and two pages of text", pdf.PageNo())
+	}
+	for _, want := range []string{tj("Contents"), outlineTitle("One"), outlineTitle("Two"), outlineTitle("Three"), tj("2"), tj("3")} {
+		if !strings.Contains(data, want) {
+			t.Errorf("pdf is missing %s", want)
+		}
+	}
+}
+
+func TestTableOfContentsDisabled(t *testing.T) {
+	options := DefaultPDFOptions()
+	options.TOC = false
+	pdf, data := renderPDF(t, options, "# One\n\n## Two\n")
+
+	if pdf.PageNo() != 1 || strings.Contains(data, tj("Contents")) {
+		t.Error("contents page written with TOC off")
+	}
+	// the outline is still there to navigate by
+	if !strings.Contains(data, outlineTitle("Two")) {
+		t.Error("outline missing")
+	}
+}
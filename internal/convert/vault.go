@@ -0,0 +1,91 @@
+package convert
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// vault finds the files notes link to and embed, the way obsidian resolves [[names]]:
+// next to the note, from the vault root, then by file name anywhere in the vault
+type vault struct {
+	root        string
+	files       map[string][]string // lowercased file name -> paths, listed on first use
+	attachments *string             // the attachment folder setting, read on first use
+}
+
+func (v *vault) list() {
+	v.files = map[string][]string{}
+	if v.root == "" {
+		return
+	}
+	filepath.WalkDir(v.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		// .obsidian, .trash and the like
+		if d.IsDir() && path != v.root && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if !d.IsDir() {
+			name := strings.ToLower(d.Name())
+			v.files[name] = append(v.files[name], path)
+		}
+		return nil
+	})
+
+	// the shortest path wins, as in obsidian
+	for _, paths := range v.files {
+		sort.Slice(paths, func(i, j int) bool {
+			if len(paths[i]) != len(paths[j]) {
+				return len(paths[i]) < len(paths[j])
+			}
+			return paths[i] < paths[j]
+		})
+	}
+}
+
+// resolve returns the file target names, from is the note linking to it
+// targets without an extension are notes
+func (v *vault) resolve(target, from string) (string, bool) {
+	if target == "" {
+		return "", false
+	}
+	target = filepath.FromSlash(target)
+	names := []string{target}
+	if filepath.Ext(target) == "" {
+		names = []string{target + ".md"}
+	} else if !strings.EqualFold(filepath.Ext(target), ".md") {
+		// "Note v1.2" is still a note
+		names = append(names, target+".md")
+	}
+
+	for _, name := range names {
+		candidates := []string{filepath.Join(filepath.Dir(from), name)}
+		if v.root != "" {
+			candidates = append(candidates, filepath.Join(v.root, name))
+		}
+		for _, path := range candidates {
+			if st, err := os.Stat(path); err == nil && !st.IsDir() {
+				return path, true
+			}
+		}
+	}
+
+	if v.files == nil {
+		v.list()
+	}
+	for _, name := range names {
+		if paths := v.files[strings.ToLower(filepath.Base(name))]; len(paths) > 0 {
+			// with a folder in the target, only paths ending in it match
+			for _, path := range paths {
+				if strings.HasSuffix(strings.ToLower(path), strings.ToLower(string(filepath.Separator)+name)) {
+					return path, true
+				}
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,106 @@
+package convert
+
+import (
+	"bytes"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// LinkTarget is what goes between [[ and ]]: Target#Fragment|Label
+type LinkTarget struct {
+	Target   string // note or file name, empty for a heading in the same note
+	Fragment string // heading after #
+	Label    string // text after |, empty to show the target
+}
+
+// Display returns what the link shows
+func (l LinkTarget) Display() string {
+	switch {
+	case l.Label != "":
+		return l.Label
+	case l.Target == "":
+		return l.Fragment
+	case l.Fragment != "":
+		return l.Target + " > " + l.Fragment
+	}
+	return l.Target
+}
+
+func (l LinkTarget) dump() map[string]string {
+	return map[string]string{"Target": l.Target, "Fragment": l.Fragment, "Label": l.Label}
+}
+
+// WikiLink is an obsidian [[Target#Heading|Label]] link
+type WikiLink struct {
+	ast.BaseInline
+	LinkTarget
+}
+
+var KindWikiLink = ast.NewNodeKind("WikiLink")
+
+func (n *WikiLink) Kind() ast.NodeKind {
+	return KindWikiLink
+}
+
+func (n *WikiLink) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, n.dump(), nil)
+}
+
+// Embed is an obsidian ![[Target#Heading|Label]] embed of a note or file
+type Embed struct {
+	ast.BaseInline
+	LinkTarget
+}
+
+var KindEmbed = ast.NewNodeKind("Embed")
+
+func (n *Embed) Kind() ast.NodeKind {
+	return KindEmbed
+}
+
+func (n *Embed) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, n.dump(), nil)
+}
+
+type wikiLinkParser struct{}
+
+func (p *wikiLinkParser) Trigger() []byte {
+	return []byte{'[', '!'}
+}
+
+func (p *wikiLinkParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+	embed := bytes.HasPrefix(line, []byte("!"))
+	if embed {
+		line = line[1:]
+	}
+	if !bytes.HasPrefix(line, []byte("[[")) {
+		return nil
+	}
+	end := bytes.Index(line, []byte("]]"))
+	if end < 0 {
+		return nil
+	}
+	inner := line[2:end]
+	if len(bytes.TrimSpace(inner)) == 0 || bytes.ContainsAny(inner, "[\n") {
+		return nil
+	}
+
+	link := LinkTarget{}
+	if target, label, ok := bytes.Cut(inner, []byte("|")); ok {
+		inner = target
+		link.Label = string(bytes.TrimSpace(label))
+	}
+	target, fragment, _ := bytes.Cut(inner, []byte("#"))
+	link.Target = string(bytes.TrimSpace(target))
+	link.Fragment = string(bytes.TrimSpace(fragment))
+
+	if embed {
+		block.Advance(end + 3)
+		return &Embed{LinkTarget: link}
+	}
+	block.Advance(end + 2)
+	return &WikiLink{LinkTarget: link}
+}
@@ -0,0 +1,46 @@
+package convert
+
+import (
+	"testing"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+func TestWikiLinkParser(t *testing.T) {
+	tests := []struct {
+		source string
+		embed  bool
+		want   *LinkTarget
+	}{
+		{"[[Note]]", false, &LinkTarget{Target: "Note"}},
+		{"[[Note#Heading|shown]]", false, &LinkTarget{Target: "Note", Fragment: "Heading", Label: "shown"}},
+		{"[[#Heading]]", false, &LinkTarget{Fragment: "Heading"}},
+		{"![[Embedded Note]]", true, &LinkTarget{Target: "Embedded Note"}},
+		{"![[diagram.png|300]]", true, &LinkTarget{Target: "diagram.png", Label: "300"}},
+		{"[[]]", false, nil},
+		{"[[unclosed", false, nil},
+		{"[plain](link)", false, nil},
+		{"![image](pic.png)", false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			var got *LinkTarget
+			embed := false
+			ast.Walk(parseMarkdown([]byte(tt.source)), func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+				switch n := node.(type) {
+				case *WikiLink:
+					got = &n.LinkTarget
+				case *Embed:
+					got, embed = &n.LinkTarget, true
+				}
+				return ast.WalkContinue, nil
+			})
+			if (got == nil) != (tt.want == nil) {
+				t.Fatalf("parsed %+v, want %+v", got, tt.want)
+			}
+			if got != nil && (*got != *tt.want || embed != tt.embed) {
+				t.Errorf("parsed %+v (embed %v), want %+v (embed %v)", got, embed, tt.want, tt.embed)
+			}
+		})
+	}
+}
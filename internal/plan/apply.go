@@ -0,0 +1,351 @@
+package plan
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"remarkable-sync/internal/convert"
+	"remarkable-sync/internal/remarkable"
+	"remarkable-sync/internal/state"
+)
+
+// Check compares the tablet with what each operation expected when planned
+func (p *Plan) Check(client *remarkable.Client) error {
+	// what the plan was built from may be out of date by now
+	client.Refresh()
+
+	var drifted []string
+	for _, op := range p.Operations {
+		if op.Expect == nil {
+			continue
+		}
+
+		metadata, err := client.GetMetadata(op.UUID)
+		if err != nil {
+			return err
+		}
+
+		if op.Expect.Absent {
+			if metadata != nil {
+				drifted = append(drifted, fmt.Sprintf("%s: uuid %s already exists", op.Name, op.UUID))
+				continue
+			}
+			taken, err := nameTaken(client, op)
+			if err != nil {
+				return err
+			}
+			if taken {
+				drifted = append(drifted, fmt.Sprintf("%s: now exists on reMarkable", op.Name))
+			}
+			continue
+		}
+
+		if metadata == nil {
+			drifted = append(drifted, fmt.Sprintf("%s (%s): no longer exists", op.Name, op.UUID))
+			continue
+		}
+		if metadata.Version != op.Expect.Version || metadata.LastModified != op.Expect.LastModified {
+			drifted = append(drifted, fmt.Sprintf("%s (%s): changed since planned (version %d, now %d)",
+				op.Name, op.UUID, op.Expect.Version, metadata.Version))
+		}
+	}
+
+	if len(drifted) > 0 {
+		return fmt.Errorf("reMarkable has changed since the plan was made:\n  %s", strings.Join(drifted, "\n  "))
+	}
+	return nil
+}
+
+func nameTaken(client *remarkable.Client, op *Operation) (bool, error) {
+	if op.Kind == CreateFolder {
+		id, err := client.FindChildFolder(op.Parent, op.Name)
+		return id != "", err
+	}
+	files, err := client.FindInFolder(op.Parent, op.Name)
+	return len(files) > 0, err
+}
+
+// Apply checks the plan against the tablet and runs its operations in order
+// xochitl is restarted even when an operation fails after it was stopped
+func (p *Plan) Apply(client *remarkable.Client, logf func(string, ...interface{})) error {
+	if err := p.Check(client); err != nil {
+		return err
+	}
+
+	var store *state.Store
+	if p.State != "" {
+		var err error
+		if store, err = state.Open(p.State); err != nil {
+			return err
+		}
+	}
+
+	r := &runner{plan: p, client: client, store: store}
+	defer r.close()
+
+	stopped := false
+	for _, op := range p.Operations {
+		logf("%s", op)
+		if err := r.apply(op); err != nil {
+			if stopped && op.Kind != RestartXochitl {
+				logf("Restarting xochitl after failure...")
+				client.RestartXochitl()
+			}
+			return fmt.Errorf("%s %s: %w", op.Kind, op.Name, err)
+		}
+		switch op.Kind {
+		case StopXochitl:
+			stopped = true
+		case RestartXochitl:
+			stopped = false
+		}
+	}
+
+	return nil
+}
+
+type runner struct {
+	plan      *Plan
+	client    *remarkable.Client
+	store     *state.Store
+	converter *convert.Converter
+}
+
+func (r *runner) close() {
+	if r.converter != nil {
+		r.converter.Close()
+	}
+}
+
+func (r *runner) apply(op *Operation) error {
+	switch op.Kind {
+	case StopXochitl:
+		if err := r.client.StopXochitl(); err != nil {
+			return fmt.Errorf("failed to stop xochitl: %w", err)
+		}
+
+	case RestartXochitl:
+		if err := r.client.RestartXochitl(); err != nil {
+			return fmt.Errorf("failed to restart xochitl: %w", err)
+		}
+
+	case CreateFolder:
+		return r.client.CreateFolderWithID(op.UUID, op.Name, op.Parent)
+
+	case CreateDocument:
+		if err := r.client.UploadFileWithID(op.UUID, op.Source, op.Name, op.Parent); err != nil {
+			return err
+		}
+		return r.recordPush(op, &state.Entry{})
+
+	case OverwriteDocument:
+		if err := r.client.ReplaceFile(op.UUID, op.Source); err != nil {
+			return err
+		}
+		entry, ok := r.entry(op.Note)
+		if !ok {
+			entry = &state.Entry{}
+		}
+		return r.recordPush(op, entry)
+
+	case DeleteDocument:
+		return r.client.RemoveFile(op.UUID)
+
+	case MoveDocument:
+		if err := r.client.MoveFile(op.UUID, op.Parent); err != nil {
+			return err
+		}
+		from := op.Note
+		if op.Moved != "" {
+			from = op.Moved
+		}
+		entry, ok := r.entry(from)
+		if !ok {
+			return nil
+		}
+		// a note that moved in the vault is tracked under its new path
+		if op.Moved != "" {
+			r.store.Delete(op.Moved)
+			entry.Path = op.Note
+		}
+		entry.Parent = op.Parent
+		return r.save(entry)
+
+	case PullDocument:
+		pdfHash, err := r.pull(op.UUID, op.Target)
+		if err != nil {
+			return err
+		}
+		if r.store == nil || op.Note == "" {
+			return nil
+		}
+		hash, err := state.HashFile(op.Target)
+		if err != nil {
+			return err
+		}
+		entry, ok := r.entry(op.Note)
+		if !ok {
+			entry = &state.Entry{Path: op.Note, UUID: op.UUID, Parent: op.Parent}
+		}
+		entry.ContentHash = hash
+		entry.PDFHash = pdfHash
+		entry.LastPulled = time.Now()
+		return r.save(entry)
+
+	case PullConflict:
+		pdfHash, err := r.pull(op.UUID, op.Target)
+		if err != nil {
+			return err
+		}
+		// the tablet side is now captured locally, so the next sync pushes the note
+		if entry, ok := r.entry(op.Note); ok {
+			entry.PDFHash = pdfHash
+			entry.LastPulled = time.Now()
+			return r.save(entry)
+		}
+
+	case RecordEntry:
+		if entry, ok := r.entry(op.Note); ok {
+			if op.Hash != "" {
+				entry.ContentHash = op.Hash
+			}
+			if op.Render != "" {
+				entry.RenderHash = op.Render
+			}
+			return r.save(entry)
+		}
+
+	case ForgetEntry:
+		if r.store != nil {
+			r.store.Delete(op.Note)
+			return r.store.Save()
+		}
+
+	case TrashNote:
+		// an edit since planning is a reason to keep the note
+		hash, err := state.HashFile(op.Note)
+		if err != nil {
+			return err
+		}
+		if hash != op.Hash {
+			return fmt.Errorf("%s changed since planned", op.Note)
+		}
+		target := freePath(op.Target)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("failed to create trash: %w", err)
+		}
+		if err := os.Rename(op.Note, target); err != nil {
+			return fmt.Errorf("failed to move to trash: %w", err)
+		}
+		if r.store != nil {
+			r.store.Delete(op.Note)
+			return r.store.Save()
+		}
+
+	default:
+		return fmt.Errorf("unknown operation %q", op.Kind)
+	}
+
+	return nil
+}
+
+// freePath returns path, or "name 1.md", "name 2.md" and so on when it's taken
+func freePath(path string) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for i := 1; ; i++ {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return path
+		}
+		path = fmt.Sprintf("%s %d%s", base, i, ext)
+	}
+}
+
+func (r *runner) entry(path string) (*state.Entry, bool) {
+	if r.store == nil || path == "" {
+		return nil, false
+	}
+	return r.store.Get(path)
+}
+
+// recordPush updates the state entry for an uploaded note
+func (r *runner) recordPush(op *Operation, entry *state.Entry) error {
+	if r.store == nil || op.Note == "" {
+		return nil
+	}
+	docHash, err := state.HashFile(op.Source)
+	if err != nil {
+		return fmt.Errorf("failed to hash %s: %w", op.Source, err)
+	}
+
+	entry.Path = op.Note
+	entry.UUID = op.UUID
+	if op.Kind == CreateDocument {
+		entry.Parent = op.Parent
+	}
+	entry.ContentHash = op.Hash
+	entry.RenderHash = op.Render
+	entry.PDFHash = docHash
+	entry.LastPushed = time.Now()
+	return r.save(entry)
+}
+
+// save records the tablet's current metadata as the entry's baseline and persists it
+func (r *runner) save(entry *state.Entry) error {
+	metadata, err := r.client.GetMetadata(entry.UUID)
+	if err != nil {
+		return err
+	}
+	if metadata != nil {
+		entry.RemoteVersion = metadata.Version
+		entry.RemoteModified = metadata.LastModified
+	}
+	r.store.Put(entry)
+	return r.store.Save()
+}
+
+// pull downloads a document and writes its text to mdPath, returning the pdf's hash
+func (r *runner) pull(id, mdPath string) (string, error) {
+	if r.converter == nil {
+		converter, err := convert.NewConverter()
+		if err != nil {
+			return "", fmt.Errorf("failed to create converter: %w", err)
+		}
+		converter.SetMarkdownOptions(r.plan.Markdown)
+		r.converter = converter
+	}
+
+	name := strings.TrimSuffix(filepath.Base(mdPath), filepath.Ext(mdPath))
+	pdfPath, err := r.client.DownloadFile(id, name)
+	if err != nil {
+		return "", err
+	}
+	tmpDir := filepath.Dir(pdfPath)
+	defer os.RemoveAll(tmpDir)
+
+	pdfHash, err := state.HashFile(pdfPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", pdfPath, err)
+	}
+
+	tmpMD, err := r.converter.PDFToMarkdown(pdfPath, tmpDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to convert: %w", err)
+	}
+	data, err := os.ReadFile(tmpMD)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(mdPath), 0755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", filepath.Dir(mdPath), err)
+	}
+	if err := os.WriteFile(mdPath, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", mdPath, err)
+	}
+
+	return pdfHash, nil
+}
@@ -0,0 +1,175 @@
+package plan
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"remarkable-sync/internal/remarkable"
+	"remarkable-sync/internal/state"
+)
+
+const (
+	folderID = "aaaaaaaa-0000-4000-8000-000000000001"
+	docID    = "bbbbbbbb-0000-4000-8000-000000000002"
+)
+
+func newTestPlan(t *testing.T) (*Plan, string) {
+	t.Helper()
+	dir := t.TempDir()
+	note := filepath.Join(dir, "note.md")
+	pdf := filepath.Join(dir, "note.pdf")
+	if err := os.WriteFile(note, []byte("# note"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(pdf, []byte("%PDF-1.4 note"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := state.HashFile(note)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := New("test", "/xochitl", filepath.Join(dir, "state.json"))
+	p.Add(&Operation{Kind: CreateFolder, UUID: folderID, Name: "Notes", Expect: &Expect{Absent: true}})
+	p.Add(&Operation{
+		Kind:   CreateDocument,
+		UUID:   docID,
+		Name:   "note",
+		Parent: folderID,
+		Source: pdf,
+		Note:   note,
+		Hash:   hash,
+		Expect: &Expect{Absent: true},
+	})
+	p.WrapService()
+	return p, note
+}
+
+func TestApply(t *testing.T) {
+	p, note := newTestPlan(t)
+	dev := remarkable.NewMemDevice()
+	client := remarkable.NewDeviceClient(dev)
+
+	if err := p.Apply(client, t.Logf); err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(dev.Services, []string{"stop", "restart"}) {
+		t.Errorf("Services = %v, want stop then restart", dev.Services)
+	}
+	metadata, err := client.GetMetadata(docID)
+	if err != nil || metadata == nil || metadata.Parent != folderID || metadata.VisibleName != "note" {
+		t.Fatalf("GetMetadata() = %+v, %v", metadata, err)
+	}
+
+	store, err := state.Open(p.State)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, ok := store.Get(note)
+	if !ok || entry.UUID != docID || entry.RemoteVersion != 1 || entry.PDFHash == "" {
+		t.Errorf("state entry = %+v", entry)
+	}
+}
+
+func TestApplyRefusesDrift(t *testing.T) {
+	p, _ := newTestPlan(t)
+	dev := remarkable.NewMemDevice()
+	client := remarkable.NewDeviceClient(dev)
+
+	// someone made a folder of that name after the plan was made
+	if err := client.CreateFolderWithID("cccccccc-0000-4000-8000-000000000003", "Notes", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	err := p.Apply(client, t.Logf)
+	if err == nil || !strings.Contains(err.Error(), "Notes: now exists") {
+		t.Fatalf("Apply() = %v, want drift error", err)
+	}
+	if len(dev.Services) != 0 {
+		t.Errorf("xochitl was touched: %v", dev.Services)
+	}
+	if metadata, _ := client.GetMetadata(docID); metadata != nil {
+		t.Error("document was created despite drift")
+	}
+}
+
+func TestApplyRestartsAfterFailure(t *testing.T) {
+	p, _ := newTestPlan(t)
+	p.Operations[2].Source = filepath.Join(t.TempDir(), "missing.pdf")
+	dev := remarkable.NewMemDevice()
+
+	if err := p.Apply(remarkable.NewDeviceClient(dev), t.Logf); err == nil {
+		t.Fatal("Apply() with a missing source succeeded")
+	}
+	if !slices.Equal(dev.Services, []string{"stop", "restart"}) {
+		t.Errorf("Services = %v, want xochitl restarted", dev.Services)
+	}
+}
+
+func TestApplyNestedFolders(t *testing.T) {
+	dev := remarkable.NewMemDevice()
+	client := remarkable.NewDeviceClient(dev)
+	top, err := client.EnsureFolder("Archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// "Research/Archive" doesn't collide with the top-level Archive
+	p := New("test", "/xochitl", "")
+	p.Add(&Operation{Kind: CreateFolder, UUID: folderID, Name: "Research", Expect: &Expect{Absent: true}})
+	p.Add(&Operation{Kind: CreateFolder, UUID: docID, Name: "Archive", Parent: folderID, Expect: &Expect{Absent: true}})
+	if err := p.Apply(client, t.Logf); err != nil {
+		t.Fatal(err)
+	}
+
+	if id, _ := client.FindFolderUUID("Research/Archive"); id != docID {
+		t.Errorf("FindFolderUUID(Research/Archive) = %q, want %q", id, docID)
+	}
+	if id, _ := client.FindFolderUUID("Archive"); id != top {
+		t.Errorf("FindFolderUUID(Archive) = %q, want %q", id, top)
+	}
+}
+
+func TestApplyMoveDocument(t *testing.T) {
+	p, note := newTestPlan(t)
+	dev := remarkable.NewMemDevice()
+	client := remarkable.NewDeviceClient(dev)
+	if err := p.Apply(client, t.Logf); err != nil {
+		t.Fatal(err)
+	}
+
+	// the note moved to another directory in the vault
+	moved := filepath.Join(filepath.Dir(note), "sub", "note.md")
+	metadata, _ := client.GetMetadata(docID)
+	move := New("test", "/xochitl", p.State)
+	move.Add(&Operation{
+		Kind:   MoveDocument,
+		UUID:   docID,
+		Name:   "note",
+		Parent: "",
+		Note:   moved,
+		Moved:  note,
+		Expect: &Expect{Version: metadata.Version, LastModified: metadata.LastModified},
+	})
+	if err := move.Apply(client, t.Logf); err != nil {
+		t.Fatal(err)
+	}
+
+	if metadata, _ := client.GetMetadata(docID); metadata == nil || metadata.Parent != "" {
+		t.Errorf("metadata after move = %+v", metadata)
+	}
+	store, err := state.Open(p.State)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.Get(note); ok {
+		t.Error("old path is still tracked")
+	}
+	if entry, ok := store.Get(moved); !ok || entry.UUID != docID || entry.Parent != "" || entry.RemoteVersion != 2 {
+		t.Errorf("entry for moved note = %+v", entry)
+	}
+}
@@ -0,0 +1,239 @@
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"remarkable-sync/internal/convert"
+)
+
+// Kind identifies what an operation does
+type Kind string
+
+const (
+	StopXochitl       Kind = "stop-xochitl"
+	CreateFolder      Kind = "create-folder"
+	CreateDocument    Kind = "create-document"
+	OverwriteDocument Kind = "overwrite-document"
+	DeleteDocument    Kind = "delete-document"
+	MoveDocument      Kind = "move-document" // into Parent
+	PullDocument      Kind = "pull-document" // download into the tracked note
+	PullConflict      Kind = "pull-conflict" // download next to the tracked note
+	RecordEntry       Kind = "record-entry"  // state only, refresh the baseline
+	ForgetEntry       Kind = "forget-entry"  // state only, drop the entry
+	TrashNote         Kind = "trash-note"    // move Note to Target in the vault's trash, dropping its entry
+	RestartXochitl    Kind = "restart-xochitl"
+)
+
+// Operation is one step of a plan
+type Operation struct {
+	Kind      Kind    `json:"kind"`
+	UUID      string  `json:"uuid,omitempty"`
+	Name      string  `json:"name,omitempty"`
+	Parent    string  `json:"parent,omitempty"`
+	Source    string  `json:"source,omitempty"`    // local file uploaded by create/overwrite
+	Generated bool    `json:"generated,omitempty"` // Source is a temp file that must be kept with a saved plan
+	Target    string  `json:"target,omitempty"`    // local file written by a pull
+	Note      string  `json:"note,omitempty"`      // local file tracked in the state store
+	Hash      string  `json:"hash,omitempty"`      // sha256 of Note when planned
+	Render    string  `json:"render,omitempty"`    // render hash of a generated Source, see convert.RenderHash
+	Moved     string  `json:"moved,omitempty"`     // previous path of a Note that moved in the vault
+	Folder    string  `json:"folder,omitempty"`    // tablet folder path of Parent, for display
+	Expect    *Expect `json:"expect,omitempty"`
+}
+
+// Expect is what the tablet looked like when the operation was planned
+type Expect struct {
+	Absent       bool   `json:"absent,omitempty"` // no live document with this name, or folder with this name in Parent
+	Version      int    `json:"version,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+}
+
+// Plan is an ordered list of operations built by one command
+type Plan struct {
+	Command    string                  `json:"command"`
+	Created    time.Time               `json:"created"`
+	Dir        string                  `json:"dir"`
+	State      string                  `json:"state,omitempty"`
+	Markdown   convert.MarkdownOptions `json:"markdown"`
+	Operations []*Operation            `json:"operations"`
+}
+
+func New(command, dir, statePath string) *Plan {
+	return &Plan{
+		Command:  command,
+		Created:  time.Now(),
+		Dir:      dir,
+		State:    statePath,
+		Markdown: convert.DefaultMarkdownOptions(),
+	}
+}
+
+func (p *Plan) Add(op *Operation) {
+	p.Operations = append(p.Operations, op)
+}
+
+// Mutates reports whether applying the plan changes anything on the tablet
+func (p *Plan) Mutates() bool {
+	for _, op := range p.Operations {
+		if op.mutates() {
+			return true
+		}
+	}
+	return false
+}
+
+// Empty reports whether the plan has nothing to do besides service control
+func (p *Plan) Empty() bool {
+	for _, op := range p.Operations {
+		if op.Kind != StopXochitl && op.Kind != RestartXochitl {
+			return false
+		}
+	}
+	return true
+}
+
+// Count returns how many operations of a kind the plan has
+func (p *Plan) Count(kind Kind) int {
+	n := 0
+	for _, op := range p.Operations {
+		if op.Kind == kind {
+			n++
+		}
+	}
+	return n
+}
+
+// WrapService brackets tablet changes with stopping and restarting xochitl
+func (p *Plan) WrapService() {
+	if !p.Mutates() {
+		return
+	}
+	p.Operations = append([]*Operation{{Kind: StopXochitl}}, p.Operations...)
+	p.Add(&Operation{Kind: RestartXochitl})
+}
+
+func (op *Operation) mutates() bool {
+	switch op.Kind {
+	case CreateFolder, CreateDocument, OverwriteDocument, DeleteDocument, MoveDocument:
+		return true
+	}
+	return false
+}
+
+// String describes the operation on one line
+func (op *Operation) String() string {
+	switch op.Kind {
+	case CreateFolder:
+		return fmt.Sprintf("%-18s %s", op.Kind, path.Join(op.Folder, op.Name))
+	case CreateDocument:
+		return fmt.Sprintf("%-18s %s <- %s", op.Kind, op.Name, displayPath(op))
+	case OverwriteDocument:
+		return fmt.Sprintf("%-18s %s (%s) <- %s", op.Kind, op.Name, op.UUID, displayPath(op))
+	case DeleteDocument:
+		return fmt.Sprintf("%-18s %s (%s)", op.Kind, op.Name, op.UUID)
+	case MoveDocument:
+		return fmt.Sprintf("%-18s %s (%s) -> /%s", op.Kind, op.Name, op.UUID, op.Folder)
+	case PullDocument, PullConflict:
+		return fmt.Sprintf("%-18s %s -> %s", op.Kind, op.Name, op.Target)
+	case RecordEntry, ForgetEntry:
+		return fmt.Sprintf("%-18s %s", op.Kind, op.Note)
+	case TrashNote:
+		return fmt.Sprintf("%-18s %s -> %s", op.Kind, op.Note, op.Target)
+	default:
+		return string(op.Kind)
+	}
+}
+
+func displayPath(op *Operation) string {
+	if op.Note != "" {
+		return op.Note
+	}
+	return op.Source
+}
+
+// Print writes a readable summary of the plan
+func (p *Plan) Print(w io.Writer) {
+	fmt.Fprintf(w, "Plan for %s (%d operations):\n", p.Command, len(p.Operations))
+	if len(p.Operations) == 0 {
+		fmt.Fprintln(w, "  (nothing to do)")
+		return
+	}
+	for _, op := range p.Operations {
+		fmt.Fprintf(w, "  %s\n", op)
+	}
+}
+
+// Save writes the plan as json; generated documents are copied next to it
+// into "<path>.files" so the plan can be applied after this run's temp dir is gone
+func (p *Plan) Save(path string) error {
+	filesDir := strings.TrimSuffix(path, filepath.Ext(path)) + ".files"
+
+	saved := *p
+	saved.Operations = make([]*Operation, len(p.Operations))
+	for i, op := range p.Operations {
+		cp := *op
+		if cp.Generated {
+			if err := os.MkdirAll(filesDir, 0755); err != nil {
+				return fmt.Errorf("failed to create %s: %w", filesDir, err)
+			}
+			dst, err := filepath.Abs(filepath.Join(filesDir, cp.UUID+filepath.Ext(cp.Source)))
+			if err != nil {
+				return err
+			}
+			if err := copyFile(cp.Source, dst); err != nil {
+				return fmt.Errorf("failed to save %s: %w", cp.Source, err)
+			}
+			cp.Source = dst
+			cp.Generated = false
+		}
+		saved.Operations[i] = &cp
+	}
+
+	data, err := json.MarshalIndent(&saved, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal plan: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write plan: %w", err)
+	}
+	return nil
+}
+
+// Load reads a plan written by Save
+func Load(path string) (*Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan: %w", err)
+	}
+
+	var p Plan
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse plan %s: %w", path, err)
+	}
+	return &p, nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
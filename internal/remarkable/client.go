@@ -1,170 +1,123 @@
 package remarkable
 
 import (
-	"fmt"
-	"os"
-	"os/exec"
-	"path/filepath"
-	"strings"
 	"time"
-
-	"golang.org/x/crypto/ssh"
 )
 
 const (
-	USB_HOST  = "10.11.99.1"
-	WIFI_HOST = "remarkable"
-	TIMEOUT   = 5 * time.Second
+	USB_HOST      = "10.11.99.1"
+	WIFI_HOST     = "remarkable"
+	TIMEOUT       = 5 * time.Second
+	PROBE_TIMEOUT = 2 * time.Second
 )
 
-// ssh client for remarkable
+// Client works with reMarkable documents on a Device
 type Client struct {
-	Host   string
-	Dir    string
-	client *ssh.Client
-	config *ssh.ClientConfig
+	Host       string // empty unless connected over ssh
+	IndexCache string // metadata is cached here between runs, empty disables caching
+	cacheKey   string // host and dir, so each tablet and tree has its own cached metadata
+	dev        Device
+	index      *Index
 }
 
-func getSSHAuthMethods() []ssh.AuthMethod {
-	var authMethods []ssh.AuthMethod
-
-	// try SSH keys from default locations
-	homeDir, err := os.UserHomeDir()
-	if err == nil {
-		keyFiles := []string{
-			filepath.Join(homeDir, ".ssh", "id_rsa"),
-			filepath.Join(homeDir, ".ssh", "id_ed25519"),
-			filepath.Join(homeDir, ".ssh", "id_ecdsa"),
-		}
+// connection options
+type Options struct {
+	// accepted host keys are recorded here, in addition to ~/.ssh/known_hosts being checked
+	KnownHostsFile string
+	// asked whether to trust a host seen for the first time, nil rejects unknown hosts
+	ConfirmHostKey func(host, via, fingerprint string) bool
+	// root password shown in Settings > Help, tried after keys
+	Password string
+	// asked for the passphrase of an encrypted key file, nil skips such keys
+	Passphrase func(file string) ([]byte, error)
+	// called as file transfers make progress
+	Progress ProgressFunc
+	// metadata cache file, see Client.IndexCache
+	IndexCache string
+}
 
-		for _, keyFile := range keyFiles {
-			if key, err := os.ReadFile(keyFile); err == nil {
-				if signer, err := ssh.ParsePrivateKey(key); err == nil {
-					authMethods = append(authMethods, ssh.PublicKeys(signer))
-				}
-			}
-		}
+// NewClient connects to the tablet over ssh
+func NewClient(host, dir string, opts Options) (*Client, error) {
+	dev, err := DialSSH(host, dir, opts)
+	if err != nil {
+		return nil, err
 	}
+	return &Client{Host: dev.Host, IndexCache: opts.IndexCache, cacheKey: dev.Host + ":" + dir, dev: dev}, nil
+}
 
-	// fallback to empty password
-	authMethods = append(authMethods, ssh.Password(""))
+// NewDeviceClient works on any device, such as a local directory or an in-memory fake
+func NewDeviceClient(dev Device) *Client {
+	return &Client{dev: dev}
+}
 
-	return authMethods
+func (c *Client) Close() error {
+	return c.dev.Close()
 }
 
-// test if we can connect to remarkable using system ssh
-func testConnection(host string) error {
-	cmd := exec.Command("ssh", "-o", "ConnectTimeout=2", fmt.Sprintf("root@%s", host), "exit")
-	return cmd.Run()
+func (c *Client) StopXochitl() error {
+	return c.dev.Service("stop")
 }
 
-func NewClient(host, dir string) (*Client, error) {
-	config := &ssh.ClientConfig{
-		User:            "root",
-		Auth:            getSSHAuthMethods(),
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         TIMEOUT,
-	}
+func (c *Client) RestartXochitl() error {
+	return c.dev.Service("restart")
+}
 
-	// determine which host to use
-	targetHost := USB_HOST
-	if testConnection(USB_HOST) != nil {
-		// USB failed, try wifi
-		targetHost = WIFI_HOST
-		if host != "" {
-			targetHost = host
-		}
-		if testConnection(targetHost) != nil {
-			return nil, fmt.Errorf("failed to connect via USB (%s) or WiFi (%s)", USB_HOST, targetHost)
+// Index returns every document and folder on the device, loading them on first use
+// the client keeps it current with its own changes
+func (c *Client) Index() (*Index, error) {
+	if c.index == nil {
+		index, err := loadIndex(c.dev, c.IndexCache, c.cacheKey)
+		if err != nil {
+			return nil, err
 		}
+		c.index = index
 	}
-
-	// create client with working host
-	client := &Client{
-		Host:   targetHost,
-		Dir:    dir,
-		config: config,
-	}
-
-	// try to establish SSH connection (optional - used only for RunCommand)
-	// if this fails, SCP operations will still work via system commands
-	client.connect()
-
-	return client, nil
+	return c.index, nil
 }
 
-func (c *Client) connect() error {
-	var err error
-	c.client, err = ssh.Dial("tcp", c.Host+":22", c.config)
-	return err
+// Refresh drops the index so the next query sees changes made by others
+func (c *Client) Refresh() {
+	c.index = nil
 }
 
-func (c *Client) Close() error {
-	if c.client != nil {
-		return c.client.Close()
+// the device operations below keep a loaded index in step
+
+func (c *Client) writeFile(name string, data []byte) error {
+	if err := c.dev.WriteFile(name, data); err != nil {
+		return err
+	}
+	if c.index != nil {
+		c.index.put(name, data)
 	}
 	return nil
 }
 
-func (c *Client) RunCommand(cmd string) (string, error) {
-	// if Go SSH client is available, use it
-	if c.client != nil {
-		session, err := c.client.NewSession()
-		if err == nil {
-			defer session.Close()
-			output, err := session.CombinedOutput(cmd)
-			if err != nil {
-				return "", fmt.Errorf("command failed: %w", err)
-			}
-			return filterSSHWarnings(string(output)), nil
-		}
+func (c *Client) upload(localPath, name string) error {
+	if err := c.dev.Upload(localPath, name); err != nil {
+		return err
 	}
-
-	// fallback to system ssh
-	sshCmd := exec.Command("ssh", fmt.Sprintf("root@%s", c.Host), cmd)
-	output, err := sshCmd.CombinedOutput()
-	if err != nil {
-		return "", fmt.Errorf("command failed: %w", err)
+	if c.index != nil {
+		c.index.names[name] = true
 	}
-
-	return filterSSHWarnings(string(output)), nil
+	return nil
 }
 
-// filterSSHWarnings removes SSH warning messages from output
-func filterSSHWarnings(output string) string {
-	lines := strings.Split(output, "\n")
-	var filtered []string
-	for _, line := range lines {
-		// Skip lines that are SSH warnings
-		if !strings.HasPrefix(line, "** WARNING:") &&
-			!strings.HasPrefix(line, "** This session") &&
-			!strings.HasPrefix(line, "** The server") {
-			filtered = append(filtered, line)
-		}
+func (c *Client) mkdir(name string) error {
+	if err := c.dev.Mkdir(name); err != nil {
+		return err
 	}
-	return strings.Join(filtered, "\n")
-}
-
-func (c *Client) TransferFile(localPath, remotePath string) error {
-	// use scp command directly - simpler and more reliable
-	remoteTarget := fmt.Sprintf("root@%s:%s", c.Host, remotePath)
-	cmd := exec.Command("scp", localPath, remoteTarget)
-
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("scp failed: %w", err)
+	if c.index != nil {
+		c.index.names[name] = true
 	}
-
 	return nil
 }
 
-// DownloadFile downloads a file from reMarkable to local path
-func (c *Client) DownloadFromRemote(remotePath, localPath string) error {
-	remoteSource := fmt.Sprintf("root@%s:%s", c.Host, remotePath)
-	cmd := exec.Command("scp", remoteSource, localPath)
-
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("scp download failed: %w", err)
+func (c *Client) remove(name string) error {
+	if err := c.dev.Remove(name); err != nil {
+		return err
+	}
+	if c.index != nil {
+		c.index.drop(name)
 	}
-
 	return nil
 }
@@ -0,0 +1,34 @@
+package remarkable
+
+// Device is where a xochitl document tree lives, every name is relative to its root
+type Device interface {
+	// Stat lists the files and directories at the top of the tree
+	Stat() ([]FileStat, error)
+	// ReadFile returns a file's contents, with an error wrapping fs.ErrNotExist when it's missing
+	ReadFile(name string) ([]byte, error)
+	// ReadFiles returns the contents of many files in one transfer, leaving out missing ones
+	ReadFiles(names []string) (map[string][]byte, error)
+	// WriteFile creates or replaces a small file such as .metadata or .content
+	WriteFile(name string, data []byte) error
+	// Upload copies a local document into the tree
+	Upload(localPath, name string) error
+	// Download copies a file from the tree to a local path
+	Download(name, localPath string) error
+	// Hash returns the hex sha256 of a file
+	Hash(name string) (string, error)
+	// Mkdir creates a directory and any missing parents
+	Mkdir(name string) error
+	// Remove deletes a file or a directory with everything in it, missing names are ignored
+	Remove(name string) error
+	// Service runs "systemctl <action> xochitl" on devices where xochitl runs at all
+	Service(action string) error
+	Close() error
+}
+
+// FileStat is one entry at the top of a device's tree
+type FileStat struct {
+	Name    string
+	Size    int64
+	ModTime int64 // unix seconds
+	Dir     bool
+}
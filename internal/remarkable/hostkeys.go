@@ -0,0 +1,145 @@
+package remarkable
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// HostKeyError is returned when the tablet's host key can't be verified
+type HostKeyError struct {
+	Host        string
+	Via         string // "USB" or "WiFi"
+	Fingerprint string
+	Known       []string // file:line of the recorded keys, empty when the host is unknown
+}
+
+func (e *HostKeyError) Error() string {
+	if len(e.Known) == 0 {
+		return fmt.Sprintf("host key %s of reMarkable via %s (%s) is not trusted", e.Fingerprint, e.Via, e.Host)
+	}
+	return fmt.Sprintf("host key of reMarkable via %s (%s) has CHANGED: it presented %s, which doesn't match %s. "+
+		"If the tablet was reset or updated, remove that entry; otherwise someone may be impersonating it",
+		e.Via, e.Host, e.Fingerprint, strings.Join(e.Known, ", "))
+}
+
+// DefaultKnownHostsFile is where host keys accepted on first use are recorded
+func DefaultKnownHostsFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "remarkable-sync", "known_hosts")
+}
+
+// knownHostsFiles returns the files host keys are checked against, the tool's own file last
+func (d *SSHDevice) knownHostsFiles() []string {
+	var files []string
+	if home, err := os.UserHomeDir(); err == nil {
+		files = append(files, filepath.Join(home, ".ssh", "known_hosts"))
+	}
+	return append(files, d.opts.KnownHostsFile)
+}
+
+// hostKeyCallback verifies keys against known_hosts, asking to trust unknown hosts on first use
+func (d *SSHDevice) hostKeyCallback(h hostConfig, via string) (ssh.HostKeyCallback, []string, error) {
+	var existing []string
+	for _, file := range d.knownHostsFiles() {
+		if _, err := os.Stat(file); err == nil {
+			existing = append(existing, file)
+		}
+	}
+
+	check := func(string, net.Addr, ssh.PublicKey) error {
+		return &knownhosts.KeyError{}
+	}
+	if len(existing) > 0 {
+		var err error
+		if check, err = knownhosts.New(existing...); err != nil {
+			return nil, nil, fmt.Errorf("failed to read known hosts: %w", err)
+		}
+	}
+
+	callback := func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := check(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) {
+			return err
+		}
+
+		hostErr := &HostKeyError{
+			Host:        h.HostName,
+			Via:         via,
+			Fingerprint: ssh.FingerprintSHA256(key),
+		}
+		if len(keyErr.Want) > 0 {
+			for _, want := range keyErr.Want {
+				hostErr.Known = append(hostErr.Known, fmt.Sprintf("%s:%d", want.Filename, want.Line))
+			}
+			return hostErr
+		}
+
+		// unknown host, trust on first use only when explicitly confirmed
+		if d.opts.ConfirmHostKey == nil || !d.opts.ConfirmHostKey(h.HostName, via, hostErr.Fingerprint) {
+			return hostErr
+		}
+		return d.trustHostKey(hostname, remote, key)
+	}
+
+	return callback, knownAlgorithms(check, h.address()), nil
+}
+
+// trustHostKey records a host key in the tool's known hosts file
+func (d *SSHDevice) trustHostKey(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	file := d.opts.KnownHostsFile
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(file), err)
+	}
+
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", file, err)
+	}
+	defer f.Close()
+
+	addresses := []string{knownhosts.Normalize(hostname)}
+	if remote != nil && remote.String() != hostname {
+		addresses = append(addresses, knownhosts.Normalize(remote.String()))
+	}
+	if _, err := fmt.Fprintln(f, knownhosts.Line(addresses, key)); err != nil {
+		return fmt.Errorf("failed to write %s: %w", file, err)
+	}
+	return nil
+}
+
+// knownAlgorithms returns the host key algorithms already on record for address
+// so the server is asked for a key type we can actually verify
+func knownAlgorithms(check ssh.HostKeyCallback, address string) []string {
+	probe, err := ssh.NewPublicKey(make(ed25519.PublicKey, ed25519.PublicKeySize))
+	if err != nil {
+		return nil
+	}
+
+	var keyErr *knownhosts.KeyError
+	if !errors.As(check(address, &net.TCPAddr{}, probe), &keyErr) {
+		return nil
+	}
+
+	var algorithms []string
+	for _, want := range keyErr.Want {
+		switch want.Key.Type() {
+		case ssh.KeyAlgoRSA:
+			algorithms = append(algorithms, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA)
+		default:
+			algorithms = append(algorithms, want.Key.Type())
+		}
+	}
+	return algorithms
+}
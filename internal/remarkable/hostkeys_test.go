@@ -0,0 +1,128 @@
+package remarkable
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func newEd25519Key(t *testing.T) ssh.PublicKey {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func newRSAKey(t *testing.T) ssh.PublicKey {
+	t.Helper()
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(&private.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestHostKeyCallback(t *testing.T) {
+	tablet, other, rsaKey := newEd25519Key(t), newEd25519Key(t), newRSAKey(t)
+	h := hostConfig{HostName: "10.11.99.1", Port: "22"}
+	remote := &net.TCPAddr{IP: net.ParseIP(h.HostName), Port: 22}
+
+	tests := []struct {
+		name       string
+		known      []ssh.PublicKey // already in the tool's known_hosts
+		presented  ssh.PublicKey
+		confirm    bool
+		changed    bool // a HostKeyError naming the recorded key
+		untrusted  bool // a HostKeyError for an unknown host
+		written    bool // the presented key was recorded
+		algorithms []string
+	}{
+		{name: "unknown accepted", presented: tablet, confirm: true, written: true},
+		{name: "unknown refused", presented: tablet, untrusted: true},
+		{name: "matching", known: []ssh.PublicKey{tablet}, presented: tablet, written: true, algorithms: []string{ssh.KeyAlgoED25519}},
+		{name: "changed", known: []ssh.PublicKey{other}, presented: tablet, confirm: true, changed: true, algorithms: []string{ssh.KeyAlgoED25519}},
+		{name: "rsa on record", known: []ssh.PublicKey{rsaKey}, presented: rsaKey, written: true,
+			algorithms: []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// only the tool's own file, not the user's ~/.ssh/known_hosts
+			t.Setenv("HOME", t.TempDir())
+			file := filepath.Join(t.TempDir(), "remarkable-sync", "known_hosts")
+			if len(tt.known) > 0 {
+				os.MkdirAll(filepath.Dir(file), 0700)
+				var lines []string
+				for _, key := range tt.known {
+					lines = append(lines, knownhosts.Line([]string{knownhosts.Normalize(h.address())}, key))
+				}
+				if err := os.WriteFile(file, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			asked := false
+			d := &SSHDevice{opts: Options{KnownHostsFile: file, ConfirmHostKey: func(host, via, fingerprint string) bool {
+				asked = true
+				if host != h.HostName || via != "USB" || fingerprint != ssh.FingerprintSHA256(tt.presented) {
+					t.Errorf("asked about %s via %s (%s)", host, via, fingerprint)
+				}
+				return tt.confirm
+			}}}
+			callback, algorithms, err := d.hostKeyCallback(h, "USB")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(algorithms, tt.algorithms) {
+				t.Errorf("algorithms %v, want %v", algorithms, tt.algorithms)
+			}
+
+			err = callback(h.address(), remote, tt.presented)
+			var hostErr *HostKeyError
+			switch {
+			case tt.changed:
+				if !errors.As(err, &hostErr) || len(hostErr.Known) != 1 || hostErr.Known[0] != file+":1" || !strings.Contains(err.Error(), "CHANGED") {
+					t.Errorf("changed key gave %v", err)
+				}
+				if asked {
+					t.Error("asked to trust a changed key")
+				}
+			case tt.untrusted:
+				if !errors.As(err, &hostErr) || len(hostErr.Known) != 0 || !asked {
+					t.Errorf("unknown key gave %v, asked %v", err, asked)
+				}
+			case err != nil:
+				t.Errorf("callback: %v", err)
+			}
+
+			// a key written on first use is trusted by the next connection without asking
+			callback, _, err = d.hostKeyCallback(h, "USB")
+			if err != nil {
+				t.Fatal(err)
+			}
+			asked = false
+			if err := callback(h.address(), remote, tt.presented); (err == nil) != tt.written || tt.written && asked {
+				t.Errorf("reconnecting gave %v, asked %v", err, asked)
+			}
+		})
+	}
+}
@@ -0,0 +1,291 @@
+package remarkable
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// document is one document or folder in the index
+type document struct {
+	id       string
+	raw      []byte // .metadata as stored, nil until it exists
+	metadata Metadata
+	err      error    // set when the metadata isn't valid json
+	content  *Content // nil when there's no readable .content
+}
+
+func (d *document) info() FileInfo {
+	return FileInfo{
+		UUID:         d.id,
+		Name:         d.metadata.VisibleName,
+		Parent:       d.metadata.Parent,
+		Folder:       d.metadata.Type == "CollectionType",
+		Version:      d.metadata.Version,
+		LastModified: d.metadata.LastModified,
+	}
+}
+
+// Index is the tree of documents and folders on a device, loaded in one go
+type Index struct {
+	names map[string]bool // everything at the top of the tree
+	docs  map[string]*document
+}
+
+func newIndex() *Index {
+	return &Index{
+		names: make(map[string]bool),
+		docs:  make(map[string]*document),
+	}
+}
+
+// indexed reports whether a file is pulled into the index
+func indexed(name string) bool {
+	return strings.HasSuffix(name, ".metadata") || strings.HasSuffix(name, ".content")
+}
+
+// put records a file written to the device
+func (x *Index) put(name string, data []byte) {
+	x.names[name] = true
+	if !indexed(name) {
+		return
+	}
+
+	id := strings.TrimSuffix(strings.TrimSuffix(name, ".metadata"), ".content")
+	doc, ok := x.docs[id]
+	if !ok {
+		doc = &document{id: id}
+		x.docs[id] = doc
+	}
+
+	if strings.HasSuffix(name, ".metadata") {
+		doc.raw = data
+		doc.metadata = Metadata{}
+		doc.err = json.Unmarshal(data, &doc.metadata)
+		return
+	}
+	var content Content
+	if json.Unmarshal(data, &content) == nil {
+		doc.content = &content
+	}
+}
+
+// drop records a file or directory removed from the device
+func (x *Index) drop(name string) {
+	delete(x.names, name)
+	if !indexed(name) {
+		return
+	}
+
+	id := strings.TrimSuffix(strings.TrimSuffix(name, ".metadata"), ".content")
+	doc, ok := x.docs[id]
+	if !ok {
+		return
+	}
+	if strings.HasSuffix(name, ".metadata") {
+		doc.raw = nil
+	} else {
+		doc.content = nil
+	}
+	if doc.raw == nil && doc.content == nil {
+		delete(x.docs, id)
+	}
+}
+
+// Has reports whether a file or directory exists at the top of the tree
+func (x *Index) Has(name string) bool {
+	return x.names[name]
+}
+
+// Names returns everything at the top of the tree, sorted
+func (x *Index) Names() []string {
+	names := make([]string, 0, len(x.names))
+	for name := range x.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// get returns the document with a metadata file for id, or nil
+func (x *Index) get(id string) *document {
+	if doc, ok := x.docs[id]; ok && doc.raw != nil {
+		return doc
+	}
+	return nil
+}
+
+// documents returns every document and folder with metadata, sorted by uuid
+func (x *Index) documents() []*document {
+	var docs []*document
+	for _, doc := range x.docs {
+		if doc.raw != nil {
+			docs = append(docs, doc)
+		}
+	}
+	sort.Slice(docs, func(i, j int) bool {
+		return docs[i].id < docs[j].id
+	})
+	return docs
+}
+
+// Lookup returns the document or folder with a uuid
+func (x *Index) Lookup(id string) (FileInfo, bool) {
+	doc := x.get(id)
+	if doc == nil || doc.err != nil {
+		return FileInfo{}, false
+	}
+	return doc.info(), true
+}
+
+// Children returns the documents and folders directly in a folder, "" being the top level
+func (x *Index) Children(parent string) []FileInfo {
+	var files []FileInfo
+	for _, doc := range x.documents() {
+		if doc.err == nil && doc.metadata.Parent == parent {
+			files = append(files, doc.info())
+		}
+	}
+	return files
+}
+
+// indexCacheFile is the on-disk copy of every device's indexed files, keyed by host and
+// dir so tablets and trees don't share entries
+type indexCacheFile struct {
+	Version int                    `json:"version"`
+	Devices map[string]*indexCache `json:"devices"`
+}
+
+// indexCache is one device's indexed files, reused while their size and mtime match
+type indexCache struct {
+	Files map[string]*cachedFile `json:"files"`
+}
+
+type cachedFile struct {
+	ModTime int64  `json:"modTime"`
+	Size    int64  `json:"size"`
+	Data    string `json:"data"`
+}
+
+const indexCacheVersion = 2
+
+// DefaultIndexCache returns where metadata is cached between runs
+func DefaultIndexCache() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "remarkable-sync", "index.json")
+}
+
+func readIndexCache(path string) *indexCacheFile {
+	cache := &indexCacheFile{Version: indexCacheVersion, Devices: make(map[string]*indexCache)}
+	if path == "" {
+		return cache
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cache
+	}
+
+	// an unreadable or outdated cache is just rebuilt
+	var loaded indexCacheFile
+	if json.Unmarshal(data, &loaded) != nil || loaded.Version != indexCacheVersion || loaded.Devices == nil {
+		return cache
+	}
+	return &loaded
+}
+
+// files returns the cached files of the device at key, none when it's never been cached
+func (cache *indexCacheFile) files(key string) map[string]*cachedFile {
+	if device := cache.Devices[key]; device != nil && device.Files != nil {
+		return device.Files
+	}
+	return map[string]*cachedFile{}
+}
+
+func (cache *indexCacheFile) save(path string) error {
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return fmt.Errorf("failed to marshal index cache: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create cache dir: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".index-*")
+	if err != nil {
+		return fmt.Errorf("failed to create index cache: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write index cache: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write index cache: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// loadIndex lists the device and fetches every metadata and content file not
+// already cached under key in one transfer; cacheFile may be empty to skip caching
+func loadIndex(dev Device, cacheFile, key string) (*Index, error) {
+	stats, err := dev.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+
+	cacheAll := readIndexCache(cacheFile)
+	cache := &indexCache{Files: cacheAll.files(key)}
+	fresh := &indexCache{Files: make(map[string]*cachedFile)}
+
+	x := newIndex()
+	var missing []string
+	for _, st := range stats {
+		x.names[st.Name] = true
+		if st.Dir || !indexed(st.Name) {
+			continue
+		}
+		if cached, ok := cache.Files[st.Name]; ok && cached.ModTime == st.ModTime && cached.Size == st.Size {
+			fresh.Files[st.Name] = cached
+			continue
+		}
+		missing = append(missing, st.Name)
+		fresh.Files[st.Name] = &cachedFile{ModTime: st.ModTime, Size: st.Size}
+	}
+
+	if len(missing) > 0 {
+		fetched, err := dev.ReadFiles(missing)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read metadata: %w", err)
+		}
+		for _, name := range missing {
+			data, ok := fetched[name]
+			if !ok {
+				// gone between listing and reading
+				delete(fresh.Files, name)
+				delete(x.names, name)
+				continue
+			}
+			fresh.Files[name].Data = string(data)
+		}
+	}
+
+	for name, file := range fresh.Files {
+		x.put(name, []byte(file.Data))
+	}
+
+	// only rewritten when something changed, failing to cache just costs the next run a transfer
+	if cacheFile != "" && (len(missing) > 0 || len(fresh.Files) != len(cache.Files)) {
+		cacheAll.Devices[key] = fresh
+		cacheAll.save(cacheFile)
+	}
+
+	return x, nil
+}
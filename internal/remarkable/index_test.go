@@ -0,0 +1,170 @@
+package remarkable
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestIndexReadsOnce(t *testing.T) {
+	dev, err := LoadMemDevice(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewDeviceClient(dev)
+
+	if _, err := c.ListFiles(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.FindByName("Paper"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.FindFolderUUID("Research"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CleanupExcept("Quick sheets", true); err != nil {
+		t.Fatal(err)
+	}
+	if dev.Reads != 1 {
+		t.Errorf("device read %d times, want once", dev.Reads)
+	}
+}
+
+func TestIndexTracksWrites(t *testing.T) {
+	dev, err := LoadMemDevice(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewDeviceClient(dev)
+
+	folder, err := c.EnsureFolder("Inbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := writeTemp(t, "note.pdf", "%PDF-1.4 note")
+	id, err := c.UploadFile(src, "Note", false, folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RemoveFile(paperID); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := names(mustList(t, c)), []string{"Note", "Old notes"}; !slices.Equal(got, want) {
+		t.Errorf("ListFiles() = %v, want %v", got, want)
+	}
+	index, _ := c.Index()
+	if children := index.Children(folder); len(children) != 1 || children[0].UUID != id {
+		t.Errorf("Children(Inbox) = %+v", children)
+	}
+	if dev.Reads != 1 {
+		t.Errorf("device read %d times, want once", dev.Reads)
+	}
+}
+
+func TestIndexChildren(t *testing.T) {
+	dev, err := LoadMemDevice(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := NewDeviceClient(dev).Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := names(index.Children(researchID)), []string{"Paper"}; !slices.Equal(got, want) {
+		t.Errorf("Children(Research) = %v, want %v", got, want)
+	}
+	if got, want := names(index.Children("")), []string{"Book", "Quick sheets", "Research"}; !slices.Equal(got, want) {
+		t.Errorf("Children(top) = %v, want %v", got, want)
+	}
+}
+
+func TestIndexCache(t *testing.T) {
+	dev, err := LoadMemDevice(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := filepath.Join(t.TempDir(), "index.json")
+
+	load := func() *Client {
+		c := NewDeviceClient(dev)
+		c.IndexCache = cache
+		if _, err := c.Index(); err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	load()
+	if dev.Reads != 1 {
+		t.Fatalf("first load read %d times, want once", dev.Reads)
+	}
+
+	// nothing changed, everything comes from the cache
+	c := load()
+	if dev.Reads != 1 {
+		t.Errorf("cached load read the device")
+	}
+	if got, want := names(mustList(t, c)), []string{"Old notes", "Paper"}; !slices.Equal(got, want) {
+		t.Errorf("ListFiles() from cache = %v, want %v", got, want)
+	}
+
+	// a changed file is fetched again, a removed one forgotten
+	if err := dev.WriteFile(paperID+".metadata", []byte(`{"visibleName":"Paper v2","type":"DocumentType","version":4}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := dev.Remove(oldID + ".metadata"); err != nil {
+		t.Fatal(err)
+	}
+	c = load()
+	if dev.Reads != 2 {
+		t.Errorf("device read %d times after a change, want 2", dev.Reads)
+	}
+	if got, want := names(mustList(t, c)), []string{"Paper v2"}; !slices.Equal(got, want) {
+		t.Errorf("ListFiles() after change = %v, want %v", got, want)
+	}
+}
+
+func TestIndexCachePerDevice(t *testing.T) {
+	cache := filepath.Join(t.TempDir(), "index.json")
+	load := func(dev *MemDevice, key string) *Client {
+		c := NewDeviceClient(dev)
+		c.IndexCache, c.cacheKey = cache, key
+		if _, err := c.Index(); err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	first, err := LoadMemDevice(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := NewMemDevice()
+	if err := second.WriteFile(paperID+".metadata", []byte(`{"visibleName":"Other paper","type":"DocumentType","version":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	second.WriteFile(paperID+".pdf", []byte("%PDF"))
+
+	load(first, "10.11.99.1:/home/root/.local/share/remarkable/xochitl")
+	c := load(second, "remarkable:/home/root/.local/share/remarkable/xochitl")
+	if got, want := names(mustList(t, c)), []string{"Other paper"}; !slices.Equal(got, want) {
+		t.Errorf("second tablet lists %v, want %v", got, want)
+	}
+
+	// each keeps its own entries, so switching back costs no transfer
+	load(first, "10.11.99.1:/home/root/.local/share/remarkable/xochitl")
+	if first.Reads != 1 {
+		t.Errorf("first tablet read %d times, want once", first.Reads)
+	}
+}
+
+func mustList(t *testing.T, c *Client) []FileInfo {
+	t.Helper()
+	files, err := c.ListFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
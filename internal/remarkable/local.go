@@ -0,0 +1,126 @@
+package remarkable
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// LocalDevice treats a local folder as a xochitl directory, such as a backup or a mounted tablet
+type LocalDevice struct {
+	Dir string
+}
+
+func NewLocalDevice(dir string) *LocalDevice {
+	return &LocalDevice{Dir: dir}
+}
+
+func (d *LocalDevice) path(name string) string {
+	return filepath.Join(d.Dir, filepath.FromSlash(name))
+}
+
+func (d *LocalDevice) Stat() ([]FileStat, error) {
+	entries, err := os.ReadDir(d.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var stats []FileStat
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		stats = append(stats, FileStat{
+			Name:    entry.Name(),
+			Size:    info.Size(),
+			ModTime: info.ModTime().Unix(),
+			Dir:     entry.IsDir(),
+		})
+	}
+	return stats, nil
+}
+
+func (d *LocalDevice) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(d.path(name))
+}
+
+func (d *LocalDevice) ReadFiles(names []string) (map[string][]byte, error) {
+	files := make(map[string][]byte, len(names))
+	for _, name := range names {
+		data, err := os.ReadFile(d.path(name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		files[name] = data
+	}
+	return files, nil
+}
+
+func (d *LocalDevice) WriteFile(name string, data []byte) error {
+	return os.WriteFile(d.path(name), data, 0644)
+}
+
+func (d *LocalDevice) Upload(localPath, name string) error {
+	return copyLocal(localPath, d.path(name))
+}
+
+func (d *LocalDevice) Download(name, localPath string) error {
+	return copyLocal(d.path(name), localPath)
+}
+
+func (d *LocalDevice) Hash(name string) (string, error) {
+	f, err := os.Open(d.path(name))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (d *LocalDevice) Mkdir(name string) error {
+	return os.MkdirAll(d.path(name), 0755)
+}
+
+func (d *LocalDevice) Remove(name string) error {
+	return os.RemoveAll(d.path(name))
+}
+
+// Service does nothing, no xochitl is reading a local folder
+func (d *LocalDevice) Service(action string) error {
+	return nil
+}
+
+func (d *LocalDevice) Close() error {
+	return nil
+}
+
+func copyLocal(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,176 @@
+package remarkable
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// MemDevice is an in-memory xochitl directory for tests
+type MemDevice struct {
+	Files    map[string][]byte
+	Dirs     map[string]bool
+	ModTimes map[string]int64 // a counter bumped on every write stands in for the clock
+	Services []string         // actions passed to Service, in order
+	Reads    int              // calls to ReadFile and ReadFiles
+	clock    int64
+}
+
+func NewMemDevice() *MemDevice {
+	return &MemDevice{
+		Files:    make(map[string][]byte),
+		Dirs:     make(map[string]bool),
+		ModTimes: make(map[string]int64),
+	}
+}
+
+// LoadMemDevice copies a local xochitl tree, such as a golden one under testdata, into memory
+func LoadMemDevice(dir string) (*MemDevice, error) {
+	m := NewMemDevice()
+	err := filepath.WalkDir(dir, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil || p == dir {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if entry.IsDir() {
+			m.Dirs[name] = true
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		return m.WriteFile(name, data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *MemDevice) Stat() ([]FileStat, error) {
+	seen := map[string]bool{}
+	var stats []FileStat
+	for name, data := range m.Files {
+		if !strings.Contains(name, "/") {
+			stats = append(stats, FileStat{Name: name, Size: int64(len(data)), ModTime: m.ModTimes[name]})
+			seen[name] = true
+		}
+	}
+	// directories are implied by the files in them too
+	var dirs []string
+	for name := range m.Dirs {
+		dirs = append(dirs, name)
+	}
+	for name := range m.Files {
+		dirs = append(dirs, name)
+	}
+	for _, name := range dirs {
+		top, _, _ := strings.Cut(name, "/")
+		if !seen[top] {
+			stats = append(stats, FileStat{Name: top, Dir: true})
+			seen[top] = true
+		}
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Name < stats[j].Name
+	})
+	return stats, nil
+}
+
+func (m *MemDevice) ReadFile(name string) ([]byte, error) {
+	m.Reads++
+	return m.file(name)
+}
+
+func (m *MemDevice) file(name string) ([]byte, error) {
+	data, ok := m.Files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrNotExist}
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (m *MemDevice) ReadFiles(names []string) (map[string][]byte, error) {
+	m.Reads++
+	files := make(map[string][]byte, len(names))
+	for _, name := range names {
+		if data, ok := m.Files[name]; ok {
+			files[name] = append([]byte(nil), data...)
+		}
+	}
+	return files, nil
+}
+
+func (m *MemDevice) WriteFile(name string, data []byte) error {
+	m.clock++
+	m.Files[name] = append([]byte(nil), data...)
+	m.ModTimes[name] = m.clock
+	return nil
+}
+
+func (m *MemDevice) Upload(localPath, name string) error {
+	data, err := os.ReadFile(localPath)
+	if err != nil {
+		return err
+	}
+	return m.WriteFile(name, data)
+}
+
+func (m *MemDevice) Download(name, localPath string) error {
+	data, err := m.file(name)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(localPath, data, 0644)
+}
+
+func (m *MemDevice) Hash(name string) (string, error) {
+	data, err := m.file(name)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (m *MemDevice) Mkdir(name string) error {
+	for p := name; p != "." && p != "/"; p = path.Dir(p) {
+		m.Dirs[p] = true
+	}
+	return nil
+}
+
+func (m *MemDevice) Remove(name string) error {
+	for file := range m.Files {
+		if file == name || strings.HasPrefix(file, name+"/") {
+			delete(m.Files, file)
+			delete(m.ModTimes, file)
+		}
+	}
+	for dir := range m.Dirs {
+		if dir == name || strings.HasPrefix(dir, name+"/") {
+			delete(m.Dirs, dir)
+		}
+	}
+	return nil
+}
+
+func (m *MemDevice) Service(action string) error {
+	m.Services = append(m.Services, action)
+	return nil
+}
+
+func (m *MemDevice) Close() error {
+	return nil
+}
@@ -0,0 +1,211 @@
+package remarkable
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ProgressFunc reports bytes transferred so far for one file
+type ProgressFunc func(name string, done, total int64)
+
+// TransferError is returned when copying a file to or from reMarkable fails
+type TransferError struct {
+	Op     string // "upload" or "download"
+	Remote string
+	Err    error
+}
+
+func (e *TransferError) Error() string {
+	return fmt.Sprintf("%s %s: %v", e.Op, e.Remote, e.Err)
+}
+
+func (e *TransferError) Unwrap() error {
+	return e.Err
+}
+
+// TransferFile uploads a local file using the scp protocol over the existing ssh connection
+func (d *SSHDevice) TransferFile(localPath, remotePath string) error {
+	if err := d.uploadFile(localPath, remotePath); err != nil {
+		return &TransferError{Op: "upload", Remote: remotePath, Err: err}
+	}
+	return nil
+}
+
+// DownloadFromRemote downloads a file from reMarkable to local path
+func (d *SSHDevice) DownloadFromRemote(remotePath, localPath string) error {
+	if err := d.download(remotePath, localPath); err != nil {
+		return &TransferError{Op: "download", Remote: remotePath, Err: err}
+	}
+	return nil
+}
+
+func (d *SSHDevice) uploadFile(localPath, remotePath string) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return d.upload(f, info.Size(), info.Mode().Perm(), remotePath, d.opts.Progress)
+}
+
+func (d *SSHDevice) upload(data io.Reader, size int64, mode os.FileMode, remotePath string, progress ProgressFunc) error {
+	session, err := d.client.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to open session: %w", err)
+	}
+	defer session.Close()
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	r := bufio.NewReader(stdout)
+
+	// sink mode: the remote scp writes what we send to remotePath
+	if err := session.Start("scp -t " + shellQuote(remotePath)); err != nil {
+		return fmt.Errorf("failed to start scp: %w", err)
+	}
+	if err := readAck(r); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdin, "C%04o %d %s\n", mode, size, path.Base(remotePath))
+	if err := readAck(r); err != nil {
+		return err
+	}
+
+	src := &progressReader{r: data, name: path.Base(remotePath), total: size, fn: progress}
+	if _, err := io.Copy(stdin, src); err != nil {
+		return err
+	}
+	if _, err := stdin.Write([]byte{0}); err != nil {
+		return err
+	}
+	if err := readAck(r); err != nil {
+		return err
+	}
+
+	stdin.Close()
+	return session.Wait()
+}
+
+func (d *SSHDevice) download(remotePath, localPath string) error {
+	session, err := d.client.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to open session: %w", err)
+	}
+	defer session.Close()
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	r := bufio.NewReader(stdout)
+
+	// source mode: the remote scp sends remotePath once we acknowledge
+	if err := session.Start("scp -f " + shellQuote(remotePath)); err != nil {
+		return fmt.Errorf("failed to start scp: %w", err)
+	}
+	if _, err := stdin.Write([]byte{0}); err != nil {
+		return err
+	}
+
+	header, err := r.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("failed to read scp header: %w", err)
+	}
+	if len(header) > 0 && (header[0] == 1 || header[0] == 2) {
+		return errors.New(strings.TrimSpace(header[1:]))
+	}
+
+	// header is "C<mode> <size> <name>"
+	fields := strings.SplitN(strings.TrimSpace(header), " ", 3)
+	if len(fields) != 3 || !strings.HasPrefix(fields[0], "C") {
+		return fmt.Errorf("unexpected scp header %q", header)
+	}
+	size, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("unexpected scp size %q", fields[1])
+	}
+
+	out, err := os.Create(localPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err := stdin.Write([]byte{0}); err != nil {
+		return err
+	}
+
+	src := &progressReader{r: r, name: path.Base(remotePath), total: size, fn: d.opts.Progress}
+	if _, err := io.CopyN(out, src, size); err != nil {
+		return err
+	}
+	if err := readAck(r); err != nil {
+		return err
+	}
+	if _, err := stdin.Write([]byte{0}); err != nil {
+		return err
+	}
+
+	if err := out.Close(); err != nil {
+		return err
+	}
+	stdin.Close()
+	return session.Wait()
+}
+
+// readAck reads one scp status byte, turning warnings and errors into go errors
+func readAck(r *bufio.Reader) error {
+	b, err := r.ReadByte()
+	if err != nil {
+		return fmt.Errorf("failed to read scp response: %w", err)
+	}
+	if b == 0 {
+		return nil
+	}
+
+	msg, _ := r.ReadString('\n')
+	return errors.New(strings.TrimSpace(msg))
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+type progressReader struct {
+	r     io.Reader
+	name  string
+	done  int64
+	total int64
+	fn    ProgressFunc
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.done += int64(n)
+	if p.fn != nil && n > 0 {
+		p.fn(p.name, p.done, p.total)
+	}
+	return n, err
+}
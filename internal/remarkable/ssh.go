@@ -0,0 +1,270 @@
+package remarkable
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SSHDevice is the xochitl directory of a tablet reached over ssh
+type SSHDevice struct {
+	Host      string
+	Dir       string
+	client    *ssh.Client
+	agentConn net.Conn
+	opts      Options
+}
+
+// DialSSH connects to the tablet, preferring USB and falling back to wifi
+func DialSSH(host, dir string, opts Options) (*SSHDevice, error) {
+	if opts.KnownHostsFile == "" {
+		opts.KnownHostsFile = DefaultKnownHostsFile()
+	}
+
+	d := &SSHDevice{
+		Dir:  dir,
+		opts: opts,
+	}
+
+	wifiHost := WIFI_HOST
+	if host != "" {
+		wifiHost = host
+	}
+	usbErr := d.connect(USB_HOST, "USB", PROBE_TIMEOUT)
+	if usbErr == nil {
+		return d, nil
+	}
+
+	// a tablet that fails verification must not be skipped silently
+	var hostErr *HostKeyError
+	if errors.As(usbErr, &hostErr) {
+		return nil, usbErr
+	}
+
+	wifiErr := d.connect(wifiHost, "WiFi", TIMEOUT)
+	if wifiErr == nil {
+		return d, nil
+	}
+	if errors.As(wifiErr, &hostErr) {
+		return nil, wifiErr
+	}
+
+	return nil, fmt.Errorf("failed to connect via USB (%s: %v) or WiFi (%s: %v)", USB_HOST, usbErr, wifiHost, wifiErr)
+}
+
+// connect opens the single ssh connection every operation in a run is multiplexed over
+func (d *SSHDevice) connect(host, via string, timeout time.Duration) error {
+	h := resolveHost(host)
+	callback, algorithms, err := d.hostKeyCallback(h, via)
+	if err != nil {
+		return err
+	}
+
+	config := &ssh.ClientConfig{
+		User:              h.User,
+		Auth:              d.authMethods(h),
+		Timeout:           timeout,
+		HostKeyCallback:   callback,
+		HostKeyAlgorithms: algorithms,
+	}
+
+	client, err := ssh.Dial("tcp", h.address(), config)
+	if err != nil {
+		return err
+	}
+
+	d.Host = host
+	d.client = client
+	return nil
+}
+
+func (d *SSHDevice) Close() error {
+	if d.agentConn != nil {
+		d.agentConn.Close()
+	}
+	if d.client != nil {
+		return d.client.Close()
+	}
+	return nil
+}
+
+func (d *SSHDevice) RunCommand(cmd string) (string, error) {
+	session, err := d.client.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("failed to open session: %w", err)
+	}
+	defer session.Close()
+
+	output, err := session.CombinedOutput(cmd)
+	if err != nil {
+		return string(output), fmt.Errorf("command failed: %w", err)
+	}
+	return string(output), nil
+}
+
+func (d *SSHDevice) remotePath(name string) string {
+	return path.Join(d.Dir, name)
+}
+
+func (d *SSHDevice) Stat() ([]FileStat, error) {
+	// one stat call for the whole directory, an empty one prints nothing
+	cmd := fmt.Sprintf(`cd %s && set -- * && [ -e "$1" ] || exit 0; stat -c '%%Y %%s %%f %%n' "$@"`, shellQuote(d.Dir))
+	output, err := d.RunCommand(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", d.Dir, err)
+	}
+
+	var stats []FileStat
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		// "<mtime> <size> <hex mode> <name>"
+		fields := strings.SplitN(line, " ", 4)
+		if len(fields) != 4 {
+			continue
+		}
+		modTime, _ := strconv.ParseInt(fields[0], 10, 64)
+		size, _ := strconv.ParseInt(fields[1], 10, 64)
+		mode, _ := strconv.ParseUint(fields[2], 16, 32)
+		stats = append(stats, FileStat{
+			Name:    fields[3],
+			Size:    size,
+			ModTime: modTime,
+			Dir:     mode&syscall.S_IFMT == syscall.S_IFDIR,
+		})
+	}
+	return stats, nil
+}
+
+// exit status the read command uses for a missing file
+const missingStatus = 44
+
+func (d *SSHDevice) ReadFile(name string) ([]byte, error) {
+	session, err := d.client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open session: %w", err)
+	}
+	defer session.Close()
+
+	p := shellQuote(d.remotePath(name))
+	output, err := session.Output(fmt.Sprintf("[ -f %s ] || exit %d; cat %s", p, missingStatus, p))
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitStatus() == missingStatus {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrNotExist}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return output, nil
+}
+
+// ReadFiles streams the files as one tar archive
+func (d *SSHDevice) ReadFiles(names []string) (map[string][]byte, error) {
+	files := make(map[string][]byte, len(names))
+	if len(names) == 0 {
+		return files, nil
+	}
+
+	session, err := d.client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open session: %w", err)
+	}
+	defer session.Close()
+
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = shellQuote(name)
+	}
+	// files removed since they were listed make tar complain, the rest still arrive
+	cmd := fmt.Sprintf("cd %s && tar -cf - %s 2>/dev/null", shellQuote(d.Dir), strings.Join(quoted, " "))
+	if err := session.Start(cmd); err != nil {
+		return nil, fmt.Errorf("failed to start tar: %w", err)
+	}
+
+	tr := tar.NewReader(stdout)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tar stream: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", header.Name, err)
+		}
+		files[path.Clean(header.Name)] = data
+	}
+
+	// tar exits non-zero for a missing file, which only means it's left out
+	var exitErr *ssh.ExitError
+	if err := session.Wait(); err != nil && !errors.As(err, &exitErr) {
+		return nil, err
+	}
+	return files, nil
+}
+
+func (d *SSHDevice) WriteFile(name string, data []byte) error {
+	remote := d.remotePath(name)
+	if err := d.upload(bytes.NewReader(data), int64(len(data)), 0644, remote, nil); err != nil {
+		return &TransferError{Op: "upload", Remote: remote, Err: err}
+	}
+	return nil
+}
+
+func (d *SSHDevice) Upload(localPath, name string) error {
+	return d.TransferFile(localPath, d.remotePath(name))
+}
+
+func (d *SSHDevice) Download(name, localPath string) error {
+	return d.DownloadFromRemote(d.remotePath(name), localPath)
+}
+
+func (d *SSHDevice) Hash(name string) (string, error) {
+	output, err := d.RunCommand("sha256sum " + shellQuote(d.remotePath(name)))
+	if err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", name, err)
+	}
+	fields := strings.Fields(output)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("failed to hash %s: empty output", name)
+	}
+	return fields[0], nil
+}
+
+func (d *SSHDevice) Mkdir(name string) error {
+	if _, err := d.RunCommand("mkdir -p " + shellQuote(d.remotePath(name))); err != nil {
+		return fmt.Errorf("failed to create %s: %w", name, err)
+	}
+	return nil
+}
+
+func (d *SSHDevice) Remove(name string) error {
+	if _, err := d.RunCommand("rm -rf " + shellQuote(d.remotePath(name))); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", name, err)
+	}
+	return nil
+}
+
+func (d *SSHDevice) Service(action string) error {
+	_, err := d.RunCommand("systemctl " + action + " xochitl")
+	return err
+}
@@ -0,0 +1,157 @@
+package remarkable
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kevinburke/ssh_config"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// hostConfig is where to connect for a host after applying ~/.ssh/config
+type hostConfig struct {
+	Alias         string
+	HostName      string
+	Port          string
+	User          string
+	IdentityFiles []string
+}
+
+func (h hostConfig) address() string {
+	return net.JoinHostPort(h.HostName, h.Port)
+}
+
+// resolveHost applies HostName, Port, User and IdentityFile entries from ssh_config
+func resolveHost(alias string) hostConfig {
+	h := hostConfig{
+		Alias:    alias,
+		HostName: alias,
+		Port:     "22",
+		User:     "root",
+	}
+	if v := ssh_config.Get(alias, "HostName"); v != "" {
+		h.HostName = strings.ReplaceAll(v, "%h", alias)
+	}
+	if v := ssh_config.Get(alias, "Port"); v != "" {
+		h.Port = v
+	}
+	if v := ssh_config.Get(alias, "User"); v != "" {
+		h.User = v
+	}
+
+	home, _ := os.UserHomeDir()
+	for _, file := range ssh_config.GetAll(alias, "IdentityFile") {
+		h.IdentityFiles = append(h.IdentityFiles, expandPath(file, home, h))
+	}
+	// the usual key names, as ssh itself tries them
+	for _, name := range []string{"id_rsa", "id_ecdsa", "id_ed25519"} {
+		h.IdentityFiles = append(h.IdentityFiles, filepath.Join(home, ".ssh", name))
+	}
+
+	return h
+}
+
+// expandPath handles the ~ and % tokens ssh allows in IdentityFile
+func expandPath(path, home string, h hostConfig) string {
+	if strings.HasPrefix(path, "~/") {
+		path = filepath.Join(home, path[2:])
+	}
+	return strings.NewReplacer(
+		"%d", home,
+		"%h", h.HostName,
+		"%n", h.Alias,
+		"%p", h.Port,
+		"%r", h.User,
+		"%%", "%",
+	).Replace(path)
+}
+
+// authMethods tries ssh-agent and key files first, then the password
+func (d *SSHDevice) authMethods(h hostConfig) []ssh.AuthMethod {
+	// the ssh client tries each method type once, so every key goes through one callback
+	methods := []ssh.AuthMethod{
+		ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			return d.signers(h), nil
+		}),
+	}
+
+	// root password from Settings > Help, or the empty password tablets used to accept
+	methods = append(methods, ssh.Password(d.opts.Password))
+	if d.opts.Password != "" {
+		methods = append(methods, ssh.KeyboardInteractive(func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+			answers := make([]string, len(questions))
+			for i := range answers {
+				answers[i] = d.opts.Password
+			}
+			return answers, nil
+		}))
+	}
+
+	return methods
+}
+
+// signers collects keys from ssh-agent and identity files
+// encrypted keys are only unlocked when the agent doesn't already hold them
+func (d *SSHDevice) signers(h hostConfig) []ssh.Signer {
+	var signers []ssh.Signer
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			// an earlier failed attempt may have left one open
+			if d.agentConn != nil {
+				d.agentConn.Close()
+			}
+			d.agentConn = conn
+			if agentSigners, err := agent.NewClient(conn).Signers(); err == nil {
+				signers = append(signers, agentSigners...)
+			}
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, file := range h.IdentityFiles {
+		if seen[file] {
+			continue
+		}
+		seen[file] = true
+
+		key, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+
+		signer, err := ssh.ParsePrivateKey(key)
+		var missing *ssh.PassphraseMissingError
+		if errors.As(err, &missing) {
+			if hasKey(signers, missing.PublicKey) || d.opts.Passphrase == nil {
+				continue
+			}
+			passphrase, perr := d.opts.Passphrase(file)
+			if perr != nil {
+				continue
+			}
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(key, passphrase)
+		}
+		if err == nil {
+			signers = append(signers, signer)
+		}
+	}
+
+	return signers
+}
+
+func hasKey(signers []ssh.Signer, key ssh.PublicKey) bool {
+	if key == nil {
+		return false
+	}
+	for _, s := range signers {
+		if bytes.Equal(s.PublicKey().Marshal(), key.Marshal()) {
+			return true
+		}
+	}
+	return false
+}
@@ -22,8 +22,12 @@ const (
 
 // file info for listing
 type FileInfo struct {
-	UUID string
-	Name string
+	UUID         string
+	Name         string
+	Parent       string
+	Folder       bool
+	Version      int
+	LastModified string
 }
 
 // metadata json structure
@@ -60,63 +64,51 @@ type Transform struct {
 // FileExists checks if a file with the given visibleName already exists on reMarkable
 // excludes files in trash
 func (c *Client) FileExists(visibleName string) (bool, error) {
-	// search for the visible name in metadata files
-	cmd := fmt.Sprintf("grep -l \"%s\" %s/*.metadata 2>/dev/null", visibleName, c.Dir)
-	output, err := c.RunCommand(cmd)
-	if err != nil || strings.TrimSpace(output) == "" {
-		return false, nil
+	index, err := c.Index()
+	if err != nil {
+		return false, err
 	}
-
-	// checks each matching file to see if it's in trash
-	files := strings.Split(strings.TrimSpace(output), "\n")
-	for _, file := range files {
-		// reads the metadata to check if it's in trash
-		content, err := c.RunCommand(fmt.Sprintf("cat %s", file))
-		if err != nil {
-			continue
-		}
-
-		// parses metadata to properly check parent field
-		var metadata Metadata
-		if err := json.Unmarshal([]byte(content), &metadata); err != nil {
-			// fallback to string check if JSON parse fails
-			if !strings.Contains(content, `"parent": "trash"`) {
-				return true, nil
-			}
-			continue
-		}
-
-		// checks if parent is not "trash"
-		if metadata.Parent != "trash" {
+	for _, doc := range index.documents() {
+		if doc.err == nil && doc.metadata.VisibleName == visibleName && doc.metadata.Parent != "trash" {
 			return true, nil
 		}
 	}
-
 	return false, nil
 }
 
-func (c *Client) UploadFile(localPath string, visibleName string, forceOverwrite bool, parentUUID ...string) error {
+// UploadFile creates a new document on reMarkable and returns its UUID
+func (c *Client) UploadFile(localPath string, visibleName string, forceOverwrite bool, parentUUID ...string) (string, error) {
 	// check if file already exists
 	exists, err := c.FileExists(visibleName)
 	if err != nil {
-		return fmt.Errorf("failed to check if file exists: %w", err)
+		return "", fmt.Errorf("failed to check if file exists: %w", err)
 	}
 	if exists && !forceOverwrite {
-		return fmt.Errorf("file '%s' already exists on reMarkable (use --force to overwrite)", visibleName)
+		return "", fmt.Errorf("file '%s' already exists on reMarkable (use --force to overwrite)", visibleName)
 	}
 
 	// if forcing overwrite, delete existing file first
 	if exists && forceOverwrite {
 		if err := c.DeleteFileByName(visibleName); err != nil {
-			return fmt.Errorf("failed to delete existing file: %w", err)
+			return "", fmt.Errorf("failed to delete existing file: %w", err)
 		}
 	}
 
 	id := uuid.New().String()
-	fileType := PDF
-	if strings.HasSuffix(strings.ToLower(localPath), ".epub") {
-		fileType = EPUB
+	parent := ""
+	if len(parentUUID) > 0 {
+		parent = parentUUID[0]
+	}
+	if err := c.UploadFileWithID(id, localPath, visibleName, parent); err != nil {
+		return "", err
 	}
+	return id, nil
+}
+
+// UploadFileWithID creates a new document under a caller-chosen UUID
+// it doesn't check for existing documents with the same name
+func (c *Client) UploadFileWithID(id, localPath, visibleName, parentUUID string) error {
+	fileType := fileTypeOf(localPath)
 
 	metadata := Metadata{
 		LastModified: fmt.Sprintf("%d000", time.Now().Unix()),
@@ -126,8 +118,8 @@ func (c *Client) UploadFile(localPath string, visibleName string, forceOverwrite
 	}
 
 	// sets parent folder if provided
-	if len(parentUUID) > 0 && parentUUID[0] != "" {
-		metadata.Parent = parentUUID[0]
+	if parentUUID != "" {
+		metadata.Parent = parentUUID
 	}
 
 	content := Content{
@@ -145,99 +137,163 @@ func (c *Client) UploadFile(localPath string, visibleName string, forceOverwrite
 		}
 	}
 
-	// temp dir for metadata
-	tmpDir, err := os.MkdirTemp("", "remarkable-*")
+	// the document goes first, xochitl only shows it once the metadata exists
+	if err := c.upload(localPath, id+"."+string(fileType)); err != nil {
+		return fmt.Errorf("failed to transfer %s: %w", filepath.Base(localPath), err)
+	}
+	if err := c.writeJSON(id+".metadata", metadata); err != nil {
+		return err
+	}
+	if err := c.writeJSON(id+".content", content); err != nil {
+		return err
+	}
+
+	// make required dirs
+	for _, dir := range []string{"thumbnails", "highlights", "cache"} {
+		if err := c.mkdir(id + "." + dir); err != nil {
+			return fmt.Errorf("failed to create %s: %w", dir, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) writeJSON(name string, v interface{}) error {
+	data, err := json.Marshal(v)
 	if err != nil {
-		return fmt.Errorf("failed to create temp dir: %w", err)
+		return fmt.Errorf("failed to marshal %s: %w", name, err)
+	}
+	if err := c.writeFile(name, data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// GetMetadata reads the metadata of a document or folder by UUID
+// Returns nil if the UUID doesn't exist
+func (c *Client) GetMetadata(id string) (*Metadata, error) {
+	raw, err := c.readMetadata(id)
+	if err != nil || raw == nil {
+		return nil, err
 	}
-	defer os.RemoveAll(tmpDir)
 
-	// write metadata
-	metadataBytes, err := json.Marshal(metadata)
+	var metadata Metadata
+	if err := json.Unmarshal(raw, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to parse metadata for %s: %w", id, err)
+	}
+	return &metadata, nil
+}
+
+func (c *Client) readMetadata(id string) ([]byte, error) {
+	index, err := c.Index()
 	if err != nil {
-		return fmt.Errorf("failed to marshal metadata: %w", err)
+		return nil, err
 	}
-	if err := os.WriteFile(filepath.Join(tmpDir, id+".metadata"), metadataBytes, 0644); err != nil {
-		return fmt.Errorf("failed to write metadata: %w", err)
+	if doc := index.get(id); doc != nil {
+		return doc.raw, nil
 	}
+	return nil, nil
+}
 
-	// write content
-	contentBytes, err := json.Marshal(content)
+// ReplaceFile overwrites the document blob of an existing UUID in place
+// annotations, name and folder are kept; the metadata version is bumped so xochitl reloads it
+func (c *Client) ReplaceFile(id, localPath string) error {
+	metadata, err := c.bumpMetadata(id)
 	if err != nil {
-		return fmt.Errorf("failed to marshal content: %w", err)
-	}
-	if err := os.WriteFile(filepath.Join(tmpDir, id+".content"), contentBytes, 0644); err != nil {
-		return fmt.Errorf("failed to write content: %w", err)
-	}
-
-	// transfer files
-	for _, f := range []struct {
-		src, dst string
-	}{
-		{localPath, filepath.Join(c.Dir, id+"."+string(fileType))},
-		{filepath.Join(tmpDir, id+".metadata"), filepath.Join(c.Dir, id+".metadata")},
-		{filepath.Join(tmpDir, id+".content"), filepath.Join(c.Dir, id+".content")},
-	} {
-		if err := c.TransferFile(f.src, f.dst); err != nil {
-			return fmt.Errorf("failed to transfer %s: %w", filepath.Base(f.src), err)
-		}
+		return err
 	}
 
-	// make required dirs
-	for _, dir := range []string{"thumbnails", "highlights", "cache"} {
-		if _, err := c.RunCommand(fmt.Sprintf("mkdir -p %s/%s.%s", c.Dir, id, dir)); err != nil {
-			return fmt.Errorf("failed to create %s: %w", dir, err)
-		}
+	if err := c.upload(localPath, id+"."+string(fileTypeOf(localPath))); err != nil {
+		return fmt.Errorf("failed to transfer %s: %w", filepath.Base(localPath), err)
+	}
+	if err := c.writeJSON(id+".metadata", metadata); err != nil {
+		return err
+	}
+
+	// thumbnails of the old pages are stale now
+	if err := c.remove(id + ".thumbnails"); err != nil {
+		return fmt.Errorf("failed to clear thumbnails: %w", err)
+	}
+	if err := c.mkdir(id + ".thumbnails"); err != nil {
+		return fmt.Errorf("failed to clear thumbnails: %w", err)
 	}
 
 	return nil
 }
 
-func (c *Client) ListFiles() ([]FileInfo, error) {
-	// get metadata files
-	output, err := c.RunCommand(fmt.Sprintf("ls %s/*.metadata", c.Dir))
+// MoveFile puts a document or folder into another folder, "" being the top level
+func (c *Client) MoveFile(id, parentUUID string) error {
+	metadata, err := c.bumpMetadata(id)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list files: %w", err)
+		return err
 	}
+	metadata["parent"] = parentUUID
+	return c.writeJSON(id+".metadata", metadata)
+}
 
-	var files []FileInfo
-	for _, metadataPath := range strings.Split(strings.TrimSpace(output), "\n") {
-		// get uuid from filename
-		uuid := strings.TrimSuffix(filepath.Base(metadataPath), ".metadata")
+// bumpMetadata returns the raw metadata of id with its version and lastModified
+// moved on, patching the json so fields we don't model survive
+func (c *Client) bumpMetadata(id string) (map[string]interface{}, error) {
+	raw, err := c.readMetadata(id)
+	if err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		return nil, fmt.Errorf("document %s not found on reMarkable", id)
+	}
 
-		// check pdf exists
-		if _, err := c.RunCommand(fmt.Sprintf("test -f %s/%s.pdf", c.Dir, uuid)); err != nil {
-			continue
-		}
+	var metadata map[string]interface{}
+	if err := json.Unmarshal(raw, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to parse metadata for %s: %w", id, err)
+	}
+	version, _ := metadata["version"].(float64)
+	metadata["version"] = int(version) + 1
+	metadata["lastModified"] = fmt.Sprintf("%d000", time.Now().Unix())
+	return metadata, nil
+}
 
-		// read metadata
-		content, err := c.RunCommand(fmt.Sprintf("cat %s", metadataPath))
-		if err != nil {
+func fileTypeOf(path string) FileType {
+	if strings.HasSuffix(strings.ToLower(path), ".epub") {
+		return EPUB
+	}
+	return PDF
+}
+
+// ListFiles returns the documents that have a pdf
+func (c *Client) ListFiles() ([]FileInfo, error) {
+	index, err := c.Index()
+	if err != nil {
+		return nil, err
+	}
+
+	var files []FileInfo
+	for _, doc := range index.documents() {
+		if !index.Has(doc.id + ".pdf") {
 			continue
 		}
 
-		// get visible name
-		var metadata Metadata
-		if err := json.Unmarshal([]byte(content), &metadata); err != nil {
+		if doc.err != nil {
 			// fallback to regex if json parse fails
-			if matches := regexp.MustCompile(`"visibleName":\s*"([^"]+)"`).FindStringSubmatch(content); len(matches) > 1 {
+			if matches := regexp.MustCompile(`"visibleName":\s*"([^"]+)"`).FindSubmatch(doc.raw); len(matches) > 1 {
 				files = append(files, FileInfo{
-					UUID: uuid,
-					Name: matches[1],
+					UUID: doc.id,
+					Name: string(matches[1]),
 				})
 			}
 			continue
 		}
 
-		files = append(files, FileInfo{
-			UUID: uuid,
-			Name: metadata.VisibleName,
-		})
+		files = append(files, doc.info())
 	}
 
 	return files, nil
 }
 
+// FileHash returns the hex sha256 of a document's pdf on reMarkable
+func (c *Client) FileHash(id string) (string, error) {
+	return c.dev.Hash(id + ".pdf")
+}
+
 func (c *Client) DownloadFile(uuid, name string) (string, error) {
 	tmpDir, err := os.MkdirTemp("", "remarkable-*")
 	if err != nil {
@@ -245,8 +301,7 @@ func (c *Client) DownloadFile(uuid, name string) (string, error) {
 	}
 
 	localPath := filepath.Join(tmpDir, name+".pdf")
-	remotePath := filepath.Join(c.Dir, uuid+".pdf")
-	if err := c.DownloadFromRemote(remotePath, localPath); err != nil {
+	if err := c.dev.Download(uuid+".pdf", localPath); err != nil {
 		os.RemoveAll(tmpDir)
 		return "", fmt.Errorf("failed to download file: %w", err)
 	}
@@ -254,43 +309,71 @@ func (c *Client) DownloadFile(uuid, name string) (string, error) {
 	return localPath, nil
 }
 
+// RemoveFile deletes every file and directory belonging to a document
 func (c *Client) RemoveFile(uuid string) error {
-	cmd := fmt.Sprintf("rm -rf %s/%s*", c.Dir, uuid)
-	if _, err := c.RunCommand(cmd); err != nil {
+	index, err := c.Index()
+	if err != nil {
 		return fmt.Errorf("failed to remove file: %w", err)
 	}
+	for _, name := range index.Names() {
+		if name != uuid && !strings.HasPrefix(name, uuid+".") {
+			continue
+		}
+		if err := c.remove(name); err != nil {
+			return fmt.Errorf("failed to remove file: %w", err)
+		}
+	}
 	return nil
 }
 
-// DeleteFileByName deletes all files (including those in trash) with the given visible name
-func (c *Client) DeleteFileByName(visibleName string) error {
-	// get all metadata files first
-	allFiles, err := c.RunCommand(fmt.Sprintf("ls %s/*.metadata 2>/dev/null", c.Dir))
-	if err != nil || strings.TrimSpace(allFiles) == "" {
-		return nil // No files
+// FindByName returns all documents and folders (including those in trash) with the given visible name
+func (c *Client) FindByName(visibleName string) ([]FileInfo, error) {
+	index, err := c.Index()
+	if err != nil {
+		return nil, err
 	}
 
-	// checks each file individually for exact name match (not grep pattern)
-	filePaths := strings.Split(strings.TrimSpace(allFiles), "\n")
-	for _, filePath := range filePaths {
-		// reads metadata
-		content, err := c.RunCommand(fmt.Sprintf("cat %s", filePath))
-		if err != nil {
-			continue
+	// exact name match only
+	var files []FileInfo
+	for _, doc := range index.documents() {
+		if doc.err == nil && doc.metadata.VisibleName == visibleName {
+			files = append(files, doc.info())
 		}
+	}
+
+	return files, nil
+}
+
+// FindInFolder returns the documents with the given visible name directly inside parentUUID, "" being the top level
+func (c *Client) FindInFolder(parentUUID, visibleName string) ([]FileInfo, error) {
+	index, err := c.Index()
+	if err != nil {
+		return nil, err
+	}
 
-		// parses json to check visibleName / exact match only
-		var metadata Metadata
-		if err := json.Unmarshal([]byte(content), &metadata); err != nil {
+	var files []FileInfo
+	for _, doc := range index.documents() {
+		if doc.err != nil || doc.metadata.Type == "CollectionType" {
 			continue
 		}
+		if doc.metadata.VisibleName == visibleName && doc.metadata.Parent == parentUUID {
+			files = append(files, doc.info())
+		}
+	}
 
-		// only delete if exact match
-		if metadata.VisibleName == visibleName {
-			uuid := strings.TrimSuffix(filepath.Base(filePath), ".metadata")
-			if err := c.RemoveFile(uuid); err != nil {
-				return err
-			}
+	return files, nil
+}
+
+// DeleteFileByName deletes all files (including those in trash) with the given visible name
+func (c *Client) DeleteFileByName(visibleName string) error {
+	files, err := c.FindByName(visibleName)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if err := c.RemoveFile(file.UUID); err != nil {
+			return err
 		}
 	}
 
@@ -303,11 +386,16 @@ type CleanupResult struct {
 	DeletedFiles   []FileInfo
 }
 
+// CleanupExcept removes every document and folder whose metadata doesn't match pattern
 func (c *Client) CleanupExcept(pattern string, dryRun bool) (*CleanupResult, error) {
-	// list metadata files and find ones to preserve
-	output, err := c.RunCommand(fmt.Sprintf("ls %s/*.metadata", c.Dir))
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+
+	index, err := c.Index()
 	if err != nil {
-		return nil, fmt.Errorf("failed to list files: %w", err)
+		return nil, err
 	}
 
 	result := &CleanupResult{
@@ -315,38 +403,23 @@ func (c *Client) CleanupExcept(pattern string, dryRun bool) (*CleanupResult, err
 		DeletedFiles:   []FileInfo{},
 	}
 
-	for _, metadataPath := range strings.Split(strings.TrimSpace(output), "\n") {
-		content, err := c.RunCommand(fmt.Sprintf("cat %s", metadataPath))
-		if err != nil {
-			continue
-		}
-
-		uuid := strings.TrimSuffix(filepath.Base(metadataPath), ".metadata")
-
-		// parse metadata to get visible name
-		var metadata Metadata
-		var visibleName string
-		if err := json.Unmarshal([]byte(content), &metadata); err == nil {
-			visibleName = metadata.VisibleName
-		} else {
+	for _, doc := range index.documents() {
+		fileInfo := doc.info()
+		if doc.err != nil {
 			// fallback to uuid if can't parse
-			visibleName = uuid
+			fileInfo.Name = doc.id
 		}
 
-		fileInfo := FileInfo{
-			UUID: uuid,
-			Name: visibleName,
+		if re.Match(doc.raw) {
+			result.PreservedFiles = append(result.PreservedFiles, fileInfo)
+			continue
 		}
 
-		if matched, _ := regexp.MatchString(pattern, content); matched {
-			result.PreservedFiles = append(result.PreservedFiles, fileInfo)
-		} else {
-			result.DeletedFiles = append(result.DeletedFiles, fileInfo)
-			// only delete if not dry run
-			if !dryRun {
-				if err := c.RemoveFile(uuid); err != nil {
-					return result, fmt.Errorf("failed to remove %s: %w", visibleName, err)
-				}
+		result.DeletedFiles = append(result.DeletedFiles, fileInfo)
+		// only delete if not dry run
+		if !dryRun {
+			if err := c.RemoveFile(doc.id); err != nil {
+				return result, fmt.Errorf("failed to remove %s: %w", fileInfo.Name, err)
 			}
 		}
 	}
@@ -354,114 +427,106 @@ func (c *Client) CleanupExcept(pattern string, dryRun bool) (*CleanupResult, err
 	return result, nil
 }
 
-// FindFolderUUID finds the UUID of a folder by its visible name
-// Returns empty string if folder doesn't exist
-func (c *Client) FindFolderUUID(folderName string) (string, error) {
-	// search for metadata files with CollectionType
-	cmd := fmt.Sprintf("grep -l '\"type\":.*\"CollectionType\"' %s/*.metadata 2>/dev/null", c.Dir)
-	output, _ := c.RunCommand(cmd)
-
-	// if grep finds nothing / returns exit code 1, which RunCommand treats as error
-	// means no folders exist
-	if strings.TrimSpace(output) == "" {
-		return "", nil
+// SplitFolderPath splits a folder path like "Research/AI Papers" into its names
+func SplitFolderPath(folderPath string) []string {
+	var names []string
+	for _, name := range strings.Split(folderPath, "/") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
 	}
+	return names
+}
 
-	// check each matching file for the folder name
-	filePaths := strings.Split(strings.TrimSpace(output), "\n")
+// FindChildFolder finds a folder by name directly inside parentUUID, "" being the top level
+// Returns empty string if there's no such folder
+func (c *Client) FindChildFolder(parentUUID, folderName string) (string, error) {
+	index, err := c.Index()
+	if err != nil {
+		return "", err
+	}
 
-	for _, filePath := range filePaths {
-		if filePath == "" {
+	for _, doc := range index.documents() {
+		if doc.err != nil {
 			continue
 		}
-
-		content, err := c.RunCommand(fmt.Sprintf("cat %s", filePath))
-		if err != nil {
-			continue
+		if doc.metadata.Type == "CollectionType" && doc.metadata.VisibleName == folderName && doc.metadata.Parent == parentUUID {
+			return doc.id, nil
 		}
+	}
 
-		var metadata Metadata
-		if err := json.Unmarshal([]byte(content), &metadata); err != nil {
-			continue
-		}
+	return "", nil
+}
 
-		// checks if it's a collection with matching name
-		if metadata.VisibleName == folderName && metadata.Parent != "trash" {
-			return strings.TrimSuffix(filepath.Base(filePath), ".metadata"), nil
+// ResolveFolderPath walks a folder path from the top level as far as it exists
+// it returns the deepest existing folder's UUID and the names still missing below it
+func (c *Client) ResolveFolderPath(folderPath string) (string, []string, error) {
+	names := SplitFolderPath(folderPath)
+	parent := ""
+	for i, name := range names {
+		id, err := c.FindChildFolder(parent, name)
+		if err != nil {
+			return "", nil, err
+		}
+		if id == "" {
+			return parent, names[i:], nil
 		}
+		parent = id
 	}
+	return parent, nil, nil
+}
 
-	return "", nil
+// FindFolderUUID finds the UUID of a folder by its full path, such as "Research/AI Papers"
+// Returns empty string if folder doesn't exist
+func (c *Client) FindFolderUUID(folderPath string) (string, error) {
+	id, missing, err := c.ResolveFolderPath(folderPath)
+	if err != nil || len(missing) > 0 {
+		return "", err
+	}
+	return id, nil
 }
 
-// CreateFolder creates a new folder on reMarkable and returns its UUID
+// CreateFolder creates a new top-level folder on reMarkable and returns its UUID
 func (c *Client) CreateFolder(folderName string) (string, error) {
 	folderID := uuid.New().String()
+	if err := c.CreateFolderWithID(folderID, folderName, ""); err != nil {
+		return "", err
+	}
+	return folderID, nil
+}
 
+// CreateFolderWithID creates a folder under a caller-chosen UUID and parent
+func (c *Client) CreateFolderWithID(folderID, folderName, parentUUID string) error {
 	metadata := Metadata{
 		LastModified: fmt.Sprintf("%d000", time.Now().Unix()),
 		Type:         "CollectionType",
 		Version:      1,
 		VisibleName:  folderName,
-		Parent:       "",
+		Parent:       parentUUID,
 	}
 
-	// creates empty content file for folder
-	content := Content{}
-
-	// temp dir for metadata
-	tmpDir, err := os.MkdirTemp("", "remarkable-*")
-	if err != nil {
-		return "", fmt.Errorf("failed to create temp dir: %w", err)
-	}
-	defer os.RemoveAll(tmpDir)
-
-	// write metadata
-	metadataBytes, err := json.Marshal(metadata)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal metadata: %w", err)
-	}
-	if err := os.WriteFile(filepath.Join(tmpDir, folderID+".metadata"), metadataBytes, 0644); err != nil {
-		return "", fmt.Errorf("failed to write metadata: %w", err)
-	}
-
-	// write content
-	contentBytes, err := json.Marshal(content)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal content: %w", err)
-	}
-	if err := os.WriteFile(filepath.Join(tmpDir, folderID+".content"), contentBytes, 0644); err != nil {
-		return "", fmt.Errorf("failed to write content: %w", err)
+	// folders have an empty content file
+	if err := c.writeJSON(folderID+".content", Content{}); err != nil {
+		return err
 	}
-
-	// transfer files
-	for _, f := range []struct {
-		src, dst string
-	}{
-		{filepath.Join(tmpDir, folderID+".metadata"), filepath.Join(c.Dir, folderID+".metadata")},
-		{filepath.Join(tmpDir, folderID+".content"), filepath.Join(c.Dir, folderID+".content")},
-	} {
-		if err := c.TransferFile(f.src, f.dst); err != nil {
-			return "", fmt.Errorf("failed to transfer %s: %w", filepath.Base(f.src), err)
-		}
-	}
-
-	return folderID, nil
+	return c.writeJSON(folderID+".metadata", metadata)
 }
 
-// EnsureFolder ensures a folder exists, creating it if necessary
-// Returns the folder's UUID
-func (c *Client) EnsureFolder(folderName string) (string, error) {
-	// checks if folder already exists
-	folderUUID, err := c.FindFolderUUID(folderName)
+// EnsureFolder ensures a folder path exists, creating each missing folder under its parent
+// Returns the UUID of the last folder in the path
+func (c *Client) EnsureFolder(folderPath string) (string, error) {
+	parent, missing, err := c.ResolveFolderPath(folderPath)
 	if err != nil {
 		return "", fmt.Errorf("failed to find folder: %w", err)
 	}
 
-	if folderUUID != "" {
-		return folderUUID, nil
+	for _, name := range missing {
+		id := uuid.New().String()
+		if err := c.CreateFolderWithID(id, name, parent); err != nil {
+			return "", err
+		}
+		parent = id
 	}
 
-	// creates folder
-	return c.CreateFolder(folderName)
+	return parent, nil
 }
@@ -0,0 +1,389 @@
+package remarkable
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// uuids in testdata/xochitl
+const (
+	researchID = "aaaaaaaa-0000-4000-8000-000000000001" // folder
+	paperID    = "bbbbbbbb-0000-4000-8000-000000000002" // pdf in Research
+	sheetsID   = "cccccccc-0000-4000-8000-000000000003" // notebook
+	oldID      = "dddddddd-0000-4000-8000-000000000004" // pdf in trash
+	bookID     = "eeeeeeee-0000-4000-8000-000000000005" // epub
+)
+
+const golden = "testdata/xochitl"
+
+// forEachDevice runs a test against a fresh copy of the golden tree on every backend
+func forEachDevice(t *testing.T, test func(t *testing.T, c *Client, dev Device)) {
+	t.Run("memory", func(t *testing.T) {
+		dev, err := LoadMemDevice(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		test(t, NewDeviceClient(dev), dev)
+	})
+	t.Run("local", func(t *testing.T) {
+		dir := t.TempDir()
+		if err := os.CopyFS(dir, os.DirFS(golden)); err != nil {
+			t.Fatal(err)
+		}
+		dev := NewLocalDevice(dir)
+		test(t, NewDeviceClient(dev), dev)
+	})
+}
+
+func names(files []FileInfo) []string {
+	var out []string
+	for _, f := range files {
+		out = append(out, f.Name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func listNames(t *testing.T, dev Device) []string {
+	t.Helper()
+	stats, err := dev.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []string
+	for _, st := range stats {
+		out = append(out, st.Name)
+	}
+	return out
+}
+
+func writeTemp(t *testing.T, name, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestListFiles(t *testing.T) {
+	forEachDevice(t, func(t *testing.T, c *Client, dev Device) {
+		files, err := c.ListFiles()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := names(files), []string{"Old notes", "Paper"}; !slices.Equal(got, want) {
+			t.Errorf("ListFiles() = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestFileExists(t *testing.T) {
+	forEachDevice(t, func(t *testing.T, c *Client, dev Device) {
+		for name, want := range map[string]bool{
+			"Paper":     true,
+			"Research":  true,
+			"Old notes": false, // trashed
+			"Pap":       false,
+			"Missing":   false,
+		} {
+			got, err := c.FileExists(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Errorf("FileExists(%q) = %v, want %v", name, got, want)
+			}
+		}
+	})
+}
+
+func TestFindByNameIncludesTrash(t *testing.T) {
+	forEachDevice(t, func(t *testing.T, c *Client, dev Device) {
+		files, err := c.FindByName("Old notes")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) != 1 || files[0].UUID != oldID || files[0].Parent != "trash" || files[0].Version != 2 {
+			t.Errorf("FindByName() = %+v", files)
+		}
+	})
+}
+
+func TestFindInFolder(t *testing.T) {
+	forEachDevice(t, func(t *testing.T, c *Client, dev Device) {
+		for _, tc := range []struct {
+			parent, name string
+			want         []string
+		}{
+			{researchID, "Paper", []string{paperID}},
+			{"", "Paper", nil},     // only inside Research
+			{"", "Research", nil},  // folders aren't documents
+			{"", "Old notes", nil}, // trashed
+			{"trash", "Old notes", []string{oldID}},
+		} {
+			files, err := c.FindInFolder(tc.parent, tc.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, file := range files {
+				got = append(got, file.UUID)
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("FindInFolder(%q, %q) = %v, want %v", tc.parent, tc.name, got, tc.want)
+			}
+		}
+	})
+}
+
+func TestFolders(t *testing.T) {
+	forEachDevice(t, func(t *testing.T, c *Client, dev Device) {
+		id, err := c.FindFolderUUID("Research")
+		if err != nil || id != researchID {
+			t.Fatalf("FindFolderUUID(Research) = %q, %v", id, err)
+		}
+
+		// documents of the same name aren't folders
+		if id, _ := c.FindFolderUUID("Paper"); id != "" {
+			t.Errorf("FindFolderUUID(Paper) = %q, want none", id)
+		}
+
+		created, err := c.EnsureFolder("Inbox")
+		if err != nil {
+			t.Fatal(err)
+		}
+		again, err := c.EnsureFolder("Inbox")
+		if err != nil || again != created {
+			t.Errorf("EnsureFolder(Inbox) twice = %q, %q", created, again)
+		}
+		metadata, err := c.GetMetadata(created)
+		if err != nil || metadata == nil || metadata.Type != "CollectionType" || metadata.Parent != "" {
+			t.Errorf("GetMetadata(%s) = %+v, %v", created, metadata, err)
+		}
+	})
+}
+
+func TestNestedFolders(t *testing.T) {
+	forEachDevice(t, func(t *testing.T, c *Client, dev Device) {
+		papers, err := c.EnsureFolder("Research/AI Papers")
+		if err != nil {
+			t.Fatal(err)
+		}
+		metadata, _ := c.GetMetadata(papers)
+		if metadata == nil || metadata.VisibleName != "AI Papers" || metadata.Parent != researchID {
+			t.Fatalf("AI Papers metadata = %+v", metadata)
+		}
+		if again, _ := c.EnsureFolder("/Research/AI Papers/"); again != papers {
+			t.Errorf("EnsureFolder() with extra slashes = %q, want %q", again, papers)
+		}
+
+		// same name in different places are different folders
+		nested, err := c.EnsureFolder("Research/Archive")
+		if err != nil {
+			t.Fatal(err)
+		}
+		top, err := c.EnsureFolder("Archive")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if nested == top {
+			t.Fatal("Research/Archive and Archive resolved to the same folder")
+		}
+		if id, _ := c.FindFolderUUID("Archive"); id != top {
+			t.Errorf("FindFolderUUID(Archive) = %q, want %q", id, top)
+		}
+		if id, _ := c.FindFolderUUID("Research/Archive"); id != nested {
+			t.Errorf("FindFolderUUID(Research/Archive) = %q, want %q", id, nested)
+		}
+
+		parent, missing, err := c.ResolveFolderPath("Research/New/Deeper")
+		if err != nil || parent != researchID || !slices.Equal(missing, []string{"New", "Deeper"}) {
+			t.Errorf("ResolveFolderPath() = %q, %v, %v", parent, missing, err)
+		}
+	})
+}
+
+func TestUploadFileWithID(t *testing.T) {
+	forEachDevice(t, func(t *testing.T, c *Client, dev Device) {
+		src := writeTemp(t, "note.pdf", "%PDF-1.4 note")
+		id := "ffffffff-0000-4000-8000-000000000006"
+		if err := c.UploadFileWithID(id, src, "Note", researchID); err != nil {
+			t.Fatal(err)
+		}
+
+		metadata, err := c.GetMetadata(id)
+		if err != nil || metadata == nil {
+			t.Fatalf("GetMetadata() = %v, %v", metadata, err)
+		}
+		if metadata.VisibleName != "Note" || metadata.Parent != researchID || metadata.Version != 1 || metadata.Type != "DocumentType" {
+			t.Errorf("metadata = %+v", metadata)
+		}
+
+		raw, err := dev.ReadFile(id + ".content")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var content Content
+		if err := json.Unmarshal(raw, &content); err != nil || content.FileType != "pdf" || content.Transform == nil {
+			t.Errorf("content = %s", raw)
+		}
+
+		sum := sha256.Sum256([]byte("%PDF-1.4 note"))
+		if hash, err := c.FileHash(id); err != nil || hash != hex.EncodeToString(sum[:]) {
+			t.Errorf("FileHash() = %q, %v", hash, err)
+		}
+
+		listed := listNames(t, dev)
+		for _, dir := range []string{".thumbnails", ".highlights", ".cache"} {
+			if !slices.Contains(listed, id+dir) {
+				t.Errorf("%s%s was not created", id, dir)
+			}
+		}
+	})
+}
+
+func TestUploadFileRefusesDuplicate(t *testing.T) {
+	forEachDevice(t, func(t *testing.T, c *Client, dev Device) {
+		src := writeTemp(t, "Paper.pdf", "%PDF-1.4 new")
+		if _, err := c.UploadFile(src, "Paper", false); err == nil {
+			t.Fatal("UploadFile() of an existing name succeeded without force")
+		}
+
+		id, err := c.UploadFile(src, "Paper", true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files, _ := c.FindByName("Paper")
+		if len(files) != 1 || files[0].UUID != id {
+			t.Errorf("FindByName(Paper) after forced upload = %+v", files)
+		}
+	})
+}
+
+func TestReplaceFile(t *testing.T) {
+	forEachDevice(t, func(t *testing.T, c *Client, dev Device) {
+		src := writeTemp(t, "paper.pdf", "%PDF-1.4 paper v2")
+		if err := c.ReplaceFile(paperID, src); err != nil {
+			t.Fatal(err)
+		}
+
+		raw, err := dev.ReadFile(paperID + ".metadata")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var metadata map[string]interface{}
+		if err := json.Unmarshal(raw, &metadata); err != nil {
+			t.Fatal(err)
+		}
+		if metadata["version"] != float64(4) || metadata["parent"] != researchID || metadata["pinned"] != true {
+			t.Errorf("metadata after replace = %s", raw)
+		}
+
+		data, err := dev.ReadFile(paperID + ".pdf")
+		if err != nil || string(data) != "%PDF-1.4 paper v2" {
+			t.Errorf("pdf after replace = %q, %v", data, err)
+		}
+		if _, err := dev.ReadFile(paperID + ".thumbnails/0.png"); !os.IsNotExist(err) {
+			t.Errorf("stale thumbnail kept: %v", err)
+		}
+		if _, err := dev.ReadFile(paperID + ".highlights/0.json"); err != nil {
+			t.Errorf("highlights lost: %v", err)
+		}
+	})
+}
+
+func TestMoveFile(t *testing.T) {
+	forEachDevice(t, func(t *testing.T, c *Client, dev Device) {
+		if err := c.MoveFile(paperID, ""); err != nil {
+			t.Fatal(err)
+		}
+		metadata, err := c.GetMetadata(paperID)
+		if err != nil || metadata == nil || metadata.Parent != "" || metadata.Version != 4 {
+			t.Fatalf("metadata after move = %+v, %v", metadata, err)
+		}
+		raw, _ := dev.ReadFile(paperID + ".metadata")
+		if !strings.Contains(string(raw), `"pinned":true`) {
+			t.Errorf("unmodelled fields lost: %s", raw)
+		}
+	})
+}
+
+func TestReplaceFileMissing(t *testing.T) {
+	forEachDevice(t, func(t *testing.T, c *Client, dev Device) {
+		src := writeTemp(t, "x.pdf", "%PDF")
+		if err := c.ReplaceFile("00000000-0000-4000-8000-000000000000", src); err == nil {
+			t.Error("ReplaceFile() of a missing document succeeded")
+		}
+	})
+}
+
+func TestRemoveFile(t *testing.T) {
+	forEachDevice(t, func(t *testing.T, c *Client, dev Device) {
+		if err := c.RemoveFile(sheetsID); err != nil {
+			t.Fatal(err)
+		}
+		listed := listNames(t, dev)
+		for _, name := range listed {
+			if strings.HasPrefix(name, sheetsID) {
+				t.Errorf("%s left behind", name)
+			}
+		}
+		if metadata, _ := c.GetMetadata(paperID); metadata == nil {
+			t.Error("unrelated document was removed")
+		}
+	})
+}
+
+func TestCleanupExcept(t *testing.T) {
+	forEachDevice(t, func(t *testing.T, c *Client, dev Device) {
+		result, err := c.CleanupExcept("Quick sheets|Research", true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := names(result.PreservedFiles), []string{"Quick sheets", "Research"}; !slices.Equal(got, want) {
+			t.Errorf("preserved = %v, want %v", got, want)
+		}
+		if got, want := names(result.DeletedFiles), []string{"Book", "Old notes", "Paper"}; !slices.Equal(got, want) {
+			t.Errorf("deleted = %v, want %v", got, want)
+		}
+		if metadata, _ := c.GetMetadata(paperID); metadata == nil {
+			t.Error("dry run removed a document")
+		}
+
+		if _, err := c.CleanupExcept("Quick sheets|Research", false); err != nil {
+			t.Fatal(err)
+		}
+		for _, id := range []string{paperID, oldID, bookID} {
+			if metadata, _ := c.GetMetadata(id); metadata != nil {
+				t.Errorf("%s was not removed", id)
+			}
+		}
+		for _, id := range []string{researchID, sheetsID} {
+			if metadata, _ := c.GetMetadata(id); metadata == nil {
+				t.Errorf("%s was removed", id)
+			}
+		}
+	})
+}
+
+func TestServiceControl(t *testing.T) {
+	dev := NewMemDevice()
+	c := NewDeviceClient(dev)
+	if err := c.StopXochitl(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RestartXochitl(); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(dev.Services, []string{"stop", "restart"}) {
+		t.Errorf("Services = %v", dev.Services)
+	}
+}
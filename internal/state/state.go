@@ -0,0 +1,168 @@
+package state
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Entry records what was last sent to the tablet for one local file
+// it doubles as the last-synced baseline for both sides
+type Entry struct {
+	Path           string    `json:"path"`                 // absolute local path
+	ContentHash    string    `json:"contentHash"`          // sha256 of the local file
+	PDFHash        string    `json:"pdfHash"`              // sha256 of the document on the tablet
+	RenderHash     string    `json:"renderHash,omitempty"` // fingerprint of the options the pdf was rendered with
+	UUID           string    `json:"uuid"`                 // document uuid on the tablet
+	Parent         string    `json:"parent,omitempty"`
+	RemoteVersion  int       `json:"remoteVersion,omitempty"`  // metadata version at last sync
+	RemoteModified string    `json:"remoteModified,omitempty"` // metadata lastModified at last sync
+	LastPushed     time.Time `json:"lastPushed,omitempty"`
+	LastPulled     time.Time `json:"lastPulled,omitempty"`
+}
+
+// Store is a json file mapping local paths to tablet documents
+type Store struct {
+	path    string
+	entries map[string]*Entry
+}
+
+type storeFile struct {
+	Version int      `json:"version"`
+	Entries []*Entry `json:"entries"`
+}
+
+const storeVersion = 1
+
+// DefaultPath returns the state file location under XDG_STATE_HOME
+func DefaultPath() string {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			home = os.TempDir()
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(dir, "remarkable-sync", "state.json")
+}
+
+// Open loads the store at path, starting empty if the file doesn't exist yet
+func Open(path string) (*Store, error) {
+	s := &Store{
+		path:    path,
+		entries: make(map[string]*Entry),
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state: %w", err)
+	}
+
+	var f storeFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse state %s: %w", path, err)
+	}
+	for _, e := range f.Entries {
+		s.entries[e.Path] = e
+	}
+
+	return s, nil
+}
+
+// Path returns the file backing the store
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Get returns the entry for a local path
+func (s *Store) Get(path string) (*Entry, bool) {
+	e, ok := s.entries[key(path)]
+	return e, ok
+}
+
+// Put adds or replaces the entry for e.Path
+func (s *Store) Put(e *Entry) {
+	e.Path = key(e.Path)
+	s.entries[e.Path] = e
+}
+
+// Delete forgets a local path
+func (s *Store) Delete(path string) {
+	delete(s.entries, key(path))
+}
+
+// Entries returns all entries sorted by path
+func (s *Store) Entries() []*Entry {
+	entries := make([]*Entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+	return entries
+}
+
+// Save writes the store atomically
+func (s *Store) Save() error {
+	data, err := json.MarshalIndent(storeFile{
+		Version: storeVersion,
+		Entries: s.Entries(),
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create state dir: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".state-*")
+	if err != nil {
+		return fmt.Errorf("failed to create state file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// HashFile returns the hex sha256 of a file's contents
+func HashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// entries are keyed by absolute path so the same file is found from any cwd
+func key(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
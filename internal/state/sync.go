@@ -0,0 +1,70 @@
+package state
+
+// Action is what a sync does with one document
+type Action int
+
+const (
+	Skip Action = iota
+	Push
+	Pull
+	Conflict
+	Forget       // gone on both sides, drop the entry
+	DeleteLocal  // gone from the tablet and unchanged in the vault, trash the note
+	DeleteRemote // gone from the vault and unchanged on the tablet, trash the document
+)
+
+func (a Action) String() string {
+	switch a {
+	case Push:
+		return "push"
+	case Pull:
+		return "pull"
+	case Conflict:
+		return "conflict"
+	case Forget:
+		return "forget"
+	case DeleteLocal:
+		return "delete local"
+	case DeleteRemote:
+		return "delete remote"
+	default:
+		return "skip"
+	}
+}
+
+// Side is the state of one copy of a document relative to the baseline
+type Side struct {
+	Exists  bool
+	Changed bool
+}
+
+// Decide picks the action for a tracked document from the state of both copies
+// a copy deleted on one side is deleted on the other too, unless that one has changed
+// since the baseline, when the change wins and the copy comes back
+func Decide(local, remote Side) Action {
+	switch {
+	case !local.Exists && !remote.Exists:
+		return Forget
+	case !remote.Exists && local.Changed:
+		return Push
+	case !remote.Exists:
+		return DeleteLocal
+	case !local.Exists && remote.Changed:
+		return Pull
+	case !local.Exists:
+		return DeleteRemote
+	case local.Changed && remote.Changed:
+		return Conflict
+	case local.Changed:
+		return Push
+	case remote.Changed:
+		return Pull
+	default:
+		return Skip
+	}
+}
+
+// RemoteChanged reports whether tablet metadata moved on since the baseline
+func (e *Entry) RemoteChanged(version int, lastModified string) bool {
+	return version != e.RemoteVersion || lastModified != e.RemoteModified
+}
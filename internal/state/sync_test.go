@@ -0,0 +1,30 @@
+package state
+
+import "testing"
+
+func TestDecide(t *testing.T) {
+	var (
+		gone      = Side{}
+		same      = Side{Exists: true}
+		different = Side{Exists: true, Changed: true}
+	)
+	tests := []struct {
+		local, remote Side
+		want          Action
+	}{
+		{gone, gone, Forget},
+		{same, gone, DeleteLocal},
+		{different, gone, Push},
+		{gone, same, DeleteRemote},
+		{gone, different, Pull},
+		{same, same, Skip},
+		{different, same, Push},
+		{same, different, Pull},
+		{different, different, Conflict},
+	}
+	for _, tt := range tests {
+		if got := Decide(tt.local, tt.remote); got != tt.want {
+			t.Errorf("Decide(%+v, %+v) = %v, want %v", tt.local, tt.remote, got, tt.want)
+		}
+	}
+}